@@ -0,0 +1,206 @@
+// Package auth authenticates calling services by API key, either as a bearer
+// token or through an HMAC signature over the request, and enforces scopes.
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/logging"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// HMACScheme is the Authorization scheme of signed requests:
+	//   Authorization: WOLKENLAUF-HMAC-SHA256 Credential=<key id>, Signature=<hex>
+	HMACScheme = "WOLKENLAUF-HMAC-SHA256"
+	// TimestampHeader carries the Unix time a signed request was made at
+	TimestampHeader = "X-Wolkenlauf-Timestamp"
+
+	callerKey      = "auth.caller"
+	bootstrapKeyID = "bootstrap"
+)
+
+// Authenticator resolves the API key behind each request.
+type Authenticator struct {
+	store *store.Store
+	cfg   config.AuthConfig
+}
+
+func New(st *store.Store, cfg config.AuthConfig) *Authenticator {
+	if cfg.AdminKey == "" {
+		slog.Warn("ADMIN_API_KEY is not set; only API keys already in the store can authenticate")
+	}
+	return &Authenticator{store: st, cfg: cfg}
+}
+
+// Authenticate rejects requests without valid credentials with 401 and
+// records the authenticated key for Require and Caller.
+func (a *Authenticator) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, err := a.authenticate(c)
+		if err != nil {
+			logging.FromContext(c.Request.Context()).Warn("Rejected request",
+				"method", c.Request.Method, "path", c.Request.URL.Path, "client_ip", c.ClientIP(), "error", err)
+			c.Header("WWW-Authenticate", `Bearer realm="wolkenlauf"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or missing credentials"})
+			return
+		}
+		c.Set(callerKey, key)
+		c.Request = c.Request.WithContext(logging.With(c.Request.Context(), "caller", key.ID))
+		c.Next()
+	}
+}
+
+// Require rejects callers whose key does not grant scope with 403.
+func Require(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key := Caller(c); key == nil || !key.HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("API key lacks the %s scope", scope)})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Caller returns the API key that authenticated the request, if any.
+func Caller(c *gin.Context) *models.APIKey {
+	value, _ := c.Get(callerKey)
+	key, _ := value.(*models.APIKey)
+	return key
+}
+
+func (a *Authenticator) authenticate(c *gin.Context) (*models.APIKey, error) {
+	header := c.GetHeader("Authorization")
+	scheme, credentials, _ := strings.Cut(header, " ")
+	switch {
+	case header == "":
+		return nil, errors.New("missing Authorization header")
+	case strings.EqualFold(scheme, "Bearer"):
+		return a.bearer(c.Request.Context(), strings.TrimSpace(credentials))
+	case scheme == HMACScheme:
+		return a.signed(c, credentials)
+	default:
+		return nil, fmt.Errorf("unsupported authorization scheme %q", scheme)
+	}
+}
+
+// bearer checks a "<key id>.<secret>" token, or the bootstrap admin key.
+func (a *Authenticator) bearer(ctx context.Context, token string) (*models.APIKey, error) {
+	if a.cfg.AdminKey != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.cfg.AdminKey)) == 1 {
+		return &models.APIKey{ID: bootstrapKeyID, Name: bootstrapKeyID, Scopes: []string{models.ScopeAdmin}}, nil
+	}
+
+	id, secret, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errors.New("malformed bearer token")
+	}
+	key, err := a.lookup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range validSecrets(key) {
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(s)) == 1 {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("wrong secret for API key %s", id)
+}
+
+// signed verifies an HMAC-SHA256 signature over the method, request URI,
+// timestamp and body hash (see StringToSign).
+func (a *Authenticator) signed(c *gin.Context, credentials string) (*models.APIKey, error) {
+	var id, signature string
+	for _, part := range strings.Split(credentials, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "Credential":
+			id = value
+		case "Signature":
+			signature = value
+		}
+	}
+	mac, err := hex.DecodeString(signature)
+	if id == "" || err != nil || len(mac) == 0 {
+		return nil, errors.New("malformed signature credentials")
+	}
+
+	timestamp := c.GetHeader(TimestampHeader)
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("missing or invalid %s header", TimestampHeader)
+	}
+	if skew := time.Since(time.Unix(unix, 0)); skew > a.cfg.MaxClockSkew || skew < -a.cfg.MaxClockSkew {
+		return nil, fmt.Errorf("request timestamp is %s off", skew.Round(time.Second))
+	}
+
+	key, err := a.lookup(c.Request.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	// The handler still needs the body after it has been hashed
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	message := StringToSign(c.Request.Method, c.Request.URL.RequestURI(), timestamp, body)
+	for _, s := range validSecrets(key) {
+		h := hmac.New(sha256.New, []byte(s))
+		h.Write([]byte(message))
+		if hmac.Equal(mac, h.Sum(nil)) {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("signature mismatch for API key %s", id)
+}
+
+// StringToSign is the message a client signs with its secret:
+// method, request URI (path and query), timestamp and the hex SHA-256 of
+// the body, separated by newlines.
+func StringToSign(method, requestURI, timestamp string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return strings.Join([]string{method, requestURI, timestamp, hex.EncodeToString(sum[:])}, "\n")
+}
+
+func (a *Authenticator) lookup(ctx context.Context, id string) (*models.APIKey, error) {
+	key, err := a.store.GetAPIKey(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("unknown API key %s", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key.RevokedAt != nil {
+		return nil, fmt.Errorf("API key %s was revoked", id)
+	}
+	return key, nil
+}
+
+// validSecrets returns the current secret and, during the rotation grace
+// period, the previous one.
+func validSecrets(key *models.APIKey) []string {
+	secrets := []string{key.Secret}
+	if key.PreviousSecret != "" && key.PreviousExpiresAt != nil && time.Now().Before(*key.PreviousExpiresAt) {
+		secrets = append(secrets, key.PreviousSecret)
+	}
+	return secrets
+}
@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	testAdminKey = "admin-token"
+	testKeyID    = "key_test"
+	testSecret   = "current-secret"
+	testSkew     = 5 * time.Minute
+)
+
+// newTestRouter serves POST /echo, which returns the request body, behind
+// an authenticator backed by a fresh store holding testKeyID.
+func newTestRouter(t *testing.T) (*gin.Engine, *store.Store) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	ctx := context.Background()
+	st, err := store.Open(ctx, config.StoreConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "auth.db")})
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+
+	key := &models.APIKey{ID: testKeyID, Name: "test", Scopes: []string{models.ScopeRead}, Secret: testSecret}
+	if err := st.CreateAPIKey(ctx, key); err != nil {
+		t.Fatalf("create API key: %v", err)
+	}
+
+	a := New(st, config.AuthConfig{AdminKey: testAdminKey, MaxClockSkew: testSkew, RotationGrace: time.Hour})
+	r := gin.New()
+	r.POST("/echo", a.Authenticate(), func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, "%s:%s", Caller(c).ID, body)
+	})
+	return r, st
+}
+
+func sign(secret, method, requestURI, timestamp string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(StringToSign(method, requestURI, timestamp, body)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func TestStringToSign(t *testing.T) {
+	got := StringToSign("POST", "/vm/create?dryRun=1", "1700000000", []byte(`{"name":"a"}`))
+	sum := sha256.Sum256([]byte(`{"name":"a"}`))
+	want := "POST\n/vm/create?dryRun=1\n1700000000\n" + hex.EncodeToString(sum[:])
+	if got != want {
+		t.Errorf("StringToSign = %q, want %q", got, want)
+	}
+}
+
+func TestAuthenticateBearer(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+		wantCaller    string
+	}{
+		{"missing header", "", http.StatusUnauthorized, ""},
+		{"bootstrap admin key", "Bearer " + testAdminKey, http.StatusOK, bootstrapKeyID},
+		{"scheme is case-insensitive", "bearer " + testAdminKey, http.StatusOK, bootstrapKeyID},
+		{"API key", "Bearer " + testKeyID + "." + testSecret, http.StatusOK, testKeyID},
+		{"wrong secret", "Bearer " + testKeyID + ".wrong", http.StatusUnauthorized, ""},
+		{"unknown key", "Bearer key_other." + testSecret, http.StatusUnauthorized, ""},
+		{"malformed token", "Bearer " + testSecret, http.StatusUnauthorized, ""},
+		{"unsupported scheme", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("body"))
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && w.Body.String() != tt.wantCaller+":body" {
+				t.Errorf("body = %q, want caller %s", w.Body.String(), tt.wantCaller)
+			}
+		})
+	}
+}
+
+func TestAuthenticateSigned(t *testing.T) {
+	r, _ := newTestRouter(t)
+	body := []byte(`{"name":"vm"}`)
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		timestamp  string
+		secret     string
+		signedURI  string // signed instead of the request URI when set
+		signedBody []byte // signed instead of the body when set
+		credential string // Authorization credentials when set
+		wantStatus int
+	}{
+		{name: "valid", timestamp: unix(now), secret: testSecret, wantStatus: http.StatusOK},
+		{name: "timestamp within skew", timestamp: unix(now.Add(-testSkew + time.Minute)), secret: testSecret, wantStatus: http.StatusOK},
+		{name: "timestamp too old", timestamp: unix(now.Add(-testSkew - time.Minute)), secret: testSecret, wantStatus: http.StatusUnauthorized},
+		{name: "timestamp too far ahead", timestamp: unix(now.Add(testSkew + time.Minute)), secret: testSecret, wantStatus: http.StatusUnauthorized},
+		{name: "missing timestamp", timestamp: "", secret: testSecret, wantStatus: http.StatusUnauthorized},
+		{name: "non-numeric timestamp", timestamp: "yesterday", secret: testSecret, wantStatus: http.StatusUnauthorized},
+		{name: "wrong secret", timestamp: unix(now), secret: "wrong", wantStatus: http.StatusUnauthorized},
+		{name: "tampered body", timestamp: unix(now), secret: testSecret, signedBody: []byte(`{"name":"other"}`), wantStatus: http.StatusUnauthorized},
+		{name: "tampered query", timestamp: unix(now), secret: testSecret, signedURI: "/echo?userId=other", wantStatus: http.StatusUnauthorized},
+		{name: "malformed signature", timestamp: unix(now), credential: "Credential=" + testKeyID + ", Signature=not-hex", wantStatus: http.StatusUnauthorized},
+		{name: "missing credential", timestamp: unix(now), credential: "Signature=00ff", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uri := "/echo?userId=u1"
+			signedURI, signedBody := uri, body
+			if tt.signedURI != "" {
+				signedURI = tt.signedURI
+			}
+			if tt.signedBody != nil {
+				signedBody = tt.signedBody
+			}
+			credential := tt.credential
+			if credential == "" {
+				credential = "Credential=" + testKeyID + ", Signature=" + sign(tt.secret, http.MethodPost, signedURI, tt.timestamp, signedBody)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, uri, strings.NewReader(string(body)))
+			req.Header.Set("Authorization", HMACScheme+" "+credential)
+			if tt.timestamp != "" {
+				req.Header.Set(TimestampHeader, tt.timestamp)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			// The handler still gets the body that was hashed
+			if tt.wantStatus == http.StatusOK && w.Body.String() != testKeyID+":"+string(body) {
+				t.Errorf("body = %q, want the request body", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuthenticateRotationAndRevocation(t *testing.T) {
+	r, st := newTestRouter(t)
+	ctx := context.Background()
+
+	status := func(secret string) int {
+		req := httptest.NewRequest(http.MethodPost, "/echo", nil)
+		req.Header.Set("Authorization", "Bearer "+testKeyID+"."+secret)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if _, err := st.RotateAPIKey(ctx, testKeyID, "new-secret", time.Hour); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if got := status("new-secret"); got != http.StatusOK {
+		t.Errorf("new secret: status = %d, want 200", got)
+	}
+	if got := status(testSecret); got != http.StatusOK {
+		t.Errorf("previous secret within grace: status = %d, want 200", got)
+	}
+
+	if _, err := st.RotateAPIKey(ctx, testKeyID, "newest-secret", -time.Second); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if got := status("new-secret"); got != http.StatusUnauthorized {
+		t.Errorf("previous secret after grace: status = %d, want 401", got)
+	}
+
+	if err := st.RevokeAPIKey(ctx, testKeyID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if got := status("newest-secret"); got != http.StatusUnauthorized {
+		t.Errorf("revoked key: status = %d, want 401", got)
+	}
+}
+
+func unix(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
@@ -0,0 +1,151 @@
+// Package catalog serves the instance types the providers offer, with specs
+// and prices, from a cache refreshed on demand.
+package catalog
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/logging"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/providers"
+)
+
+// Filter narrows a catalog listing. Zero values match everything.
+type Filter struct {
+	Provider string
+	Region   string
+	GPU      *bool   // only types with (true) or without (false) GPUs
+	MaxPrice float64 // hourly price ceiling in the provider's currency
+	Spot     bool    // compare MaxPrice against the spot price
+}
+
+// Result is a catalog listing. Providers that could not be queried, and had
+// nothing cached, are reported in Errors instead of failing the listing.
+type Result struct {
+	InstanceTypes []models.InstanceTypeSpec `json:"instanceTypes"`
+	Errors        map[string]string         `json:"errors,omitempty"` // provider -> error
+}
+
+type cacheKey struct {
+	provider string
+	region   string
+}
+
+type cacheEntry struct {
+	specs     []models.InstanceTypeSpec
+	fetchedAt time.Time
+}
+
+// Catalog discovers instance types from the providers and caches them per
+// provider and region.
+type Catalog struct {
+	providers *providers.Registry
+	cfg       config.CatalogConfig
+
+	mu    sync.Mutex
+	cache map[cacheKey]cacheEntry
+}
+
+func New(registry *providers.Registry, cfg config.CatalogConfig) *Catalog {
+	return &Catalog{
+		providers: registry,
+		cfg:       cfg,
+		cache:     map[cacheKey]cacheEntry{},
+	}
+}
+
+// List returns the instance types matching f, sorted by provider, region and
+// hourly price.
+func (c *Catalog) List(ctx context.Context, f Filter) Result {
+	result := Result{InstanceTypes: []models.InstanceTypeSpec{}}
+
+	for name, provider := range c.providers.Available() {
+		if f.Provider != "" && f.Provider != name {
+			continue
+		}
+
+		specs, err := c.instanceTypes(ctx, name, provider, f.Region)
+		if err != nil {
+			if result.Errors == nil {
+				result.Errors = map[string]string{}
+			}
+			result.Errors[name] = err.Error()
+			continue
+		}
+
+		for _, spec := range specs {
+			if f.matches(spec) {
+				result.InstanceTypes = append(result.InstanceTypes, spec)
+			}
+		}
+	}
+
+	sort.Slice(result.InstanceTypes, func(i, j int) bool {
+		a, b := result.InstanceTypes[i], result.InstanceTypes[j]
+		if a.Provider != b.Provider {
+			return a.Provider < b.Provider
+		}
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+		if a.HourlyPrice != b.HourlyPrice {
+			return a.HourlyPrice < b.HourlyPrice
+		}
+		return a.Name < b.Name
+	})
+	return result
+}
+
+// instanceTypes serves a provider's types in region from the cache, fetching
+// them when the entry is missing or older than the cache TTL. A failed
+// refresh falls back to the stale entry.
+func (c *Catalog) instanceTypes(ctx context.Context, name string, provider models.CloudProvider, region string) ([]models.InstanceTypeSpec, error) {
+	key := cacheKey{provider: name, region: region}
+
+	c.mu.Lock()
+	entry, cached := c.cache[key]
+	c.mu.Unlock()
+	if cached && time.Since(entry.fetchedAt) < c.cfg.CacheTTL {
+		return entry.specs, nil
+	}
+
+	fetchCtx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	specs, err := provider.ListInstanceTypes(fetchCtx, region)
+	if err != nil {
+		if cached {
+			logging.FromContext(ctx).Warn("Refreshing catalog failed, serving cached entry",
+				"provider", name, "region", region, "fetched_at", entry.fetchedAt.Format(time.RFC3339), "error", err)
+			return entry.specs, nil
+		}
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.cache[key] = cacheEntry{specs: specs, fetchedAt: time.Now()}
+	c.mu.Unlock()
+
+	logging.FromContext(ctx).Info("Cached instance types", "provider", name, "region", region, "count", len(specs))
+	return specs, nil
+}
+
+func (f Filter) matches(spec models.InstanceTypeSpec) bool {
+	if f.GPU != nil && *f.GPU != (spec.GPUs > 0) {
+		return false
+	}
+	if f.MaxPrice > 0 {
+		price := spec.HourlyPrice
+		if f.Spot {
+			price = spec.SpotPrice
+		}
+		if price <= 0 || price > f.MaxPrice {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,130 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/providers"
+)
+
+// fakeProvider lists fixed instance types, or fails with err, counting
+// every fetch, and prices resources at fixed rates. Other methods are not
+// implemented.
+type fakeProvider struct {
+	models.CloudProvider
+	specs     []models.InstanceTypeSpec
+	resources models.ResourcePrices
+	err       error
+	fetches   int
+}
+
+func (p *fakeProvider) ListInstanceTypes(ctx context.Context, region string) ([]models.InstanceTypeSpec, error) {
+	p.fetches++
+	return p.specs, p.err
+}
+
+func (p *fakeProvider) PriceResources(ctx context.Context, req *models.VMRequest) (*models.ResourcePrices, error) {
+	return &p.resources, nil
+}
+
+// testProvider is what the "test-catalog" registration starts
+var testProvider *fakeProvider
+
+func init() {
+	providers.Register("test-catalog", models.ProviderCapabilities{}, func(cfg *config.Config) (models.CloudProvider, error) {
+		return testProvider, nil
+	})
+}
+
+func newTestCatalog(t *testing.T, provider *fakeProvider, cacheTTL time.Duration) *Catalog {
+	t.Helper()
+	testProvider = provider
+	registry := providers.NewRegistry(&config.Config{Providers: config.ProvidersConfig{Enabled: []string{"test-catalog"}}})
+	return New(registry, config.CatalogConfig{CacheTTL: cacheTTL, Timeout: time.Minute})
+}
+
+var testSpecs = []models.InstanceTypeSpec{
+	{Provider: "test-catalog", Name: "gpu", Region: "eu-1", GPUs: 1, HourlyPrice: 2, SpotPrice: 0.6},
+	{Provider: "test-catalog", Name: "large", Region: "eu-1", HourlyPrice: 0.4, SpotPrice: 0.1},
+	{Provider: "test-catalog", Name: "small", Region: "eu-1", HourlyPrice: 0.1},
+}
+
+func names(specs []models.InstanceTypeSpec) []string {
+	var names []string
+	for _, spec := range specs {
+		names = append(names, spec.Name)
+	}
+	return names
+}
+
+func TestListFilters(t *testing.T) {
+	withGPU, withoutGPU := true, false
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"everything, cheapest first", Filter{}, []string{"small", "large", "gpu"}},
+		{"other provider", Filter{Provider: "aws"}, nil},
+		{"with GPUs", Filter{GPU: &withGPU}, []string{"gpu"}},
+		{"without GPUs", Filter{GPU: &withoutGPU}, []string{"small", "large"}},
+		{"on-demand price ceiling", Filter{MaxPrice: 0.5}, []string{"small", "large"}},
+		{"spot price ceiling skips types without spot", Filter{MaxPrice: 0.5, Spot: true}, []string{"large"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCatalog(t, &fakeProvider{specs: testSpecs}, time.Hour)
+			result := c.List(context.Background(), tt.filter)
+			if got := names(result.InstanceTypes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("instance types = %v, want %v", got, tt.want)
+			}
+			if len(result.Errors) > 0 {
+				t.Errorf("errors = %v, want none", result.Errors)
+			}
+		})
+	}
+}
+
+func TestListCache(t *testing.T) {
+	ctx := context.Background()
+	unreachable := errors.New("unreachable")
+
+	t.Run("fresh entries are served from the cache", func(t *testing.T) {
+		provider := &fakeProvider{specs: testSpecs}
+		c := newTestCatalog(t, provider, time.Hour)
+		c.List(ctx, Filter{})
+		c.List(ctx, Filter{})
+		if provider.fetches != 1 {
+			t.Errorf("fetches = %d, want 1", provider.fetches)
+		}
+	})
+
+	t.Run("failed refresh serves the stale entry", func(t *testing.T) {
+		provider := &fakeProvider{specs: testSpecs}
+		c := newTestCatalog(t, provider, 0)
+		c.List(ctx, Filter{})
+		provider.specs, provider.err = nil, unreachable
+
+		result := c.List(ctx, Filter{})
+		if provider.fetches != 2 {
+			t.Errorf("fetches = %d, want 2", provider.fetches)
+		}
+		if got := names(result.InstanceTypes); len(got) != len(testSpecs) || len(result.Errors) > 0 {
+			t.Errorf("listing = %v (errors %v), want the cached types", got, result.Errors)
+		}
+	})
+
+	t.Run("failure without an entry is reported", func(t *testing.T) {
+		c := newTestCatalog(t, &fakeProvider{err: unreachable}, time.Hour)
+		result := c.List(ctx, Filter{})
+		if len(result.InstanceTypes) > 0 || result.Errors["test-catalog"] != unreachable.Error() {
+			t.Errorf("listing = %+v, want only the provider error", result)
+		}
+	})
+}
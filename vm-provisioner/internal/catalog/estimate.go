@@ -0,0 +1,92 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"vm-provisioner/internal/models"
+)
+
+// ErrNotOffered is returned when a provider does not offer the instance
+// type in the requested region.
+var ErrNotOffered = errors.New("instance type not offered")
+
+// Estimate projects the hourly and, with AutoTerminateMinutes, total cost of
+// req in both markets from the same prices the catalog serves.
+func (c *Catalog) Estimate(ctx context.Context, req *models.VMRequest) (*models.CostEstimate, error) {
+	provider, err := c.providers.Get(req.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	specs, err := c.instanceTypes(ctx, req.Provider, provider, req.Region)
+	if err != nil {
+		return nil, err
+	}
+	var spec *models.InstanceTypeSpec
+	for i := range specs {
+		if specs[i].Name == req.InstanceType {
+			spec = &specs[i]
+			break
+		}
+	}
+	if spec == nil {
+		return nil, fmt.Errorf("%w: %s at %s in %s", ErrNotOffered, req.InstanceType, req.Provider, req.Region)
+	}
+
+	priceCtx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+	resources, err := provider.PriceResources(priceCtx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	duration := time.Duration(req.AutoTerminateMinutes) * time.Minute
+	estimate := &models.CostEstimate{
+		Provider:        req.Provider,
+		InstanceType:    spec.Name,
+		Region:          spec.Region,
+		Currency:        spec.Currency,
+		DiskGiB:         resources.DiskGiB,
+		DurationMinutes: req.AutoTerminateMinutes,
+		UseSpotInstance: req.UseSpotInstance,
+		OnDemand:        breakdown(spec.HourlyPrice, resources, duration),
+	}
+	if spec.SpotPrice > 0 {
+		spot := breakdown(spec.SpotPrice, resources, duration)
+		estimate.Spot = &spot
+	}
+
+	selected := estimate.OnDemand
+	if req.UseSpotInstance {
+		if estimate.Spot == nil {
+			return nil, fmt.Errorf("%w: no spot market for %s in %s", ErrNotOffered, spec.Name, spec.Region)
+		}
+		selected = *estimate.Spot
+	}
+	estimate.HourlyCost = selected.Hourly
+	estimate.TotalCost = selected.Total
+	return estimate, nil
+}
+
+func breakdown(computeHourly float64, resources *models.ResourcePrices, duration time.Duration) models.CostBreakdown {
+	b := models.CostBreakdown{
+		ComputeHourly:    round(computeHourly),
+		StorageHourly:    round(resources.StorageHourly),
+		PublicIPv4Hourly: round(resources.PublicIPv4Hourly),
+		Hourly:           round(computeHourly + resources.StorageHourly + resources.PublicIPv4Hourly),
+	}
+	if duration > 0 {
+		total := round((computeHourly + resources.StorageHourly + resources.PublicIPv4Hourly) * duration.Hours())
+		b.Total = &total
+	}
+	return b
+}
+
+// round keeps prices at a hundredth of a cent
+func round(price float64) float64 {
+	return math.Round(price*1e4) / 1e4
+}
@@ -0,0 +1,90 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/providers"
+)
+
+func TestEstimate(t *testing.T) {
+	resources := models.ResourcePrices{DiskGiB: 20, StorageHourly: 0.01, PublicIPv4Hourly: 0.005}
+
+	tests := []struct {
+		name string
+		req  models.VMRequest
+
+		wantErr    error // matched with errors.Is when set
+		wantHourly float64
+		wantTotal  float64 // zero without AutoTerminateMinutes
+		wantSpot   bool
+	}{
+		{
+			name:       "on-demand without a deadline",
+			req:        models.VMRequest{Provider: "test-catalog", Region: "eu-1", InstanceType: "small"},
+			wantHourly: 0.115,
+		},
+		{
+			name:       "on-demand with a deadline",
+			req:        models.VMRequest{Provider: "test-catalog", Region: "eu-1", InstanceType: "small", AutoTerminateMinutes: 90},
+			wantHourly: 0.115,
+			wantTotal:  0.1725,
+		},
+		{
+			name:       "spot selects the spot market",
+			req:        models.VMRequest{Provider: "test-catalog", Region: "eu-1", InstanceType: "large", UseSpotInstance: true, AutoTerminateMinutes: 120},
+			wantHourly: 0.115,
+			wantTotal:  0.23,
+			wantSpot:   true,
+		},
+		{
+			name:    "spot where no spot market exists",
+			req:     models.VMRequest{Provider: "test-catalog", Region: "eu-1", InstanceType: "small", UseSpotInstance: true},
+			wantErr: ErrNotOffered,
+		},
+		{
+			name:    "type not offered",
+			req:     models.VMRequest{Provider: "test-catalog", Region: "eu-1", InstanceType: "huge"},
+			wantErr: ErrNotOffered,
+		},
+		{
+			name:    "unknown provider",
+			req:     models.VMRequest{Provider: "nimbus", Region: "eu-1", InstanceType: "small"},
+			wantErr: providers.ErrUnknownProvider,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCatalog(t, &fakeProvider{specs: testSpecs, resources: resources}, time.Hour)
+			estimate, err := c.Estimate(context.Background(), &tt.req)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("estimate: %v", err)
+			}
+
+			if estimate.HourlyCost != tt.wantHourly {
+				t.Errorf("hourly cost = %v, want %v", estimate.HourlyCost, tt.wantHourly)
+			}
+			switch {
+			case tt.wantTotal == 0 && estimate.TotalCost != nil:
+				t.Errorf("total cost = %v, want none", *estimate.TotalCost)
+			case tt.wantTotal != 0 && (estimate.TotalCost == nil || *estimate.TotalCost != tt.wantTotal):
+				t.Errorf("total cost = %v, want %v", estimate.TotalCost, tt.wantTotal)
+			}
+			if (estimate.Spot != nil) != tt.wantSpot || estimate.UseSpotInstance != tt.wantSpot {
+				t.Errorf("spot breakdown = %+v (selected %v), want %v", estimate.Spot, estimate.UseSpotInstance, tt.wantSpot)
+			}
+			if estimate.DiskGiB != resources.DiskGiB {
+				t.Errorf("disk = %d GiB, want %d", estimate.DiskGiB, resources.DiskGiB)
+			}
+		})
+	}
+}
@@ -1,16 +1,42 @@
 package config
 
 import (
+	"log/slog"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	AWS     AWSConfig
-	Hetzner HetznerConfig
+	Providers  ProvidersConfig
+	AWS        AWSConfig
+	Hetzner    HetznerConfig
+	Store      StoreConfig
+	Timeouts   TimeoutConfig
+	Reaper     ReaperConfig
+	Reconciler ReconcilerConfig
+	Spot       SpotConfig
+	Watcher    WatcherConfig
+	Webhooks   WebhookConfig
+	Snapshots  SnapshotConfig
+	Operations OperationsConfig
+	Catalog    CatalogConfig
+	Auth       AuthConfig
+	CORS       CORSConfig
+	Log        LogConfig
+	Tracing    TracingConfig
+}
+
+// ProvidersConfig selects which registered cloud providers are started.
+// Without Enabled, every registered provider is.
+type ProvidersConfig struct {
+	Enabled []string
 }
 
 type AWSConfig struct {
-	Region          string
+	Region          string   // default region when a request does not name one
+	Regions         []string // optional allowlist of regions VMs may be created in
 	AccessKeyID     string
 	SecretAccessKey string
 }
@@ -19,16 +45,192 @@ type HetznerConfig struct {
 	Token string
 }
 
+// StoreConfig selects the database holding the provisioner's VM state.
+// Driver is "sqlite" (default) or "postgres"; DSN is passed to the driver.
+type StoreConfig struct {
+	Driver string
+	DSN    string
+}
+
+// TimeoutConfig holds the deadline applied to each provider operation.
+// The deadline is layered on top of the request context, so whichever
+// fires first (client disconnect or timeout) cancels the cloud API call.
+type TimeoutConfig struct {
+	Create time.Duration
+	Delete time.Duration
+	Status time.Duration
+	Power  time.Duration // stop, start and reboot
+	// Shutdown is how long in-flight requests may take to finish once a
+	// SIGINT or SIGTERM was received.
+	Shutdown time.Duration
+}
+
+// ReaperConfig controls server-side enforcement of AutoTerminateMinutes.
+type ReaperConfig struct {
+	Interval    time.Duration // how often deadlines are checked
+	WarningLead time.Duration // how long before the deadline a warning event is emitted
+}
+
+// ReconcilerConfig controls the periodic diff between providers and the store.
+type ReconcilerConfig struct {
+	Interval          time.Duration
+	TerminateOrphans  bool          // terminate tagged VMs the store does not know
+	OrphanGracePeriod time.Duration // how long listings may lag behind launches and deletions before drift is acted on
+}
+
+// SpotConfig controls detection of spot interruptions.
+type SpotConfig struct {
+	Interval time.Duration // how often providers are asked about spot VMs
+}
+
+// WatcherConfig controls how often live VMs are polled for status changes,
+// which are then pushed to event stream subscribers.
+type WatcherConfig struct {
+	Interval time.Duration
+}
+
+// WebhookConfig controls delivery of webhook events. Failed deliveries are
+// retried with exponential backoff starting at RetryBackoff and moved to the
+// dead-letter log after MaxAttempts.
+type WebhookConfig struct {
+	Interval     time.Duration // how often due retries are looked for
+	Timeout      time.Duration // deadline of one delivery attempt
+	MaxAttempts  int
+	RetryBackoff time.Duration
+}
+
+// SnapshotConfig controls snapshot creation and the default retention
+// policy; users can set their own. Zero limits keep snapshots forever.
+type SnapshotConfig struct {
+	Timeout    time.Duration // deadline for capturing one snapshot
+	GCInterval time.Duration // how often retention policies are enforced
+	KeepLast   int           // newest snapshots kept per user
+	MaxAgeDays int           // snapshots older than this are deleted
+}
+
+// OperationsConfig sizes the worker pool executing asynchronous operations.
+type OperationsConfig struct {
+	Workers   int
+	QueueSize int
+	// IdempotencyKeyTTL is how long an Idempotency-Key replays its result
+	IdempotencyKeyTTL time.Duration
+}
+
+// CatalogConfig controls the instance type catalog.
+type CatalogConfig struct {
+	CacheTTL time.Duration // how long discovered types and prices are served from cache
+	Timeout  time.Duration // deadline for refreshing one provider and region
+}
+
+// AuthConfig controls authentication of calling services.
+type AuthConfig struct {
+	// AdminKey is a bootstrap bearer token with the admin scope, used to
+	// issue the first API keys. Leave empty once keys exist.
+	AdminKey      string
+	MaxClockSkew  time.Duration // accepted age of an HMAC request timestamp
+	RotationGrace time.Duration // how long a rotated-out secret keeps working
+}
+
+// LogConfig selects the log level (debug, info, warn, error) and format
+// (text or json).
+type LogConfig struct {
+	Level  string
+	Format string
+}
+
+// TracingConfig enables OpenTelemetry tracing: spans are exported over
+// OTLP/HTTP to Endpoint, e.g. a local collector at http://localhost:4318.
+// Without an endpoint tracing is off.
+type TracingConfig struct {
+	Endpoint    string
+	ServiceName string
+	SampleRatio float64 // share of new traces recorded; callers' sampling decisions are kept
+}
+
+// CORSConfig lists the browser origins allowed to call the API.
+// Without origins no CORS headers are sent; "*" allows any origin.
+type CORSConfig struct {
+	AllowedOrigins []string
+}
+
 func Load() *Config {
 	return &Config{
+		Providers: ProvidersConfig{
+			Enabled: getList("ENABLED_PROVIDERS"),
+		},
 		AWS: AWSConfig{
 			Region:          getEnv("AWS_REGION", "us-east-1"),
+			Regions:         getList("AWS_REGIONS"),
 			AccessKeyID:     getEnv("AWS_ACCESS_KEY_ID", ""),
 			SecretAccessKey: getEnv("AWS_SECRET_ACCESS_KEY", ""),
 		},
 		Hetzner: HetznerConfig{
 			Token: getEnv("HETZNER_TOKEN", ""),
 		},
+		Store: StoreConfig{
+			Driver: getEnv("STORE_DRIVER", "sqlite"),
+			DSN:    getEnv("STORE_DSN", "file:wolkenlauf.db?_busy_timeout=5000&_foreign_keys=on"),
+		},
+		Timeouts: TimeoutConfig{
+			Create:   getDuration("CREATE_VM_TIMEOUT", 2*time.Minute),
+			Delete:   getDuration("DELETE_VM_TIMEOUT", time.Minute),
+			Status:   getDuration("STATUS_VM_TIMEOUT", 15*time.Second),
+			Power:    getDuration("POWER_VM_TIMEOUT", 30*time.Second),
+			Shutdown: getDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+		},
+		Reaper: ReaperConfig{
+			Interval:    getDuration("REAPER_INTERVAL", 30*time.Second),
+			WarningLead: getDuration("TTL_WARNING_LEAD", 10*time.Minute),
+		},
+		Reconciler: ReconcilerConfig{
+			Interval:          getDuration("RECONCILE_INTERVAL", 5*time.Minute),
+			TerminateOrphans:  getBool("TERMINATE_ORPHANS", false),
+			OrphanGracePeriod: getDuration("ORPHAN_GRACE_PERIOD", time.Hour),
+		},
+		Spot: SpotConfig{
+			Interval: getDuration("SPOT_CHECK_INTERVAL", 30*time.Second),
+		},
+		Watcher: WatcherConfig{
+			Interval: getDuration("WATCH_INTERVAL", 15*time.Second),
+		},
+		Webhooks: WebhookConfig{
+			Interval:     getDuration("WEBHOOK_INTERVAL", 5*time.Second),
+			Timeout:      getDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+			MaxAttempts:  getInt("WEBHOOK_MAX_ATTEMPTS", 8),
+			RetryBackoff: getDuration("WEBHOOK_RETRY_BACKOFF", 30*time.Second),
+		},
+		Snapshots: SnapshotConfig{
+			Timeout:    getDuration("SNAPSHOT_TIMEOUT", 30*time.Minute),
+			GCInterval: getDuration("SNAPSHOT_GC_INTERVAL", time.Hour),
+			KeepLast:   getInt("SNAPSHOT_KEEP_LAST", 0),
+			MaxAgeDays: getInt("SNAPSHOT_MAX_AGE_DAYS", 0),
+		},
+		Operations: OperationsConfig{
+			Workers:           getInt("OPERATION_WORKERS", 8),
+			QueueSize:         getInt("OPERATION_QUEUE_SIZE", 100),
+			IdempotencyKeyTTL: getDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+		},
+		Catalog: CatalogConfig{
+			CacheTTL: getDuration("CATALOG_CACHE_TTL", time.Hour),
+			Timeout:  getDuration("CATALOG_TIMEOUT", 30*time.Second),
+		},
+		Auth: AuthConfig{
+			AdminKey:      getEnv("ADMIN_API_KEY", ""),
+			MaxClockSkew:  getDuration("AUTH_MAX_CLOCK_SKEW", 5*time.Minute),
+			RotationGrace: getDuration("API_KEY_ROTATION_GRACE", 24*time.Hour),
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: getList("CORS_ALLOWED_ORIGINS"),
+		},
+		Log: LogConfig{
+			Level:  getEnv("LOG_LEVEL", "info"),
+			Format: getEnv("LOG_FORMAT", "text"),
+		},
+		Tracing: TracingConfig{
+			Endpoint:    getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", getEnv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")),
+			ServiceName: getEnv("OTEL_SERVICE_NAME", "vm-provisioner"),
+			SampleRatio: getRatio("TRACE_SAMPLE_RATIO", 1),
+		},
 	}
 }
 
@@ -37,4 +239,68 @@ func getEnv(key, defaultValue string) string {
 		return value
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+func getDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		slog.Warn("Invalid duration, using default", "variable", key, "value", value, "default", defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+func getInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		slog.Warn("Invalid integer, using default", "variable", key, "value", value, "default", defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+func getBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		slog.Warn("Invalid boolean, using default", "variable", key, "value", value, "default", defaultValue)
+		return defaultValue
+	}
+	return b
+}
+
+// getRatio parses a fraction between 0 and 1.
+func getRatio(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 || f > 1 {
+		slog.Warn("Invalid ratio, using default", "variable", key, "value", value, "default", defaultValue)
+		return defaultValue
+	}
+	return f
+}
+
+// getList parses a comma-separated environment variable, skipping blanks.
+func getList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,64 @@
+package events
+
+import (
+	"context"
+	"sync"
+
+	"vm-provisioner/internal/logging"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/store"
+)
+
+// Bus publishes VM lifecycle events. Every event is persisted in the store's
+// event log first, so consumers can catch up on anything they missed.
+type Bus struct {
+	store *store.Store
+
+	mu          sync.Mutex
+	subscribers map[chan struct{}]bool
+}
+
+func NewBus(st *store.Store) *Bus {
+	b := &Bus{store: st, subscribers: map[chan struct{}]bool{}}
+	st.OnEvents(b.wake)
+	return b
+}
+
+// Publish persists the event and returns it with its assigned ID.
+func (b *Bus) Publish(ctx context.Context, event models.VMEvent) (models.VMEvent, error) {
+	if err := b.store.AppendEvent(ctx, &event); err != nil {
+		return event, err
+	}
+	logging.FromContext(ctx).Info("Published event", "event_id", event.ID, "event", event.Type, "vm_id", event.VMID, "message", event.Message)
+	return event, nil
+}
+
+// Subscribe returns a channel that receives a signal whenever new events
+// were appended to the event log. Signals are coalesced: subscribers read
+// the events themselves from the log, after the last ID they have seen, so
+// a slow subscriber never loses any. unsubscribe must be called when done.
+func (b *Bus) Subscribe() (signal <-chan struct{}, unsubscribe func()) {
+	ch := make(chan struct{}, 1)
+
+	b.mu.Lock()
+	b.subscribers[ch] = true
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subscribers, ch)
+		b.mu.Unlock()
+	}
+}
+
+func (b *Bus) wake() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default: // already signalled
+		}
+	}
+}
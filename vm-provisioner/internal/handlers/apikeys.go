@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"vm-provisioner/internal/logging"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/store"
+	"vm-provisioner/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyHandler struct {
+	store         *store.Store
+	rotationGrace time.Duration
+}
+
+func NewAPIKeyHandler(st *store.Store, rotationGrace time.Duration) *APIKeyHandler {
+	return &APIKeyHandler{store: st, rotationGrace: rotationGrace}
+}
+
+// CreateAPIKeyRequest issues a key to a calling service
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	Scopes []string `json:"scopes" binding:"required,min=1"`
+}
+
+// APIKeyCredentials is returned once when a key is issued or rotated.
+// Token is the bearer form; Secret signs HMAC requests.
+type APIKeyCredentials struct {
+	APIKey *models.APIKey `json:"apiKey"`
+	Secret string         `json:"secret"`
+	Token  string         `json:"token"`
+	// PreviousSecretExpiresAt is when the rotated-out secret stops working
+	PreviousSecretExpiresAt *time.Time `json:"previousSecretExpiresAt,omitempty"`
+}
+
+func newAPIKeyCredentials(key *models.APIKey) APIKeyCredentials {
+	return APIKeyCredentials{APIKey: key, Secret: key.Secret, Token: key.ID + "." + key.Secret}
+}
+
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(models.Scopes, scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown scope %q; valid scopes are %v", scope, models.Scopes)})
+			return
+		}
+	}
+
+	key := &models.APIKey{
+		ID:     utils.GenerateID("ak"),
+		Name:   req.Name,
+		Scopes: slices.Compact(slices.Sorted(slices.Values(req.Scopes))),
+		Secret: utils.GenerateSecret(),
+	}
+	if err := h.store.CreateAPIKey(c.Request.Context(), key); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logging.FromContext(c.Request.Context()).Info("Issued API key", "key_id", key.ID, "name", key.Name, "scopes", key.Scopes)
+	c.JSON(http.StatusCreated, newAPIKeyCredentials(key))
+}
+
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.store.ListAPIKeys(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if keys == nil {
+		keys = []models.APIKey{}
+	}
+	c.JSON(http.StatusOK, gin.H{"apiKeys": keys})
+}
+
+// RotateAPIKey issues a new secret. The old one keeps working for the
+// rotation grace period so the caller can roll over.
+func (h *APIKeyHandler) RotateAPIKey(c *gin.Context) {
+	key, err := h.store.RotateAPIKey(c.Request.Context(), c.Param("id"), utils.GenerateSecret(), h.rotationGrace)
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+
+	logging.FromContext(c.Request.Context()).Info("Rotated API key", "key_id", key.ID, "name", key.Name)
+	credentials := newAPIKeyCredentials(key)
+	credentials.PreviousSecretExpiresAt = key.PreviousExpiresAt
+	c.JSON(http.StatusOK, credentials)
+}
+
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	if err := h.store.RevokeAPIKey(c.Request.Context(), c.Param("id")); err != nil {
+		respondStoreError(c, err)
+		return
+	}
+
+	logging.FromContext(c.Request.Context()).Info("Revoked API key", "key_id", c.Param("id"))
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+}
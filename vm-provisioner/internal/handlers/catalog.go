@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"vm-provisioner/internal/catalog"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/providers"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CatalogHandler struct {
+	catalog *catalog.Catalog
+}
+
+func NewCatalogHandler(cat *catalog.Catalog) *CatalogHandler {
+	return &CatalogHandler{catalog: cat}
+}
+
+// ListInstanceTypes serves the instance type catalog, filtered by the
+// provider, region, gpu, maxPrice and spot query parameters.
+func (h *CatalogHandler) ListInstanceTypes(c *gin.Context) {
+	filter := catalog.Filter{
+		Provider: c.Query("provider"),
+		Region:   c.Query("region"),
+	}
+
+	if value := c.Query("gpu"); value != "" {
+		gpu, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "gpu must be true or false"})
+			return
+		}
+		filter.GPU = &gpu
+	}
+	if value := c.Query("maxPrice"); value != "" {
+		maxPrice, err := strconv.ParseFloat(value, 64)
+		if err != nil || maxPrice <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "maxPrice must be a positive number"})
+			return
+		}
+		filter.MaxPrice = maxPrice
+	}
+	if value := c.Query("spot"); value != "" {
+		spot, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "spot must be true or false"})
+			return
+		}
+		filter.Spot = spot
+	}
+
+	c.JSON(http.StatusOK, h.catalog.List(c.Request.Context(), filter))
+}
+
+// EstimateCost quotes a VMRequest before launch: hourly cost on-demand and
+// spot, split into compute, storage and public IPv4, and the total over
+// AutoTerminateMinutes. Only provider, instanceType and region are required.
+func (h *CatalogHandler) EstimateCost(c *gin.Context) {
+	var req models.VMRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Provider == "" || req.InstanceType == "" || req.Region == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "provider, instanceType and region are required"})
+		return
+	}
+	if req.AutoTerminateMinutes < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "autoTerminateMinutes must not be negative"})
+		return
+	}
+
+	estimate, err := h.catalog.Estimate(c.Request.Context(), &req)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, estimate)
+	case errors.Is(err, providers.ErrProviderUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	case errors.Is(err, providers.ErrUnknownProvider), errors.Is(err, catalog.ErrNotOffered):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		respondProviderError(c.Request.Context(), c, err)
+	}
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"vm-provisioner/internal/events"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/store"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// eventBatchSize is how many events are read from the log at once
+	eventBatchSize = 100
+	// eventHeartbeat keeps idle streams open through proxies. The log is
+	// also read on every heartbeat, which picks up events recorded by
+	// other provisioner instances sharing the store.
+	eventHeartbeat = 15 * time.Second
+)
+
+type EventHandler struct {
+	store *store.Store
+	bus   *events.Bus
+
+	closeOnce sync.Once
+	closed    chan struct{} // closed by CloseStreams
+}
+
+func NewEventHandler(st *store.Store, bus *events.Bus) *EventHandler {
+	return &EventHandler{store: st, bus: bus, closed: make(chan struct{})}
+}
+
+// CloseStreams ends every open event stream, and any opened later, so that
+// server shutdown does not wait for them. Clients reconnect and resume
+// where they left off.
+func (h *EventHandler) CloseStreams() {
+	h.closeOnce.Do(func() { close(h.closed) })
+}
+
+// eventStream selects the events a client follows.
+type eventStream struct {
+	after  int64
+	userID string
+	vmID   string
+}
+
+// streamRequest reads the stream selection of a request. Clients resume
+// after the ID in the Last-Event-ID header or lastEventId query parameter;
+// without one the stream starts with the next event.
+func (h *EventHandler) streamRequest(c *gin.Context) (eventStream, bool) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return eventStream{}, false
+	}
+	stream := eventStream{userID: userID, vmID: c.Query("vmId")}
+
+	lastID := c.GetHeader("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.Query("lastEventId")
+	}
+	if lastID != "" {
+		id, err := strconv.ParseInt(lastID, 10, 64)
+		if err != nil || id < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid last event id %q", lastID)})
+			return eventStream{}, false
+		}
+		stream.after = id
+		return stream, true
+	}
+
+	latest, err := h.store.LatestEventID(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return eventStream{}, false
+	}
+	stream.after = latest
+	return stream, true
+}
+
+// follow sends the events of the stream as they are recorded until ctx is
+// canceled, the streams are closed or sending fails. heartbeat is called whenever the stream was
+// idle for eventHeartbeat.
+func (h *EventHandler) follow(ctx context.Context, stream eventStream, send func(models.VMEvent) error, heartbeat func() error) error {
+	// Subscribe before the first read so no wake-up falls in between
+	signal, unsubscribe := h.bus.Subscribe()
+	defer unsubscribe()
+
+	ticker := time.NewTicker(eventHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		sent := false
+		for {
+			batch, err := h.store.ListEventsAfter(ctx, stream.after, stream.userID, stream.vmID, eventBatchSize)
+			if err != nil {
+				return err
+			}
+			for _, event := range batch {
+				if err := send(event); err != nil {
+					return err
+				}
+				stream.after = event.ID
+				sent = true
+			}
+			if len(batch) < eventBatchSize {
+				break
+			}
+		}
+		if sent {
+			ticker.Reset(eventHeartbeat)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-h.closed:
+			return nil
+		case <-signal:
+		case <-ticker.C:
+			if err := heartbeat(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// StreamEvents pushes VM events as server-sent events, optionally limited
+// to one VM with vmId. Each event carries its ID, so EventSource clients
+// resume where they left off when they reconnect.
+func (h *EventHandler) StreamEvents(c *gin.Context) {
+	stream, ok := h.streamRequest(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // keep nginx from buffering the stream
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	send := func(event models.VMEvent) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+	heartbeat := func() error {
+		if _, err := io.WriteString(c.Writer, ": ping\n\n"); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+
+	h.follow(c.Request.Context(), stream, send, heartbeat)
+}
+
+// StreamEventsWebSocket pushes the same events as StreamEvents over a
+// WebSocket, one JSON message per event. Clients resume with lastEventId.
+func (h *EventHandler) StreamEventsWebSocket(c *gin.Context) {
+	stream, ok := h.streamRequest(c)
+	if !ok {
+		return
+	}
+
+	// Callers authenticate with an API key, so any Origin is accepted
+	server := websocket.Server{Handler: func(ws *websocket.Conn) {
+		defer ws.Close()
+
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+
+		// The stream is one-way; reading only notices the client leaving
+		go func() {
+			defer cancel()
+			io.Copy(io.Discard, ws)
+		}()
+
+		send := func(event models.VMEvent) error {
+			return websocket.JSON.Send(ws, event)
+		}
+		heartbeat := func() error {
+			return websocket.JSON.Send(ws, gin.H{"type": "heartbeat"})
+		}
+		h.follow(ctx, stream, send, heartbeat)
+	}}
+	server.ServeHTTP(c.Writer, c.Request)
+}
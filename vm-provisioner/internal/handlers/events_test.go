@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"vm-provisioner/internal/events"
+	"vm-provisioner/internal/models"
+)
+
+func TestFollowEndsOnCloseStreams(t *testing.T) {
+	st := newTestStore(t)
+	h := NewEventHandler(st, events.NewBus(st))
+
+	send := func(models.VMEvent) error { return nil }
+	heartbeat := func() error { return nil }
+	done := make(chan error, 1)
+	go func() {
+		done <- h.follow(context.Background(), eventStream{}, send, heartbeat)
+	}()
+
+	h.CloseStreams()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("follow = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("follow did not return after CloseStreams")
+	}
+
+	// Streams opened during shutdown end right away
+	if err := h.follow(context.Background(), eventStream{}, send, heartbeat); err != nil {
+		t.Errorf("follow after CloseStreams = %v, want nil", err)
+	}
+	h.CloseStreams()
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+
+	"vm-provisioner/internal/logging"
+	"vm-provisioner/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxFirewallSources bounds the source entries of a policy summed over its
+// ports; EC2 allows 60 inbound rules per security group.
+const maxFirewallSources = 50
+
+// GetFirewall returns the firewall policy of a VM. VMs still on the shared
+// SSH group report the default policy.
+func (h *VMHandler) GetFirewall(c *gin.Context) {
+	id := c.Param("id")
+
+	record, ok := h.ownedVM(c, id)
+	if !ok {
+		return
+	}
+
+	policy := record.Firewall
+	if policy == nil {
+		policy = models.DefaultFirewallPolicy()
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "firewall": policy})
+}
+
+// SetFirewall replaces the firewall policy of a VM. VMs still on the shared
+// SSH group are moved to a firewall of their own.
+func (h *VMHandler) SetFirewall(c *gin.Context) {
+	var req models.FirewallPolicy
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	policy, err := normalizeFirewall(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	target, ok := h.resolveVM(c)
+	if !ok {
+		return
+	}
+	if target.record != nil && target.record.DeletedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("vm %s is terminated", target.id)})
+		return
+	}
+
+	logging.FromContext(c.Request.Context()).Info("Updating firewall of VM", "region", target.region, "rules", policy.Rules())
+
+	op, err := h.ops.Submit(c.Request.Context(), target.operation("vm.firewall"), h.timeouts.Power,
+		func(ctx context.Context) (any, error) {
+			logger := logging.FromContext(ctx)
+			if err := target.provider.SetFirewall(ctx, target.region, target.id, policy); err != nil {
+				return nil, err
+			}
+
+			if target.record != nil {
+				if err := h.store.SetVMFirewall(context.WithoutCancel(ctx), target.id, policy); err != nil {
+					logger.Error("Failed to record firewall of VM", "error", err)
+				}
+			}
+
+			logger.Info("Firewall of VM updated")
+			return gin.H{"id": target.id, "firewall": policy}, nil
+		})
+	if err != nil {
+		respondSubmitError(c, err)
+		return
+	}
+
+	respondAccepted(c, op)
+}
+
+// normalizeFirewall returns the policy to apply for a request: the default
+// when none is given, with CIDRs in canonical form since Hetzner rejects
+// host bits.
+func normalizeFirewall(policy *models.FirewallPolicy) (*models.FirewallPolicy, error) {
+	if policy == nil {
+		return models.DefaultFirewallPolicy(), nil
+	}
+
+	normalized := &models.FirewallPolicy{}
+	var err error
+	if normalized.SourceCIDRs, err = canonicalCIDRs(policy.SourceCIDRs); err != nil {
+		return nil, err
+	}
+	for _, port := range policy.Ports {
+		if port.Protocol == "" {
+			port.Protocol = "tcp"
+		}
+		if port.SourceCIDRs, err = canonicalCIDRs(port.SourceCIDRs); err != nil {
+			return nil, err
+		}
+		normalized.Ports = append(normalized.Ports, port)
+	}
+
+	sources := 0
+	for _, rule := range normalized.Rules() {
+		sources += len(rule.SourceCIDRs)
+	}
+	if sources > maxFirewallSources {
+		return nil, fmt.Errorf("firewall allows %d port and source combinations, at most %d are supported", sources, maxFirewallSources)
+	}
+	return normalized, nil
+}
+
+func canonicalCIDRs(cidrs []string) ([]string, error) {
+	var canonical []string
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+		}
+		canonical = append(canonical, prefix.Masked().String())
+	}
+	return canonical, nil
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	"vm-provisioner/internal/logging"
+	"vm-provisioner/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+// requestHash fingerprints a request so a key reused with a different
+// payload can be told apart from a retry.
+func requestHash(req models.VMRequest) string {
+	body, _ := json.Marshal(req)
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// clientToken derives the cloud-side idempotency token (EC2 ClientToken,
+// at most 64 ASCII characters) from the caller's key.
+func clientToken(userID, key string) string {
+	sum := sha256.Sum256([]byte(userID + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// claimIdempotencyKey reserves key for a new create request. For a
+// duplicate it writes the original outcome and returns false: the VM for a
+// succeeded operation, otherwise the operation itself.
+func (h *VMHandler) claimIdempotencyKey(c *gin.Context, userID, key, hash string) bool {
+	reserved, existing, err := h.store.ReserveIdempotencyKey(c.Request.Context(), userID, key, hash, h.idempotencyTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if reserved {
+		return true
+	}
+
+	if existing.RequestHash != hash {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used with a different request"})
+		return false
+	}
+	if existing.OperationID == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "a request with this Idempotency-Key is still being processed"})
+		return false
+	}
+
+	op, err := h.store.GetOperation(c.Request.Context(), existing.OperationID)
+	if err != nil {
+		respondStoreError(c, err)
+		return false
+	}
+
+	logging.FromContext(c.Request.Context()).Info("Replaying create for Idempotency-Key",
+		"idempotency_key", key, "operation_id", op.ID, "operation_status", op.Status)
+	c.Header(idempotentReplayedHeader, "true")
+	if op.Status == models.OperationSucceeded && op.Result != nil {
+		c.Header("Location", "/operations/"+op.ID)
+		c.Data(http.StatusOK, "application/json; charset=utf-8", op.Result)
+		return false
+	}
+	respondAccepted(c, op)
+	return false
+}
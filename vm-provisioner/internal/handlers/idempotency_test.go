@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestStore(t *testing.T) *store.Store {
+	t.Helper()
+	st, err := store.Open(context.Background(), config.StoreConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+func TestRequestHash(t *testing.T) {
+	base := models.VMRequest{Name: "vm", Provider: "aws", InstanceType: "t3.micro", Region: "us-east-1", UserID: "u1"}
+
+	tests := []struct {
+		name     string
+		modify   func(req *models.VMRequest)
+		wantSame bool
+	}{
+		{"identical request", func(req *models.VMRequest) {}, true},
+		{"client token is not part of the request", func(req *models.VMRequest) { req.ClientToken = "token" }, true},
+		{"different name", func(req *models.VMRequest) { req.Name = "other" }, false},
+		{"different instance type", func(req *models.VMRequest) { req.InstanceType = "t3.small" }, false},
+		{"spot instead of on-demand", func(req *models.VMRequest) { req.UseSpotInstance = true }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := base
+			tt.modify(&req)
+			if same := requestHash(req) == requestHash(base); same != tt.wantSame {
+				t.Errorf("same hash = %v, want %v", same, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestClientToken(t *testing.T) {
+	token := clientToken("u1", "key-1")
+	if len(token) > 64 {
+		t.Errorf("token has %d characters, EC2 accepts at most 64", len(token))
+	}
+	if clientToken("u1", "key-1") != token {
+		t.Error("token is not deterministic")
+	}
+
+	tests := []struct {
+		name        string
+		userID, key string
+	}{
+		{"other key", "u1", "key-2"},
+		{"same key of another user", "u2", "key-1"},
+		{"user and key split differently", "u1k", "ey-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if clientToken(tt.userID, tt.key) == token {
+				t.Errorf("clientToken(%q, %q) collides with clientToken(u1, key-1)", tt.userID, tt.key)
+			}
+		})
+	}
+}
+
+func TestClaimIdempotencyKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	st := newTestStore(t)
+	h := &VMHandler{store: st, idempotencyTTL: time.Hour}
+
+	claim := func(key, hash string) (bool, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/vm/create", nil)
+		return h.claimIdempotencyKey(c, "u1", key, hash), w
+	}
+
+	// Queued, then succeeded: replays report the operation, then its result
+	queued := &models.Operation{ID: "op_queued", Type: "vm.create", UserID: "u1", Status: models.OperationQueued}
+	succeeded := &models.Operation{ID: "op_done", Type: "vm.create", UserID: "u1", Status: models.OperationQueued}
+	for _, op := range []*models.Operation{queued, succeeded} {
+		if err := st.CreateOperation(ctx, op); err != nil {
+			t.Fatalf("create operation: %v", err)
+		}
+	}
+	if err := st.FinishOperation(ctx, succeeded.ID, []byte(`{"id":"i-123"}`), nil); err != nil {
+		t.Fatalf("finish operation: %v", err)
+	}
+	for key, op := range map[string]string{"queued": queued.ID, "done": succeeded.ID} {
+		if reserved, _ := claim(key, "hash"); !reserved {
+			t.Fatalf("first claim of %s was not reserved", key)
+		}
+		if err := st.SetIdempotencyOperation(ctx, "u1", key, op); err != nil {
+			t.Fatalf("link operation: %v", err)
+		}
+	}
+	if reserved, _ := claim("pending", "hash"); !reserved {
+		t.Fatal("first claim of pending was not reserved")
+	}
+
+	tests := []struct {
+		name         string
+		key, hash    string
+		wantReserved bool
+		wantStatus   int
+		wantReplayed bool
+		wantBody     string
+	}{
+		{name: "new key", key: "new", hash: "hash", wantReserved: true, wantStatus: http.StatusOK},
+		{name: "same key, different request", key: "done", hash: "other", wantStatus: http.StatusUnprocessableEntity},
+		{name: "first request still submitting", key: "pending", hash: "hash", wantStatus: http.StatusConflict},
+		{name: "operation still queued", key: "queued", hash: "hash", wantStatus: http.StatusAccepted, wantReplayed: true},
+		{name: "operation succeeded", key: "done", hash: "hash", wantStatus: http.StatusOK, wantReplayed: true, wantBody: `{"id":"i-123"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reserved, w := claim(tt.key, tt.hash)
+			if reserved != tt.wantReserved {
+				t.Fatalf("reserved = %v, want %v", reserved, tt.wantReserved)
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if replayed := w.Header().Get(idempotentReplayedHeader) == "true"; replayed != tt.wantReplayed {
+				t.Errorf("replayed = %v, want %v", replayed, tt.wantReplayed)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
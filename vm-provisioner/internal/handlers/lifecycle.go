@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"vm-provisioner/internal/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PowerRequest is the optional body of the stop and reboot endpoints
+type PowerRequest struct {
+	Force bool `json:"force,omitempty"` // stop: skip the graceful shutdown
+	Hard  bool `json:"hard,omitempty"`  // reboot: reset instead of a clean reboot
+}
+
+func (h *VMHandler) StopVM(c *gin.Context) {
+	h.power(c, "stop", "stopping", func(ctx context.Context, target vmTarget, req PowerRequest) error {
+		return target.provider.StopVM(ctx, target.region, target.id, req.Force)
+	})
+}
+
+func (h *VMHandler) StartVM(c *gin.Context) {
+	h.power(c, "start", "pending", func(ctx context.Context, target vmTarget, req PowerRequest) error {
+		return target.provider.StartVM(ctx, target.region, target.id)
+	})
+}
+
+func (h *VMHandler) RebootVM(c *gin.Context) {
+	h.power(c, "reboot", "", func(ctx context.Context, target vmTarget, req PowerRequest) error {
+		return target.provider.RebootVM(ctx, target.region, target.id, req.Hard)
+	})
+}
+
+// power runs a lifecycle operation on the VM addressed by the route and, if
+// newStatus is set, records the transition it triggers.
+func (h *VMHandler) power(c *gin.Context, action, newStatus string, fn func(context.Context, vmTarget, PowerRequest) error) {
+	var req PowerRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	target, ok := h.resolveVM(c)
+	if !ok {
+		return
+	}
+
+	logging.FromContext(c.Request.Context()).Info("Changing VM power state",
+		"action", action, "region", target.region, "force", req.Force, "hard", req.Hard)
+
+	op, err := h.ops.Submit(c.Request.Context(), target.operation("vm."+action), h.timeouts.Power,
+		func(ctx context.Context) (any, error) {
+			logger := logging.FromContext(ctx)
+			if err := fn(ctx, target, req); err != nil {
+				return nil, err
+			}
+
+			if target.record != nil && newStatus != "" {
+				if _, err := h.store.UpdateVMStatus(context.WithoutCancel(ctx), target.id, newStatus, target.record.PublicIP, action+" requested via API"); err != nil {
+					logger.Error("Failed to record power state change of VM", "action", action, "error", err)
+				}
+			}
+
+			logger.Info("VM power state change accepted", "action", action)
+			return gin.H{"id": target.id, "action": action, "message": "VM " + action + " requested"}, nil
+		})
+	if err != nil {
+		respondSubmitError(c, err)
+		return
+	}
+
+	respondAccepted(c, op)
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/store"
+	"vm-provisioner/internal/watcher"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+// tagKeyPattern keeps tag keys usable in the tag=key=value filter.
+var tagKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:/-]{0,62}$`)
+
+// ListVMs returns the stored VMs matching the query, newest first, one page
+// at a time. With refresh=true the statuses of the page are fetched from
+// the providers first, batched per provider and region.
+func (h *VMHandler) ListVMs(c *gin.Context) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
+	filter := store.VMFilter{
+		UserID:   userID,
+		Provider: c.Query("provider"),
+		Region:   c.Query("region"),
+		Cursor:   c.Query("cursor"),
+		Limit:    defaultListLimit,
+	}
+	if status := c.Query("status"); status != "" {
+		filter.Statuses = strings.Split(status, ",")
+	}
+	for _, tag := range c.QueryArray("tag") {
+		key, value, _ := strings.Cut(tag, "=")
+		if !tagKeyPattern.MatchString(key) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid tag filter %q, expected key or key=value", tag)})
+			return
+		}
+		if filter.Tags == nil {
+			filter.Tags = map[string]string{}
+		}
+		filter.Tags[key] = value
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxListLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxListLimit)})
+			return
+		}
+		filter.Limit = n
+	}
+
+	vms, next, err := h.store.ListVMs(c.Request.Context(), filter)
+	if errors.Is(err, store.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if vms == nil {
+		vms = []models.VMRecord{}
+	}
+
+	response := gin.H{"vms": vms}
+	if next != "" {
+		response["nextCursor"] = next
+	}
+	if c.Query("refresh") == "true" {
+		if failures := watcher.Refresh(c.Request.Context(), h.store, h.providers.Get, vms, h.timeouts.Status); len(failures) > 0 {
+			response["refreshErrors"] = failures
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// validateTags checks the tags of a create request.
+func validateTags(tags map[string]string) error {
+	for key := range tags {
+		if !tagKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid tag key %q", key)
+		}
+	}
+	return nil
+}
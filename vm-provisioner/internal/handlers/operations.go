@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/operations"
+	"vm-provisioner/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OperationHandler struct {
+	store *store.Store
+	ops   *operations.Manager
+}
+
+func NewOperationHandler(st *store.Store, ops *operations.Manager) *OperationHandler {
+	return &OperationHandler{store: st, ops: ops}
+}
+
+// GetOperation reports the status, progress, result or error of an
+// operation. Operations on other users' VMs are reported as unknown. The
+// first read of a succeeded create includes the generated SSH password,
+// which is never stored.
+func (h *OperationHandler) GetOperation(c *gin.Context) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
+	op, err := h.store.GetOperation(c.Request.Context(), c.Param("id"))
+	if err == nil && !owns(userID, op.UserID) {
+		err = fmt.Errorf("operation %s: %w", op.ID, store.ErrNotFound)
+	}
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	if op.Status == models.OperationSucceeded {
+		if result, ok := h.ops.TakeSecretResult(op.ID); ok {
+			op.Result = result
+		}
+	}
+	c.JSON(http.StatusOK, op)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/operations"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetOperationRevealsPasswordOnce(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	st := newTestStore(t)
+	ops := operations.NewManager(st, config.OperationsConfig{Workers: 1, QueueSize: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := ops.Start(ctx); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		ops.Wait()
+	})
+
+	op, err := ops.Submit(context.Background(), models.Operation{Type: "vm.create", UserID: "u1"}, time.Minute,
+		func(ctx context.Context) (any, error) {
+			return &models.VMResponse{ID: "vm-1", SSHPassword: "hunter2"}, nil
+		})
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		stored, err := st.GetOperation(context.Background(), op.ID)
+		if err != nil {
+			t.Fatalf("get operation: %v", err)
+		}
+		if stored.Status == models.OperationSucceeded {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("operation still %s", stored.Status)
+		}
+	}
+
+	h := NewOperationHandler(st, ops)
+	r := gin.New()
+	r.GET("/operations/:id", h.GetOperation)
+
+	tests := []struct {
+		name         string
+		userID       string
+		wantStatus   int
+		wantPassword bool
+	}{
+		{"other user", "u2", http.StatusNotFound, false},
+		{"first read", "u1", http.StatusOK, true},
+		{"second read", "u1", http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/operations/"+op.ID+"?userId="+tt.userID, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := strings.Contains(w.Body.String(), "hunter2"); got != tt.wantPassword {
+				t.Errorf("password in %s = %v, want %v", w.Body.String(), got, tt.wantPassword)
+			}
+		})
+	}
+}
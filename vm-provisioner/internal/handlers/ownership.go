@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"vm-provisioner/internal/auth"
+	"vm-provisioner/internal/logging"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// actingUser returns the user a calling service acts for, taken from the
+// userId query parameter. Admin keys may omit it to reach every user's
+// resources; everyone else must name a user. On failure the response is
+// written and ok is false.
+func actingUser(c *gin.Context) (userID string, ok bool) {
+	userID = c.Query("userId")
+	if userID == "" {
+		if key := auth.Caller(c); key != nil && key.HasScope(models.ScopeAdmin) {
+			return "", true
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userId query parameter is required"})
+		return "", false
+	}
+	return userID, true
+}
+
+// owns reports whether userID may access a resource owned by owner. An empty
+// userID is an admin acting for everyone.
+func owns(userID, owner string) bool {
+	return userID == "" || userID == owner
+}
+
+// ownedVM loads a stored VM the acting user owns. Foreign VMs are reported
+// exactly like unknown ones so callers cannot probe for other users' IDs.
+func (h *VMHandler) ownedVM(c *gin.Context, id string) (*models.VMRecord, bool) {
+	c.Request = c.Request.WithContext(logging.With(c.Request.Context(), "vm_id", id))
+
+	userID, ok := actingUser(c)
+	if !ok {
+		return nil, false
+	}
+
+	record, err := h.store.GetVM(c.Request.Context(), id)
+	if err == nil && !owns(userID, record.UserID) {
+		err = fmt.Errorf("vm %s: %w", id, store.ErrNotFound)
+	}
+	if err != nil {
+		respondStoreError(c, err)
+		return nil, false
+	}
+	return record, true
+}
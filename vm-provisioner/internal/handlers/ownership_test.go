@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"vm-provisioner/internal/auth"
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOwnedVM(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	st := newTestStore(t)
+	vm := &models.VMRecord{ID: "vm-1", Provider: "aws", Region: "us-east-1", UserID: "u1", Name: "vm", Status: "running"}
+	if err := st.CreateVM(context.Background(), vm); err != nil {
+		t.Fatalf("create vm: %v", err)
+	}
+
+	h := &VMHandler{store: st}
+	authenticate := auth.New(st, config.AuthConfig{AdminKey: "admin-key"}).Authenticate()
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		// Only admin requests carry credentials
+		if c.GetHeader("Authorization") != "" {
+			authenticate(c)
+		}
+	})
+	r.GET("/vm/:id", func(c *gin.Context) {
+		if _, ok := h.ownedVM(c, c.Param("id")); ok {
+			c.Status(http.StatusOK)
+		}
+	})
+
+	tests := []struct {
+		name       string
+		admin      bool
+		target     string
+		wantStatus int
+	}{
+		{"owner", false, "/vm/vm-1?userId=u1", http.StatusOK},
+		{"other user sees no VM", false, "/vm/vm-1?userId=u2", http.StatusNotFound},
+		{"unknown VM", false, "/vm/vm-2?userId=u1", http.StatusNotFound},
+		{"no user", false, "/vm/vm-1", http.StatusBadRequest},
+		{"admin without user", true, "/vm/vm-1", http.StatusOK},
+		{"admin acting for another user", true, "/vm/vm-1?userId=u2", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.admin {
+				req.Header.Set("Authorization", "Bearer admin-key")
+			}
+			r.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"vm-provisioner/internal/logging"
+	"vm-provisioner/internal/metrics"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/operations"
+
+	"github.com/gin-gonic/gin"
+)
+
+// placement is an acceptable place for a VM, resolved to its provider.
+type placement struct {
+	option   models.PlacementOption
+	provider models.CloudProvider
+}
+
+func (p placement) String() string {
+	parts := []string{p.option.Provider, p.option.Region}
+	if p.option.AvailabilityZone != "" {
+		parts = append(parts, p.option.AvailabilityZone)
+	}
+	return strings.Join(append(parts, p.option.InstanceType), "/")
+}
+
+// resolvePlacements returns the requested placement followed by the
+// fallbacks of req.Placement, each validated against its provider. On
+// failure the response is written and ok is false.
+func (h *VMHandler) resolvePlacements(c *gin.Context, req *models.VMRequest) (placements []placement, ok bool) {
+	options := []models.PlacementOption{{
+		Provider:         req.Provider,
+		Region:           req.Region,
+		AvailabilityZone: req.AvailabilityZone,
+		InstanceType:     req.InstanceType,
+	}}
+	for _, option := range req.Placement {
+		// A zone only makes sense within its own region, so it is never inherited
+		if option.Provider == "" {
+			option.Provider = req.Provider
+		}
+		if option.Region == "" {
+			option.Region = req.Region
+		}
+		if option.InstanceType == "" {
+			option.InstanceType = req.InstanceType
+		}
+		options = append(options, option)
+	}
+
+	gpu := false
+	for i, option := range options {
+		provider, ok := h.getProvider(c, option.Provider)
+		if !ok {
+			return nil, false
+		}
+		if !provider.SupportsInstanceType(option.InstanceType) {
+			msg := fmt.Sprintf("instance type %s not supported by provider %s", option.InstanceType, option.Provider)
+			if i > 0 {
+				msg = fmt.Sprintf("placement %d: %s", i, msg)
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return nil, false
+		}
+
+		// Fallbacks that cannot give the VM what was asked for are skipped
+		if i == 0 {
+			gpu = provider.IsGPUInstanceType(option.InstanceType)
+		}
+		p := placement{option: option, provider: provider}
+		if missing := missingCapability(h.providers.Capabilities(option.Provider), p, req, gpu); missing != "" {
+			if i == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": missing})
+				return nil, false
+			}
+			logging.FromContext(c.Request.Context()).Info("Skipping placement", "placement", p.String(), "reason", missing)
+			continue
+		}
+		placements = append(placements, p)
+	}
+	return placements, true
+}
+
+// missingCapability says what p lacks to create the VM of req, or returns ""
+// when it can. gpu is whether the requested instance type has a GPU, which
+// fallbacks must keep.
+func missingCapability(capabilities models.ProviderCapabilities, p placement, req *models.VMRequest, gpu bool) string {
+	switch {
+	case req.UseSpotInstance && !capabilities.Spot:
+		return fmt.Sprintf("provider %s does not support spot instances", p.option.Provider)
+	case gpu && !capabilities.GPU:
+		return fmt.Sprintf("provider %s does not support GPU instances", p.option.Provider)
+	case gpu && !p.provider.IsGPUInstanceType(p.option.InstanceType):
+		return fmt.Sprintf("placement %s has no GPU", p)
+	}
+	return ""
+}
+
+// place creates the VM in the first placement with capacity. Only capacity
+// errors move on to the next placement; anything else fails the create.
+// Each attempt gets the full create timeout, so a slow first placement does
+// not eat into the time of the fallbacks.
+func (h *VMHandler) place(ctx context.Context, placements []placement, req models.VMRequest) (*models.VMResponse, error) {
+	var attempts []models.PlacementAttempt
+	for i, p := range placements {
+		attemptReq := req
+		attemptReq.Provider = p.option.Provider
+		attemptReq.Region = p.option.Region
+		attemptReq.AvailabilityZone = p.option.AvailabilityZone
+		attemptReq.InstanceType = p.option.InstanceType
+		if req.ClientToken != "" && i > 0 {
+			// EC2 rejects a token reused with different parameters
+			attemptReq.ClientToken = clientToken(req.ClientToken, strconv.Itoa(i))
+		}
+
+		operations.ReportProgress(ctx, fmt.Sprintf("creating VM at %s (placement %d of %d)", p, i+1, len(placements)))
+		start := time.Now()
+		attemptCtx, cancel := context.WithTimeout(ctx, h.timeouts.Create)
+		response, err := p.provider.CreateVM(attemptCtx, &attemptReq)
+		cancel()
+		metrics.ObserveVMOperation("create", attemptReq.Provider, attemptReq.Region, attemptReq.InstanceType, start, err)
+		if err == nil {
+			if len(placements) > 1 {
+				response.Placement = &models.PlacementReport{
+					Chosen:   p.option,
+					Reason:   placementReason(i, attempts),
+					Attempts: append(attempts, models.PlacementAttempt{PlacementOption: p.option}),
+				}
+			}
+			return response, nil
+		}
+
+		attempts = append(attempts, models.PlacementAttempt{PlacementOption: p.option, Error: err.Error()})
+		if !errors.Is(err, models.ErrInsufficientCapacity) {
+			return nil, err
+		}
+		logging.FromContext(ctx).Warn("No capacity, trying next placement", "placement", p.String(), "error", err)
+	}
+
+	return nil, fmt.Errorf("no capacity in any of %d acceptable placements: %w", len(placements), models.ErrInsufficientCapacity)
+}
+
+func placementReason(chosen int, failed []models.PlacementAttempt) string {
+	if chosen == 0 {
+		return "requested placement had capacity"
+	}
+	tried := make([]string, len(failed))
+	for i, attempt := range failed {
+		tried[i] = placement{option: attempt.PlacementOption}.String()
+	}
+	return fmt.Sprintf("fallback %d: insufficient capacity at %s", chosen, strings.Join(tried, ", "))
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/providers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeProvider creates VMs by returning the error configured for the
+// region, recording every attempt. Other methods are not implemented.
+type fakeProvider struct {
+	models.CloudProvider
+	errs     map[string]error
+	attempts *[]models.VMRequest
+}
+
+func (p fakeProvider) CreateVM(ctx context.Context, req *models.VMRequest) (*models.VMResponse, error) {
+	*p.attempts = append(*p.attempts, *req)
+	if err := p.errs[req.Region]; err != nil {
+		return nil, err
+	}
+	return &models.VMResponse{ID: "vm-" + req.Region, Provider: req.Provider, Region: req.Region}, nil
+}
+
+func TestPlace(t *testing.T) {
+	noCapacity := fmt.Errorf("region full: %w", models.ErrInsufficientCapacity)
+	quota := errors.New("quota exceeded")
+
+	tests := []struct {
+		name         string
+		errs         map[string]error
+		wantRegion   string   // empty when the create fails
+		wantErr      error    // matched with errors.Is when set
+		wantAttempts []string // regions tried, in order
+	}{
+		{
+			name:         "requested placement has capacity",
+			wantRegion:   "eu-1",
+			wantAttempts: []string{"eu-1"},
+		},
+		{
+			name:         "falls back in order",
+			errs:         map[string]error{"eu-1": noCapacity, "eu-2": noCapacity},
+			wantRegion:   "us-1",
+			wantAttempts: []string{"eu-1", "eu-2", "us-1"},
+		},
+		{
+			name:         "other errors stop the fallback",
+			errs:         map[string]error{"eu-1": noCapacity, "eu-2": quota},
+			wantErr:      quota,
+			wantAttempts: []string{"eu-1", "eu-2"},
+		},
+		{
+			name:         "no capacity anywhere",
+			errs:         map[string]error{"eu-1": noCapacity, "eu-2": noCapacity, "us-1": noCapacity},
+			wantErr:      models.ErrInsufficientCapacity,
+			wantAttempts: []string{"eu-1", "eu-2", "us-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts []models.VMRequest
+			provider := fakeProvider{errs: tt.errs, attempts: &attempts}
+			var placements []placement
+			for _, region := range []string{"eu-1", "eu-2", "us-1"} {
+				placements = append(placements, placement{
+					option:   models.PlacementOption{Provider: "fake", Region: region, InstanceType: "small"},
+					provider: provider,
+				})
+			}
+
+			h := &VMHandler{timeouts: config.TimeoutConfig{Create: time.Minute}}
+			response, err := h.place(context.Background(), placements, models.VMRequest{Name: "vm", ClientToken: "token"})
+
+			var regions []string
+			for i, req := range attempts {
+				regions = append(regions, req.Region)
+				// Each placement needs its own EC2 client token
+				if wantToken := i == 0; (req.ClientToken == "token") != wantToken {
+					t.Errorf("attempt %d used client token %q", i, req.ClientToken)
+				}
+			}
+			if !reflect.DeepEqual(regions, tt.wantAttempts) {
+				t.Errorf("attempts = %v, want %v", regions, tt.wantAttempts)
+			}
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("place: %v", err)
+			}
+			if response.Region != tt.wantRegion {
+				t.Errorf("region = %s, want %s", response.Region, tt.wantRegion)
+			}
+			report := response.Placement
+			if report == nil || report.Chosen.Region != tt.wantRegion || len(report.Attempts) != len(tt.wantAttempts) {
+				t.Errorf("placement report = %+v, want %s chosen after %d attempts", report, tt.wantRegion, len(tt.wantAttempts))
+			}
+		})
+	}
+}
+
+// deadlineProvider records how long each create attempt was given and has
+// no capacity anywhere. Other methods are not implemented.
+type deadlineProvider struct {
+	models.CloudProvider
+	budgets *[]time.Duration
+}
+
+func (p deadlineProvider) CreateVM(ctx context.Context, req *models.VMRequest) (*models.VMResponse, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil, errors.New("attempt has no deadline")
+	}
+	*p.budgets = append(*p.budgets, time.Until(deadline))
+	time.Sleep(20 * time.Millisecond)
+	return nil, models.ErrInsufficientCapacity
+}
+
+func TestPlaceTimesOutEachAttempt(t *testing.T) {
+	var budgets []time.Duration
+	var placements []placement
+	for _, region := range []string{"eu-1", "eu-2", "us-1"} {
+		placements = append(placements, placement{
+			option:   models.PlacementOption{Provider: "fake", Region: region, InstanceType: "small"},
+			provider: deadlineProvider{budgets: &budgets},
+		})
+	}
+
+	h := &VMHandler{timeouts: config.TimeoutConfig{Create: time.Minute}}
+	if _, err := h.place(context.Background(), placements, models.VMRequest{Name: "vm"}); !errors.Is(err, models.ErrInsufficientCapacity) {
+		t.Fatalf("place = %v, want ErrInsufficientCapacity", err)
+	}
+	if len(budgets) != len(placements) {
+		t.Fatalf("attempts = %d, want %d", len(budgets), len(placements))
+	}
+	for i, budget := range budgets {
+		// Earlier attempts must not have used up any of the timeout
+		if budget < time.Minute-10*time.Millisecond {
+			t.Errorf("attempt %d got %v, want the full create timeout", i, budget)
+		}
+	}
+}
+
+func TestPlacementReason(t *testing.T) {
+	failed := []models.PlacementAttempt{
+		{PlacementOption: models.PlacementOption{Provider: "aws", Region: "eu-west-1", AvailabilityZone: "eu-west-1a", InstanceType: "t3.micro"}},
+		{PlacementOption: models.PlacementOption{Provider: "hetzner", Region: "fsn1", InstanceType: "cx22"}},
+	}
+
+	tests := []struct {
+		name   string
+		chosen int
+		failed []models.PlacementAttempt
+		want   string
+	}{
+		{"requested placement", 0, nil, "requested placement had capacity"},
+		{"first fallback", 1, failed[:1], "fallback 1: insufficient capacity at aws/eu-west-1/eu-west-1a/t3.micro"},
+		{"second fallback", 2, failed, "fallback 2: insufficient capacity at aws/eu-west-1/eu-west-1a/t3.micro, hetzner/fsn1/cx22"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := placementReason(tt.chosen, tt.failed); got != tt.want {
+				t.Errorf("placementReason = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// typedProvider offers the instance types "small" and "gpu", the latter with
+// a GPU if the provider has any. Other methods are not implemented.
+type typedProvider struct {
+	models.CloudProvider
+	gpus bool
+}
+
+func (p typedProvider) SupportsInstanceType(instanceType string) bool {
+	return instanceType == "small" || instanceType == "gpu"
+}
+
+func (p typedProvider) IsGPUInstanceType(instanceType string) bool {
+	return p.gpus && instanceType == "gpu"
+}
+
+func init() {
+	providers.Register("test-spot-gpu", models.ProviderCapabilities{Spot: true, GPU: true},
+		func(cfg *config.Config) (models.CloudProvider, error) { return typedProvider{gpus: true}, nil })
+	providers.Register("test-plain", models.ProviderCapabilities{},
+		func(cfg *config.Config) (models.CloudProvider, error) { return typedProvider{}, nil })
+}
+
+func TestResolvePlacementsCapabilities(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	registry := providers.NewRegistry(&config.Config{Providers: config.ProvidersConfig{Enabled: []string{"test-spot-gpu", "test-plain"}}})
+	h := &VMHandler{providers: registry}
+
+	fallbacks := []models.PlacementOption{
+		{Provider: "test-plain", InstanceType: "small"},
+		{Provider: "test-spot-gpu", Region: "eu-2", InstanceType: "small"},
+		{Provider: "test-spot-gpu", Region: "eu-3"},
+	}
+	tests := []struct {
+		name       string
+		req        models.VMRequest
+		wantStatus int      // 0 when the placements resolve
+		wantPlaced []string // regions kept, in order
+	}{
+		{
+			name:       "no requirements",
+			req:        models.VMRequest{Provider: "test-spot-gpu", Region: "eu-1", InstanceType: "small", Placement: fallbacks},
+			wantPlaced: []string{"eu-1", "eu-1", "eu-2", "eu-3"},
+		},
+		{
+			name:       "spot skips providers without a spot market",
+			req:        models.VMRequest{Provider: "test-spot-gpu", Region: "eu-1", InstanceType: "small", UseSpotInstance: true, Placement: fallbacks},
+			wantPlaced: []string{"eu-1", "eu-2", "eu-3"},
+		},
+		{
+			name:       "GPU skips placements without one",
+			req:        models.VMRequest{Provider: "test-spot-gpu", Region: "eu-1", InstanceType: "gpu", Placement: fallbacks},
+			wantPlaced: []string{"eu-1", "eu-3"},
+		},
+		{
+			name:       "spot request at a provider without spot",
+			req:        models.VMRequest{Provider: "test-plain", Region: "eu-1", InstanceType: "small", UseSpotInstance: true, ReplaceOnInterruption: true},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/vm/create", nil)
+
+			placements, ok := h.resolvePlacements(c, &tt.req)
+			if tt.wantStatus != 0 {
+				if ok || w.Code != tt.wantStatus {
+					t.Fatalf("resolved = %v with status %d, want status %d", ok, w.Code, tt.wantStatus)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+			}
+			var regions []string
+			for _, p := range placements {
+				regions = append(regions, p.option.Region)
+			}
+			if !reflect.DeepEqual(regions, tt.wantPlaced) {
+				t.Errorf("placements = %v, want %v", regions, tt.wantPlaced)
+			}
+		})
+	}
+}
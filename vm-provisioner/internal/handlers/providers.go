@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"net/http"
+
+	"vm-provisioner/internal/providers"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ProviderHandler struct {
+	registry *providers.Registry
+}
+
+func NewProviderHandler(registry *providers.Registry) *ProviderHandler {
+	return &ProviderHandler{registry: registry}
+}
+
+// ListProviders reports every registered provider with its status and
+// capabilities.
+func (h *ProviderHandler) ListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": h.registry.List()})
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"net/http"
+
+	"vm-provisioner/internal/reconciler"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReconcileHandler struct {
+	reconciler *reconciler.Reconciler
+}
+
+func NewReconcileHandler(r *reconciler.Reconciler) *ReconcileHandler {
+	return &ReconcileHandler{reconciler: r}
+}
+
+// GetReport returns the result of the last periodic reconciliation pass.
+func (h *ReconcileHandler) GetReport(c *gin.Context) {
+	report := h.reconciler.LastReport()
+	if report == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no reconciliation has run yet"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// DryRun diffs every provider against the store right now without changing
+// anything, so operators can preview what the next pass would do.
+func (h *ReconcileHandler) DryRun(c *gin.Context) {
+	c.JSON(http.StatusOK, h.reconciler.Reconcile(c.Request.Context(), true))
+}
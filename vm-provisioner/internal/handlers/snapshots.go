@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/logging"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/operations"
+	"vm-provisioner/internal/providers"
+	"vm-provisioner/internal/retention"
+	"vm-provisioner/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SnapshotHandler struct {
+	providers *providers.Registry
+	store     *store.Store
+	ops       *operations.Manager
+	cfg       config.SnapshotConfig
+	timeouts  config.TimeoutConfig
+}
+
+func NewSnapshotHandler(registry *providers.Registry, st *store.Store, ops *operations.Manager, cfg *config.Config) *SnapshotHandler {
+	return &SnapshotHandler{
+		providers: registry,
+		store:     st,
+		ops:       ops,
+		cfg:       cfg.Snapshots,
+		timeouts:  cfg.Timeouts,
+	}
+}
+
+// SnapshotPolicyRequest sets a user's snapshot retention; zero disables a limit
+type SnapshotPolicyRequest struct {
+	KeepLast   int `json:"keepLast" binding:"min=0"`
+	MaxAgeDays int `json:"maxAgeDays" binding:"min=0"`
+}
+
+// CreateSnapshot captures a VM as a snapshot new VMs can be created from.
+func (h *SnapshotHandler) CreateSnapshot(c *gin.Context) {
+	var req models.SnapshotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+	vm, err := h.store.GetVM(c.Request.Context(), c.Param("id"))
+	if err == nil && !owns(userID, vm.UserID) {
+		err = fmt.Errorf("vm %s: %w", c.Param("id"), store.ErrNotFound)
+	}
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	if vm.DeletedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("vm %s is terminated", vm.ID)})
+		return
+	}
+	if !h.providers.Capabilities(vm.Provider).Snapshots {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("provider %s does not support snapshots", vm.Provider)})
+		return
+	}
+	provider, ok := lookupProvider(c, h.providers, vm.Provider)
+	if !ok {
+		return
+	}
+	req.UserID = vm.UserID
+	req.SSHUsername = vm.SSHUsername
+
+	ctx := logging.With(c.Request.Context(), "vm_id", vm.ID)
+	c.Request = c.Request.WithContext(ctx)
+	logging.FromContext(ctx).Info("Snapshotting VM", "name", req.Name)
+
+	op := models.Operation{Type: "vm.snapshot", VMID: vm.ID, UserID: vm.UserID}
+	submitted, err := h.ops.Submit(ctx, op, h.cfg.Timeout,
+		func(ctx context.Context) (any, error) {
+			snapshot, err := provider.CreateSnapshot(ctx, vm.Region, vm.ID, &req)
+			if err != nil {
+				return nil, err
+			}
+			logger := logging.FromContext(ctx).With("snapshot_id", snapshot.ID)
+
+			// The snapshot exists and is billing from here on
+			storeCtx := context.WithoutCancel(ctx)
+			if err := h.store.CreateSnapshot(storeCtx, snapshot); err != nil {
+				logger.Error("Failed to record snapshot in store", "error", err)
+			}
+
+			operations.ReportProgress(ctx, "waiting for snapshot "+snapshot.ID)
+			if err := provider.WaitForSnapshot(ctx, snapshot.Region, snapshot.ID); err != nil {
+				if err := h.store.SetSnapshotStatus(storeCtx, snapshot.ID, models.SnapshotFailed); err != nil {
+					logger.Error("Failed to record snapshot status", "error", err)
+				}
+				return nil, err
+			}
+
+			snapshot.Status = models.SnapshotAvailable
+			if err := h.store.SetSnapshotStatus(storeCtx, snapshot.ID, snapshot.Status); err != nil {
+				logger.Error("Failed to record snapshot status", "error", err)
+			}
+
+			logger.Info("Snapshot available")
+			return snapshot, nil
+		})
+	if err != nil {
+		respondSubmitError(c, err)
+		return
+	}
+
+	respondAccepted(c, submitted)
+}
+
+func (h *SnapshotHandler) ListSnapshots(c *gin.Context) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
+	snapshots, err := h.store.ListSnapshots(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if snapshots == nil {
+		snapshots = []models.Snapshot{}
+	}
+	c.JSON(http.StatusOK, gin.H{"snapshots": snapshots})
+}
+
+func (h *SnapshotHandler) GetSnapshot(c *gin.Context) {
+	snapshot, ok := h.ownedSnapshot(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, snapshot)
+}
+
+func (h *SnapshotHandler) DeleteSnapshot(c *gin.Context) {
+	snapshot, ok := h.ownedSnapshot(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	provider, ok := lookupProvider(c, h.providers, snapshot.Provider)
+	if !ok {
+		return
+	}
+
+	ctx := logging.With(c.Request.Context(), "snapshot_id", snapshot.ID)
+	c.Request = c.Request.WithContext(ctx)
+	logging.FromContext(ctx).Info("Deleting snapshot", "region", snapshot.Region)
+
+	op, err := h.ops.Submit(ctx, models.Operation{Type: "snapshot.delete", UserID: snapshot.UserID}, h.timeouts.Delete,
+		func(ctx context.Context) (any, error) {
+			logger := logging.FromContext(ctx)
+			err := provider.DeleteSnapshot(ctx, snapshot.Region, snapshot.ID)
+			if err != nil && !errors.Is(err, models.ErrSnapshotNotFound) {
+				return nil, err
+			}
+
+			if err := h.store.MarkSnapshotDeleted(context.WithoutCancel(ctx), snapshot.ID); err != nil {
+				logger.Error("Failed to record deletion of snapshot", "error", err)
+			}
+
+			logger.Info("Snapshot deleted")
+			return gin.H{"message": "Snapshot deleted successfully"}, nil
+		})
+	if err != nil {
+		respondSubmitError(c, err)
+		return
+	}
+
+	respondAccepted(c, op)
+}
+
+// GetSnapshotPolicy returns the retention policy that applies to a user,
+// their own or the default.
+func (h *SnapshotHandler) GetSnapshotPolicy(c *gin.Context) {
+	userID := c.Query("userId")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userId query parameter is required"})
+		return
+	}
+
+	policy, err := retention.PolicyFor(c.Request.Context(), h.store, h.cfg, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// SetSnapshotPolicy replaces a user's retention policy. It is enforced on
+// the next collector pass.
+func (h *SnapshotHandler) SetSnapshotPolicy(c *gin.Context) {
+	userID := c.Query("userId")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userId query parameter is required"})
+		return
+	}
+
+	var req SnapshotPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy := &models.SnapshotPolicy{UserID: userID, KeepLast: req.KeepLast, MaxAgeDays: req.MaxAgeDays}
+	if err := h.store.SetSnapshotPolicy(c.Request.Context(), policy); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logging.FromContext(c.Request.Context()).Info("Set snapshot policy", "keep_last", policy.KeepLast, "max_age_days", policy.MaxAgeDays)
+	c.JSON(http.StatusOK, policy)
+}
+
+// ownedSnapshot loads a snapshot the acting user owns. Foreign snapshots are
+// reported exactly like unknown ones.
+func (h *SnapshotHandler) ownedSnapshot(c *gin.Context, id string) (*models.Snapshot, bool) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return nil, false
+	}
+
+	snapshot, err := h.store.GetSnapshot(c.Request.Context(), id)
+	if err == nil && !owns(userID, snapshot.UserID) {
+		err = fmt.Errorf("snapshot %s: %w", id, store.ErrNotFound)
+	}
+	if err != nil {
+		respondStoreError(c, err)
+		return nil, false
+	}
+	return snapshot, true
+}
+
+// resolveSnapshot recognizes a snapshot passed as the image of a create
+// request. Snapshots of other users are refused instead of booted, and every
+// placement must be able to boot it. The login user of the snapshotted VM
+// is carried over unless the request names one. On failure the response is
+// written and ok is false.
+func (h *VMHandler) resolveSnapshot(c *gin.Context, req *models.VMRequest, placements []placement) bool {
+	if req.Image == "" {
+		return true
+	}
+
+	snapshot, err := h.store.GetSnapshot(c.Request.Context(), req.Image)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return true // a provider image
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	case snapshot.UserID != req.UserID:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("snapshot %s: %v", req.Image, store.ErrNotFound)})
+		return false
+	case snapshot.Status != models.SnapshotAvailable:
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("snapshot %s is %s", snapshot.ID, snapshot.Status)})
+		return false
+	}
+
+	for _, p := range placements {
+		if p.option.Provider != snapshot.Provider || (snapshot.Region != "" && p.option.Region != snapshot.Region) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("placement %s cannot boot snapshot %s of %s %s",
+				p, snapshot.ID, snapshot.Provider, snapshot.Region)})
+			return false
+		}
+	}
+
+	if req.SSHUsername == "" {
+		req.SSHUsername = snapshot.SSHUsername
+	}
+	return true
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"vm-provisioner/internal/logging"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/store"
+	"vm-provisioner/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SSHKeyHandler struct {
+	store *store.Store
+}
+
+func NewSSHKeyHandler(st *store.Store) *SSHKeyHandler {
+	return &SSHKeyHandler{store: st}
+}
+
+// CreateSSHKeyRequest registers a public key for a user
+type CreateSSHKeyRequest struct {
+	UserID    string `json:"userId" binding:"required"`
+	Name      string `json:"name" binding:"required"`
+	PublicKey string `json:"publicKey" binding:"required"`
+}
+
+func (h *SSHKeyHandler) CreateSSHKey(c *gin.Context) {
+	var req CreateSSHKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	publicKey, fingerprint, err := utils.ParseSSHPublicKey(req.PublicKey)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key := &models.SSHKey{
+		ID:          utils.GenerateID("key"),
+		UserID:      req.UserID,
+		Name:        req.Name,
+		PublicKey:   publicKey,
+		Fingerprint: fingerprint,
+	}
+	if err := h.store.CreateSSHKey(c.Request.Context(), key); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	logging.FromContext(c.Request.Context()).Info("Registered SSH key", "key_id", key.ID, "fingerprint", key.Fingerprint, "user_id", key.UserID)
+	c.JSON(http.StatusCreated, key)
+}
+
+func (h *SSHKeyHandler) ListSSHKeys(c *gin.Context) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
+	keys, err := h.store.ListSSHKeys(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if keys == nil {
+		keys = []models.SSHKey{}
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+func (h *SSHKeyHandler) DeleteSSHKey(c *gin.Context) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
+	// Foreign keys are reported exactly like unknown ones
+	key, err := h.store.GetSSHKey(c.Request.Context(), c.Param("id"))
+	if err == nil && !owns(userID, key.UserID) {
+		err = fmt.Errorf("SSH key %s: %w", key.ID, store.ErrNotFound)
+	}
+	if err == nil {
+		err = h.store.DeleteSSHKey(c.Request.Context(), key.UserID, key.ID)
+	}
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "SSH key deleted successfully"})
+}
+
+// resolveSSHKeys validates the inline keys of a VM request, merges in the
+// referenced registered keys, and rewrites req.SSHPublicKeys to the final,
+// normalized list. Without any explicit keys, all keys registered for the
+// user are used. It returns the fingerprints of the installed keys.
+func resolveSSHKeys(c *gin.Context, st *store.Store, req *models.VMRequest) ([]string, error) {
+	seen := map[string]bool{}
+	var keys, fingerprints []string
+	add := func(key, fingerprint string) {
+		if !seen[fingerprint] {
+			seen[fingerprint] = true
+			keys = append(keys, key)
+			fingerprints = append(fingerprints, fingerprint)
+		}
+	}
+
+	for _, raw := range req.SSHPublicKeys {
+		key, fingerprint, err := utils.ParseSSHPublicKey(raw)
+		if err != nil {
+			return nil, err
+		}
+		add(key, fingerprint)
+	}
+
+	if len(req.SSHKeyIDs) > 0 || len(req.SSHPublicKeys) == 0 {
+		// A key named twice is still only one registered key
+		var ids []string
+		for _, id := range req.SSHKeyIDs {
+			if !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+		registered, err := st.ListSSHKeys(c.Request.Context(), req.UserID, ids...)
+		if err != nil {
+			return nil, err
+		}
+		if len(registered) < len(ids) {
+			return nil, fmt.Errorf("unknown SSH key ID for user %s", req.UserID)
+		}
+		for _, k := range registered {
+			add(k.PublicKey, k.Fingerprint)
+		}
+	}
+
+	if len(keys) == 0 && !req.EnablePasswordAuth {
+		return nil, fmt.Errorf("at least one SSH public key is required unless enablePasswordAuth is set")
+	}
+
+	req.SSHPublicKeys = keys
+	return fingerprints, nil
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"vm-provisioner/internal/auth"
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestKeys registers key_a and key_b for u1 and key_c for u2.
+func newTestKeys(t *testing.T) *store.Store {
+	t.Helper()
+	st := newTestStore(t)
+	for _, key := range []models.SSHKey{
+		{ID: "key_a", UserID: "u1", Name: "a", PublicKey: "ssh-ed25519 AAAA a", Fingerprint: "SHA256:a"},
+		{ID: "key_b", UserID: "u1", Name: "b", PublicKey: "ssh-ed25519 AAAA b", Fingerprint: "SHA256:b"},
+		{ID: "key_c", UserID: "u2", Name: "c", PublicKey: "ssh-ed25519 AAAA c", Fingerprint: "SHA256:c"},
+	} {
+		if err := st.CreateSSHKey(context.Background(), &key); err != nil {
+			t.Fatalf("create key: %v", err)
+		}
+	}
+	return st
+}
+
+func TestResolveSSHKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	st := newTestKeys(t)
+
+	tests := []struct {
+		name    string
+		req     models.VMRequest
+		want    []string // fingerprints of the installed keys
+		wantErr bool
+	}{
+		{"every registered key by default", models.VMRequest{UserID: "u1"}, []string{"SHA256:a", "SHA256:b"}, false},
+		{"selected key", models.VMRequest{UserID: "u1", SSHKeyIDs: []string{"key_b"}}, []string{"SHA256:b"}, false},
+		{"key named twice", models.VMRequest{UserID: "u1", SSHKeyIDs: []string{"key_a", "key_a"}}, []string{"SHA256:a"}, false},
+		{"unknown key named twice", models.VMRequest{UserID: "u1", SSHKeyIDs: []string{"key_a", "key_x", "key_x"}}, nil, true},
+		{"key of another user", models.VMRequest{UserID: "u1", SSHKeyIDs: []string{"key_a", "key_c"}}, nil, true},
+		{"no keys without password login", models.VMRequest{UserID: "u3"}, nil, true},
+		{"password login only", models.VMRequest{UserID: "u3", EnablePasswordAuth: true}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/vm/create", nil)
+
+			fingerprints, err := resolveSSHKeys(c, st, &tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(fingerprints, tt.want) {
+				t.Errorf("fingerprints = %v, want %v", fingerprints, tt.want)
+			}
+			if len(tt.req.SSHPublicKeys) != len(tt.want) && !tt.wantErr {
+				t.Errorf("installed keys = %v, want %d", tt.req.SSHPublicKeys, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestSSHKeyOwnership(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	st := newTestKeys(t)
+	h := NewSSHKeyHandler(st)
+	authenticate := auth.New(st, config.AuthConfig{AdminKey: "admin-key"}).Authenticate()
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		// Only admin requests carry credentials
+		if c.GetHeader("Authorization") != "" {
+			authenticate(c)
+		}
+	})
+	r.GET("/ssh-keys", h.ListSSHKeys)
+	r.DELETE("/ssh-keys/:id", h.DeleteSSHKey)
+
+	tests := []struct {
+		name       string
+		admin      bool
+		method     string
+		target     string
+		wantStatus int
+		wantKeys   []string // IDs listed, or of every key left after a delete
+	}{
+		{"list without user", false, http.MethodGet, "/ssh-keys", http.StatusBadRequest, nil},
+		{"list own keys", false, http.MethodGet, "/ssh-keys?userId=u1", http.StatusOK, []string{"key_a", "key_b"}},
+		{"admin lists every key", true, http.MethodGet, "/ssh-keys", http.StatusOK, []string{"key_a", "key_b", "key_c"}},
+		{"delete without user", false, http.MethodDelete, "/ssh-keys/key_a", http.StatusBadRequest, nil},
+		{"delete key of another user", false, http.MethodDelete, "/ssh-keys/key_c?userId=u1", http.StatusNotFound, nil},
+		{"delete unknown key", false, http.MethodDelete, "/ssh-keys/key_x?userId=u1", http.StatusNotFound, nil},
+		{"delete own key", false, http.MethodDelete, "/ssh-keys/key_a?userId=u1", http.StatusOK, []string{"key_b", "key_c"}},
+		{"admin deletes a key of any user", true, http.MethodDelete, "/ssh-keys/key_c", http.StatusOK, []string{"key_b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.admin {
+				req.Header.Set("Authorization", "Bearer admin-key")
+			}
+			r.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d (%s), want %d", w.Code, w.Body.String(), tt.wantStatus)
+			}
+			if tt.wantKeys == nil {
+				return
+			}
+
+			var keys []models.SSHKey
+			if tt.method == http.MethodGet {
+				var body struct{ Keys []models.SSHKey }
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+					t.Fatalf("decode %s: %v", w.Body.String(), err)
+				}
+				keys = body.Keys
+			} else {
+				var err error
+				if keys, err = st.ListSSHKeys(context.Background(), ""); err != nil {
+					t.Fatalf("list keys: %v", err)
+				}
+			}
+			var ids []string
+			for _, key := range keys {
+				ids = append(ids, key.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantKeys) {
+				t.Errorf("keys = %v, want %v", ids, tt.wantKeys)
+			}
+		})
+	}
+}
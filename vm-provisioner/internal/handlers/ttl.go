@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"vm-provisioner/internal/logging"
+	"vm-provisioner/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExtendTTLRequest pushes a VM's auto-termination deadline back
+type ExtendTTLRequest struct {
+	ExtendMinutes int `json:"extendMinutes" binding:"required,min=1"`
+}
+
+// ExtendTTL moves the deadline by the given number of minutes. VMs without a
+// deadline get one counted from now.
+func (h *VMHandler) ExtendTTL(c *gin.Context) {
+	id := c.Param("id")
+
+	var req ExtendTTLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	record, ok := h.ownedVM(c, id)
+	if !ok {
+		return
+	}
+
+	base := time.Now()
+	if record.ExpiresAt != nil && record.ExpiresAt.After(base) {
+		base = *record.ExpiresAt
+	}
+	expiresAt := base.Add(time.Duration(req.ExtendMinutes) * time.Minute)
+
+	if err := h.store.SetVMExpiry(c.Request.Context(), id, &expiresAt); err != nil {
+		respondStoreError(c, err)
+		return
+	}
+
+	logging.FromContext(c.Request.Context()).Info("Extended TTL of VM", "expires_at", expiresAt.Format(time.RFC3339))
+	c.JSON(http.StatusOK, gin.H{"id": id, "expiresAt": expiresAt})
+}
+
+// CancelTTL removes the auto-termination deadline of a VM.
+func (h *VMHandler) CancelTTL(c *gin.Context) {
+	id := c.Param("id")
+
+	if _, ok := h.ownedVM(c, id); !ok {
+		return
+	}
+
+	if err := h.store.SetVMExpiry(c.Request.Context(), id, nil); err != nil {
+		respondStoreError(c, err)
+		return
+	}
+
+	logging.FromContext(c.Request.Context()).Info("Cancelled TTL of VM")
+	c.JSON(http.StatusOK, gin.H{"id": id, "expiresAt": nil})
+}
+
+func respondStoreError(c *gin.Context, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -1,129 +1,409 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
+	"regexp"
+	"time"
 
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/logging"
+	"vm-provisioner/internal/metrics"
 	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/operations"
+	"vm-provisioner/internal/providers"
+	"vm-provisioner/internal/store"
 
 	"github.com/gin-gonic/gin"
 )
 
+// sshUsernamePattern accepts portable Linux user names, which end up in the
+// cloud-init script.
+var sshUsernamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+
+// statusClientClosedRequest is reported when the caller went away before the
+// provider call finished (nginx convention, there is no standard code).
+const statusClientClosedRequest = 499
+
 type VMHandler struct {
-	awsProvider     models.CloudProvider
-	hetznerProvider models.CloudProvider
+	providers      *providers.Registry
+	store          *store.Store
+	ops            *operations.Manager
+	timeouts       config.TimeoutConfig
+	idempotencyTTL time.Duration
 }
 
-func NewVMHandler(aws, hetzner models.CloudProvider) *VMHandler {
+func NewVMHandler(registry *providers.Registry, st *store.Store, ops *operations.Manager, cfg *config.Config) *VMHandler {
 	return &VMHandler{
-		awsProvider:     aws,
-		hetznerProvider: hetzner,
+		providers:      registry,
+		store:          st,
+		ops:            ops,
+		timeouts:       cfg.Timeouts,
+		idempotencyTTL: cfg.Operations.IdempotencyKeyTTL,
 	}
 }
 
-func (h *VMHandler) getProvider(providerName string) models.CloudProvider {
-	switch providerName {
-	case "aws":
-		return h.awsProvider
-	case "hetzner":
-		return h.hetznerProvider
+// getProvider looks a provider up in the registry. On failure the response
+// is written and ok is false.
+func (h *VMHandler) getProvider(c *gin.Context, providerName string) (provider models.CloudProvider, ok bool) {
+	return lookupProvider(c, h.providers, providerName)
+}
+
+func lookupProvider(c *gin.Context, registry *providers.Registry, providerName string) (models.CloudProvider, bool) {
+	provider, err := registry.Get(providerName)
+	switch {
+	case err == nil:
+		return provider, true
+	case errors.Is(err, providers.ErrProviderUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
 	default:
-		return nil
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+	return nil, false
+}
+
+// vmTarget is a VM addressed by a /vm/:id route, resolved to its provider.
+type vmTarget struct {
+	id           string
+	provider     models.CloudProvider
+	providerName string
+	region       string
+	owner        string           // user the VM belongs to, if known
+	record       *models.VMRecord // nil for VMs the store does not know about
+}
+
+// operation returns a new operation of the given type acting on the target.
+func (t vmTarget) operation(opType string) models.Operation {
+	return models.Operation{Type: opType, VMID: t.id, UserID: t.owner}
+}
+
+// resolveVM looks the VM up in the store to find its provider and region.
+// VMs created before the store existed can still be addressed by passing
+// ?provider= (and optionally ?region=); their owner is then checked against
+// the provider's tags. VMs of other users are reported as unknown. On
+// failure the response is written and ok is false.
+func (h *VMHandler) resolveVM(c *gin.Context) (target vmTarget, ok bool) {
+	target.id = c.Param("id")
+	c.Request = c.Request.WithContext(logging.With(c.Request.Context(), "vm_id", target.id))
+	providerName := c.Query("provider")
+	target.region = c.Query("region")
+
+	userID, ok := actingUser(c)
+	if !ok {
+		return target, false
+	}
+
+	record, err := h.store.GetVM(c.Request.Context(), target.id)
+	switch {
+	case err == nil && owns(userID, record.UserID):
+		target.record = record
+		target.owner = record.UserID
+		providerName = record.Provider
+		target.region = record.Region
+	case err == nil || errors.Is(err, store.ErrNotFound):
+		if providerName == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("unknown VM %s; pass the provider query parameter for VMs not created by this provisioner", target.id)})
+			return target, false
+		}
+	default:
+		logging.FromContext(c.Request.Context()).Error("Failed to load VM", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return target, false
+	}
+
+	if target.provider, ok = h.getProvider(c, providerName); !ok {
+		return target, false
+	}
+	target.providerName = providerName
+
+	if target.record == nil && userID != "" {
+		return target, h.verifyOwnerTag(c, &target, userID)
+	}
+	return target, true
+}
+
+// verifyOwnerTag checks the owner tag of a VM the store does not know about,
+// which holds the user ID or, where the provider restricts label values,
+// models.OwnerLabel of it. Untagged and foreign VMs get the same 404 as
+// missing ones.
+func (h *VMHandler) verifyOwnerTag(c *gin.Context, target *vmTarget, userID string) bool {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeouts.Status)
+	defer cancel()
+
+	status, err := target.provider.GetVMStatus(ctx, target.region, target.id)
+	if err == nil && status.UserID != userID && status.UserID != models.OwnerLabel(userID) {
+		err = fmt.Errorf("vm %s: %w", target.id, models.ErrVMNotFound)
 	}
+	if err != nil {
+		respondProviderError(ctx, c, err)
+		return false
+	}
+
+	target.owner = userID
+	target.region = status.Region
+	return true
 }
 
 func (h *VMHandler) CreateVM(c *gin.Context) {
 	var req models.VMRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Printf("❌ Invalid request body: %v", err)
+		logging.FromContext(c.Request.Context()).Warn("Invalid VM request body", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	log.Printf("📝 Received VM request: %+v", req)
+	ctx := logging.With(c.Request.Context(), "user_id", req.UserID)
+	c.Request = c.Request.WithContext(ctx)
+	logger := logging.FromContext(ctx)
+	logger.Debug("Received VM request", "request", req)
 
-	log.Printf("🚀 Creating VM: %s (%s %s in %s)", req.Name, req.Provider, req.InstanceType, req.Region)
+	idempotencyKey := c.GetHeader(idempotencyKeyHeader)
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+		return
+	}
+	hash := requestHash(req)
 
-	// Get the appropriate provider
-	provider := h.getProvider(req.Provider)
-	if provider == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported provider: %s", req.Provider)})
+	if req.SSHUsername != "" && !sshUsernamePattern.MatchString(req.SSHUsername) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid sshUsername %q", req.SSHUsername)})
+		return
+	}
+	if req.ReplaceOnInterruption && !req.UseSpotInstance {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "replaceOnInterruption requires useSpotInstance"})
 		return
 	}
+	if err := validateTags(req.Tags); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	firewall, err := normalizeFirewall(req.Firewall)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Firewall = firewall
 
-	// Validate instance type for provider
-	if !provider.SupportsInstanceType(req.InstanceType) {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": fmt.Sprintf("instance type %s not supported by provider %s", req.InstanceType, req.Provider),
-		})
+	logger.Info("Creating VM", "name", req.Name, "provider", req.Provider, "instance_type", req.InstanceType, "region", req.Region)
+
+	// Resolve the requested placement and its fallbacks to providers
+	placements, ok := h.resolvePlacements(c, &req)
+	if !ok {
+		return
+	}
+
+	// Volumes pin every placement to their region and zone
+	if !h.resolveVolumes(c, &req, placements) {
 		return
 	}
 
-	// Create the VM
-	response, err := provider.CreateVM(&req)
+	// Snapshots boot only where they were taken
+	if !h.resolveSnapshot(c, &req, placements) {
+		return
+	}
+
+	// Resolve the SSH keys to install
+	fingerprints, err := resolveSSHKeys(c, h.store, &req)
 	if err != nil {
-		log.Printf("❌ Failed to create VM: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Deduplicate retries: replay the original outcome, and let EC2 drop a
+	// duplicate RunInstances should two attempts ever reach it.
+	if idempotencyKey != "" {
+		if !h.claimIdempotencyKey(c, req.UserID, idempotencyKey, hash) {
+			return
+		}
+		req.ClientToken = clientToken(req.UserID, idempotencyKey)
+	}
+
+	// Create the VM in the background, leaving every placement its own timeout
+	timeout := h.timeouts.Create * time.Duration(len(placements))
+	op, err := h.ops.Submit(c.Request.Context(), models.Operation{Type: "vm.create", UserID: req.UserID}, timeout,
+		func(ctx context.Context) (any, error) {
+			return h.createVM(ctx, placements, req, fingerprints)
+		})
+	if err != nil {
+		if idempotencyKey != "" {
+			if err := h.store.ReleaseIdempotencyKey(c.Request.Context(), req.UserID, idempotencyKey); err != nil {
+				logger.Error("Failed to release Idempotency-Key", "error", err)
+			}
+		}
+		respondSubmitError(c, err)
 		return
 	}
+	if idempotencyKey != "" {
+		if err := h.store.SetIdempotencyOperation(c.Request.Context(), req.UserID, idempotencyKey, op.ID); err != nil {
+			logger.Error("Failed to link Idempotency-Key to operation", "operation_id", op.ID, "error", err)
+		}
+	}
 
-	log.Printf("✅ VM created successfully: %s (ID: %s, IP: %s)", response.Name, response.ID, response.PublicIP)
-	c.JSON(http.StatusCreated, response)
+	logger.Info("Queued VM creation", "name", req.Name, "operation_id", op.ID)
+	respondAccepted(c, op)
+}
+
+// createVM runs inside a vm.create operation.
+func (h *VMHandler) createVM(ctx context.Context, placements []placement, req models.VMRequest, fingerprints []string) (*models.VMResponse, error) {
+	response, err := h.place(ctx, placements, req)
+	if err != nil {
+		return nil, err // logged as the operation's failure
+	}
+	logger := logging.FromContext(ctx).With("vm_id", response.ID)
+	response.SSHKeyFingerprints = fingerprints
+	operations.LinkVM(ctx, response.ID)
+	operations.ReportProgress(ctx, "recording VM")
+
+	// The VM exists and is billing from here on, so record it even if the
+	// operation has run out of time.
+	record := models.NewVMRecord(&req, response)
+	if err := h.store.CreateVM(context.WithoutCancel(ctx), record); err != nil {
+		logger.Error("Failed to record VM in store", "error", err)
+	}
+	if err := h.store.AttachVolumes(context.WithoutCancel(ctx), response.ID, req.Volumes); err != nil {
+		logger.Error("Failed to record volume attachments", "error", err)
+	}
+	if record.ReplaceOnInterruption {
+		// Replacements launch where this VM ended up, so drop the fallbacks.
+		// The reclaimed zone is the least likely to have spot capacity again,
+		// unless volumes tie the VM to it.
+		relaunch := req
+		relaunch.Provider = response.Provider
+		relaunch.Region = response.Region
+		relaunch.InstanceType = response.InstanceType
+		relaunch.AvailabilityZone = ""
+		if len(req.Volumes) > 0 {
+			relaunch.AvailabilityZone = response.AvailabilityZone
+		}
+		relaunch.Placement = nil
+		if err := h.store.SaveLaunchRequest(context.WithoutCancel(ctx), response.ID, &relaunch); err != nil {
+			logger.Error("Failed to save launch request", "error", err)
+		}
+	}
+
+	logger.Info("VM created", "name", response.Name, "provider", response.Provider, "region", response.Region, "public_ip", response.PublicIP)
+	return response, nil
 }
 
 func (h *VMHandler) DeleteVM(c *gin.Context) {
-	id := c.Param("id")
-	provider := c.Query("provider")
+	target, ok := h.resolveVM(c)
+	if !ok {
+		return
+	}
 
-	if provider == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "provider query parameter is required"})
+	logging.FromContext(c.Request.Context()).Info("Deleting VM", "region", target.region)
+
+	// Delete the VM in the background
+	op, err := h.ops.Submit(c.Request.Context(), target.operation("vm.delete"), h.timeouts.Delete,
+		func(ctx context.Context) (any, error) {
+			logger := logging.FromContext(ctx)
+			instanceType := ""
+			if target.record != nil {
+				instanceType = target.record.InstanceType
+			}
+			start := time.Now()
+			err := target.provider.DeleteVM(ctx, target.region, target.id)
+			metrics.ObserveVMOperation("delete", target.providerName, target.region, instanceType, start, err)
+			if err != nil {
+				return nil, err
+			}
+
+			if target.record != nil {
+				if _, err := h.store.UpdateVMStatus(context.WithoutCancel(ctx), target.id, "terminated", target.record.PublicIP, "deleted via API"); err != nil {
+					logger.Error("Failed to record deletion of VM", "error", err)
+				}
+			}
+
+			logger.Info("VM deleted")
+			return gin.H{"message": "VM deleted successfully"}, nil
+		})
+	if err != nil {
+		respondSubmitError(c, err)
 		return
 	}
 
-	log.Printf("🗑️  Deleting VM: %s (%s)", id, provider)
+	respondAccepted(c, op)
+}
 
-	// Get the appropriate provider
-	cloudProvider := h.getProvider(provider)
-	if cloudProvider == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported provider: %s", provider)})
+func (h *VMHandler) GetVMStatus(c *gin.Context) {
+	target, ok := h.resolveVM(c)
+	if !ok {
 		return
 	}
 
-	// Delete the VM
-	if err := cloudProvider.DeleteVM(id); err != nil {
-		log.Printf("❌ Failed to delete VM: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	// Get VM status
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeouts.Status)
+	defer cancel()
+
+	status, err := target.provider.GetVMStatus(ctx, target.region, target.id)
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to get VM status", "error", err)
+		respondProviderError(ctx, c, err)
 		return
 	}
 
-	log.Printf("✅ VM deleted successfully: %s", id)
-	c.JSON(http.StatusOK, gin.H{"message": "VM deleted successfully"})
+	if target.record != nil {
+		if _, err := h.store.UpdateVMStatus(c.Request.Context(), target.id, status.Status, status.PublicIP, "observed"); err != nil {
+			logging.FromContext(ctx).Error("Failed to record status of VM", "error", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, status)
 }
 
-func (h *VMHandler) GetVMStatus(c *gin.Context) {
+// GetVM returns what the provisioner has recorded about a VM, including its
+// lifecycle history, without calling the cloud provider.
+func (h *VMHandler) GetVM(c *gin.Context) {
 	id := c.Param("id")
-	provider := c.Query("provider")
 
-	if provider == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "provider query parameter is required"})
+	record, ok := h.ownedVM(c, id)
+	if !ok {
 		return
 	}
 
-	// Get the appropriate provider
-	cloudProvider := h.getProvider(provider)
-	if cloudProvider == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported provider: %s", provider)})
+	transitions, err := h.store.ListTransitions(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Get VM status
-	status, err := cloudProvider.GetVMStatus(id)
+	events, err := h.store.ListEvents(c.Request.Context(), id)
 	if err != nil {
-		log.Printf("❌ Failed to get VM status: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, status)
-}
\ No newline at end of file
+	c.JSON(http.StatusOK, gin.H{"vm": record, "transitions": transitions, "events": events})
+}
+
+// respondAccepted answers a mutating request with the queued operation.
+func respondAccepted(c *gin.Context, op *models.Operation) {
+	c.Header("Location", "/operations/"+op.ID)
+	c.JSON(http.StatusAccepted, op)
+}
+
+func respondSubmitError(c *gin.Context, err error) {
+	if errors.Is(err, operations.ErrQueueFull) || errors.Is(err, operations.ErrShuttingDown) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// respondProviderError maps a failed provider call to an HTTP response,
+// distinguishing deadline expiry and client cancellation from cloud errors.
+func respondProviderError(ctx context.Context, c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrVMNotFound) || errors.Is(err, models.ErrVolumeNotFound) || errors.Is(err, models.ErrSnapshotNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrOperationNotSupported):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "provider operation timed out", "details": err.Error()})
+	case errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled):
+		c.JSON(statusClientClosedRequest, gin.H{"error": "request canceled", "details": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRespondProviderError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		err        error
+		wantStatus int
+	}{
+		{"cloud error", context.Background(), errors.New("quota exceeded"), http.StatusInternalServerError},
+		{"deadline", context.Background(), fmt.Errorf("describe: %w", context.DeadlineExceeded), http.StatusGatewayTimeout},
+		{"cloud error after the deadline", expired, errors.New("request send failed"), http.StatusGatewayTimeout},
+		{"client went away", canceled, errors.New("request send failed"), statusClientClosedRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			respondProviderError(tt.ctx, c, tt.err)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
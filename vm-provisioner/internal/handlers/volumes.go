@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/logging"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/operations"
+	"vm-provisioner/internal/providers"
+	"vm-provisioner/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mountPathPattern limits mount paths to plain absolute paths, since they
+// end up in the cloud-init script and /etc/fstab.
+var mountPathPattern = regexp.MustCompile(`^(/[A-Za-z0-9._-]+)+$`)
+
+// mountRoots are where volumes may be mounted. Elsewhere a mount could
+// shadow directories such as /etc, /usr or the SSH user's home and leave
+// the VM unbootable or unreachable.
+var mountRoots = []string{"/mnt", "/data"}
+
+// validMountPath reports whether a volume may be mounted at p.
+func validMountPath(p string) bool {
+	if !mountPathPattern.MatchString(p) || path.Clean(p) != p {
+		return false
+	}
+	for _, root := range mountRoots {
+		if p == root || strings.HasPrefix(p, root+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+type VolumeHandler struct {
+	providers *providers.Registry
+	store     *store.Store
+	ops       *operations.Manager
+	timeouts  config.TimeoutConfig
+}
+
+func NewVolumeHandler(registry *providers.Registry, st *store.Store, ops *operations.Manager, timeouts config.TimeoutConfig) *VolumeHandler {
+	return &VolumeHandler{
+		providers: registry,
+		store:     st,
+		ops:       ops,
+		timeouts:  timeouts,
+	}
+}
+
+// AttachVolumeRequest attaches a volume to a running or stopped VM
+type AttachVolumeRequest struct {
+	VMID string `json:"vmId" binding:"required"`
+}
+
+func (h *VolumeHandler) CreateVolume(c *gin.Context) {
+	var req models.VolumeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	provider, ok := lookupProvider(c, h.providers, req.Provider)
+	if !ok {
+		return
+	}
+
+	ctx := logging.With(c.Request.Context(), "user_id", req.UserID)
+	c.Request = c.Request.WithContext(ctx)
+	logging.FromContext(ctx).Info("Creating volume", "name", req.Name, "size_gib", req.SizeGiB, "provider", req.Provider, "region", req.Region)
+
+	op, err := h.ops.Submit(ctx, models.Operation{Type: "volume.create", UserID: req.UserID}, h.timeouts.Create,
+		func(ctx context.Context) (any, error) {
+			volume, err := provider.CreateVolume(ctx, &req)
+			if err != nil {
+				return nil, err
+			}
+			logger := logging.FromContext(ctx).With("volume_id", volume.ID)
+
+			// The volume exists and is billing from here on
+			if err := h.store.CreateVolume(context.WithoutCancel(ctx), volume); err != nil {
+				logger.Error("Failed to record volume in store", "error", err)
+			}
+
+			logger.Info("Volume created", "name", volume.Name)
+			return volume, nil
+		})
+	if err != nil {
+		respondSubmitError(c, err)
+		return
+	}
+
+	respondAccepted(c, op)
+}
+
+func (h *VolumeHandler) ListVolumes(c *gin.Context) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
+	volumes, err := h.store.ListVolumes(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if volumes == nil {
+		volumes = []models.Volume{}
+	}
+	c.JSON(http.StatusOK, gin.H{"volumes": volumes})
+}
+
+func (h *VolumeHandler) GetVolume(c *gin.Context) {
+	volume, ok := h.ownedVolume(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, volume)
+}
+
+// DeleteVolume destroys a volume and its data. Attached volumes are refused
+// so a running VM never loses a disk it is using.
+func (h *VolumeHandler) DeleteVolume(c *gin.Context) {
+	volume, ok := h.ownedVolume(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if volume.Status == models.VolumeAttached {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("volume %s is attached to VM %s; detach it first", volume.ID, volume.VMID)})
+		return
+	}
+	provider, ok := lookupProvider(c, h.providers, volume.Provider)
+	if !ok {
+		return
+	}
+
+	ctx := logging.With(c.Request.Context(), "volume_id", volume.ID)
+	c.Request = c.Request.WithContext(ctx)
+	logging.FromContext(ctx).Info("Deleting volume", "region", volume.Region)
+
+	op, err := h.ops.Submit(ctx, models.Operation{Type: "volume.delete", UserID: volume.UserID}, h.timeouts.Delete,
+		func(ctx context.Context) (any, error) {
+			logger := logging.FromContext(ctx)
+			err := provider.DeleteVolume(ctx, volume.Region, volume.ID)
+			if err != nil && !errors.Is(err, models.ErrVolumeNotFound) {
+				return nil, err
+			}
+
+			if err := h.store.MarkVolumeDeleted(context.WithoutCancel(ctx), volume.ID); err != nil {
+				logger.Error("Failed to record deletion of volume", "error", err)
+			}
+
+			logger.Info("Volume deleted")
+			return gin.H{"message": "Volume deleted successfully"}, nil
+		})
+	if err != nil {
+		respondSubmitError(c, err)
+		return
+	}
+
+	respondAccepted(c, op)
+}
+
+// AttachVolume attaches a volume to an existing VM of the same user. Unlike
+// volumes attached at creation it is not mounted automatically.
+func (h *VolumeHandler) AttachVolume(c *gin.Context) {
+	var req AttachVolumeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	volume, ok := h.ownedVolume(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if volume.Status == models.VolumeAttached {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("volume %s is already attached to VM %s", volume.ID, volume.VMID)})
+		return
+	}
+
+	vm, err := h.store.GetVM(c.Request.Context(), req.VMID)
+	if err == nil && (vm.UserID != volume.UserID || vm.DeletedAt != nil) {
+		err = fmt.Errorf("vm %s: %w", req.VMID, store.ErrNotFound)
+	}
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	if vm.Provider != volume.Provider || vm.Region != volume.Region {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("volume %s is in %s %s, VM %s in %s %s",
+			volume.ID, volume.Provider, volume.Region, vm.ID, vm.Provider, vm.Region)})
+		return
+	}
+	provider, ok := lookupProvider(c, h.providers, volume.Provider)
+	if !ok {
+		return
+	}
+
+	ctx := logging.With(c.Request.Context(), "volume_id", volume.ID, "vm_id", vm.ID)
+	c.Request = c.Request.WithContext(ctx)
+	logging.FromContext(ctx).Info("Attaching volume")
+
+	op := models.Operation{Type: "volume.attach", VMID: vm.ID, UserID: volume.UserID}
+	submitted, err := h.ops.Submit(ctx, op, h.timeouts.Create,
+		func(ctx context.Context) (any, error) {
+			logger := logging.FromContext(ctx)
+			if err := provider.AttachVolume(ctx, volume.Region, volume.ID, vm.ID); err != nil {
+				return nil, err
+			}
+
+			if err := h.store.SetVolumeAttachment(context.WithoutCancel(ctx), volume.ID, vm.ID, ""); err != nil {
+				logger.Error("Failed to record volume attachment", "error", err)
+			}
+
+			logger.Info("Volume attached")
+			return gin.H{"id": volume.ID, "vmId": vm.ID, "message": "Volume attached"}, nil
+		})
+	if err != nil {
+		respondSubmitError(c, err)
+		return
+	}
+
+	respondAccepted(c, submitted)
+}
+
+// DetachVolume detaches a volume from its VM. Unmount it in the guest first;
+// the provider detaches it regardless.
+func (h *VolumeHandler) DetachVolume(c *gin.Context) {
+	volume, ok := h.ownedVolume(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if volume.Status != models.VolumeAttached {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("volume %s is not attached", volume.ID)})
+		return
+	}
+	provider, ok := lookupProvider(c, h.providers, volume.Provider)
+	if !ok {
+		return
+	}
+
+	ctx := logging.With(c.Request.Context(), "volume_id", volume.ID, "vm_id", volume.VMID)
+	c.Request = c.Request.WithContext(ctx)
+	logging.FromContext(ctx).Info("Detaching volume")
+
+	op := models.Operation{Type: "volume.detach", VMID: volume.VMID, UserID: volume.UserID}
+	submitted, err := h.ops.Submit(ctx, op, h.timeouts.Delete,
+		func(ctx context.Context) (any, error) {
+			logger := logging.FromContext(ctx)
+			if err := provider.DetachVolume(ctx, volume.Region, volume.ID); err != nil {
+				return nil, err
+			}
+
+			if err := h.store.SetVolumeAttachment(context.WithoutCancel(ctx), volume.ID, "", ""); err != nil {
+				logger.Error("Failed to record volume detachment", "error", err)
+			}
+
+			logger.Info("Volume detached")
+			return gin.H{"id": volume.ID, "message": "Volume detached"}, nil
+		})
+	if err != nil {
+		respondSubmitError(c, err)
+		return
+	}
+
+	respondAccepted(c, submitted)
+}
+
+// ownedVolume loads a volume the acting user owns. Foreign volumes are
+// reported exactly like unknown ones.
+func (h *VolumeHandler) ownedVolume(c *gin.Context, id string) (*models.Volume, bool) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return nil, false
+	}
+
+	volume, err := h.store.GetVolume(c.Request.Context(), id)
+	if err == nil && !owns(userID, volume.UserID) {
+		err = fmt.Errorf("volume %s: %w", id, store.ErrNotFound)
+	}
+	if err != nil {
+		respondStoreError(c, err)
+		return nil, false
+	}
+	return volume, true
+}
+
+// resolveVolumes checks that the volumes of a create request belong to the
+// user and are free, defaults their mount paths, and pins every placement
+// to the volumes' region and zone. On failure the response is written and
+// ok is false.
+func (h *VMHandler) resolveVolumes(c *gin.Context, req *models.VMRequest, placements []placement) bool {
+	seen := map[string]bool{}
+	for i := range req.Volumes {
+		mount := &req.Volumes[i]
+		if mount.MountPath == "" {
+			mount.MountPath = "/mnt/" + mount.VolumeID
+		}
+		if !validMountPath(mount.MountPath) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid mount path %q: must be /mnt, /data or below them", mount.MountPath)})
+			return false
+		}
+		if seen[mount.VolumeID] || seen[mount.MountPath] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("volume %s or mount path %s given twice", mount.VolumeID, mount.MountPath)})
+			return false
+		}
+		seen[mount.VolumeID], seen[mount.MountPath] = true, true
+
+		volume, err := h.store.GetVolume(c.Request.Context(), mount.VolumeID)
+		if err == nil && volume.UserID != req.UserID {
+			err = fmt.Errorf("volume %s: %w", mount.VolumeID, store.ErrNotFound)
+		}
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return false
+		}
+		if volume.Status == models.VolumeAttached {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("volume %s is attached to VM %s", volume.ID, volume.VMID)})
+			return false
+		}
+
+		for j := range placements {
+			option := &placements[j].option
+			if option.Provider != volume.Provider || option.Region != volume.Region ||
+				(option.AvailabilityZone != "" && option.AvailabilityZone != volume.AvailabilityZone) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("placement %s cannot reach volume %s in %s %s %s",
+					placements[j], volume.ID, volume.Provider, volume.Region, volume.AvailabilityZone)})
+				return false
+			}
+			option.AvailabilityZone = volume.AvailabilityZone
+		}
+	}
+	return true
+}
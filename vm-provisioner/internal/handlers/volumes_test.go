@@ -0,0 +1,29 @@
+package handlers
+
+import "testing"
+
+func TestValidMountPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/data", true},
+		{"/mnt", true},
+		{"/mnt/vol-0abc", true},
+		{"/data/postgres/main", true},
+		{"/", false},
+		{"/etc", false},
+		{"/home/ubuntu", false},
+		{"/datastore", false},
+		{"/mnt/../etc", false},
+		{"/mnt/vol/", false},
+		{"mnt/vol", false},
+		{"/mnt/my vol", false},
+		{"/mnt/$(reboot)", false},
+	}
+	for _, tt := range tests {
+		if got := validMountPath(tt.path); got != tt.want {
+			t.Errorf("validMountPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"vm-provisioner/internal/logging"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/store"
+	"vm-provisioner/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxDeliveryListLimit = 200
+
+type WebhookHandler struct {
+	store *store.Store
+}
+
+func NewWebhookHandler(st *store.Store) *WebhookHandler {
+	return &WebhookHandler{store: st}
+}
+
+// CreateWebhookRequest subscribes a URL to VM lifecycle events. Without
+// events every event type is delivered; without userId every user's VMs.
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" binding:"required,url"`
+	Events []string `json:"events"`
+	UserID string   `json:"userId"`
+}
+
+// WebhookCredentials is returned once when a webhook is created. Secret
+// keys the signature of every delivery.
+type WebhookCredentials struct {
+	Webhook *models.Webhook `json:"webhook"`
+	Secret  string          `json:"secret"`
+}
+
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url must be an absolute http or https URL"})
+		return
+	}
+	events := req.Events
+	if len(events) == 0 {
+		events = models.WebhookEvents
+	}
+	for _, event := range events {
+		if !slices.Contains(models.WebhookEvents, event) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown event %q; valid events are %v", event, models.WebhookEvents)})
+			return
+		}
+	}
+
+	webhook := &models.Webhook{
+		ID:     utils.GenerateID("wh"),
+		UserID: req.UserID,
+		URL:    req.URL,
+		Events: slices.Compact(slices.Sorted(slices.Values(events))),
+		Secret: utils.GenerateSecret(),
+	}
+	if err := h.store.CreateWebhook(c.Request.Context(), webhook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logging.FromContext(c.Request.Context()).Info("Created webhook", "webhook_id", webhook.ID, "url", webhook.URL, "events", webhook.Events)
+	c.JSON(http.StatusCreated, WebhookCredentials{Webhook: webhook, Secret: webhook.Secret})
+}
+
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	webhooks, err := h.store.ListWebhooks(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if webhooks == nil {
+		webhooks = []models.Webhook{}
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": webhooks})
+}
+
+func (h *WebhookHandler) GetWebhook(c *gin.Context) {
+	webhook, err := h.store.GetWebhook(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, webhook)
+}
+
+// DeleteWebhook stops deliveries to a webhook, including pending retries.
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	if err := h.store.DeleteWebhook(c.Request.Context(), c.Param("id")); err != nil {
+		respondStoreError(c, err)
+		return
+	}
+
+	logging.FromContext(c.Request.Context()).Info("Deleted webhook", "webhook_id", c.Param("id"))
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// ListDeliveries returns the newest deliveries of a webhook; status=dead
+// lists its dead-letter log.
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	webhook, err := h.store.GetWebhook(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+
+	status := c.Query("status")
+	if status != "" && status != models.DeliveryPending && status != models.DeliveryDelivered && status != models.DeliveryDead {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown delivery status %q", status)})
+		return
+	}
+	limit := defaultListLimit
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxDeliveryListLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxDeliveryListLimit)})
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := h.store.ListWebhookDeliveries(c.Request.Context(), webhook.ID, status, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if deliveries == nil {
+		deliveries = []models.WebhookDelivery{}
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+// Redeliver queues a dead delivery again with a fresh set of attempts.
+func (h *WebhookHandler) Redeliver(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("deliveryId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid delivery id"})
+		return
+	}
+
+	delivery, err := h.store.GetWebhookDelivery(c.Request.Context(), id)
+	if err == nil && delivery.WebhookID != c.Param("id") {
+		err = fmt.Errorf("webhook delivery %d: %w", id, store.ErrNotFound)
+	}
+	if err == nil {
+		err = h.store.RedeliverWebhookDelivery(c.Request.Context(), id)
+	}
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+
+	logging.FromContext(c.Request.Context()).Info("Requeued webhook delivery", "webhook_id", c.Param("id"), "delivery_id", id)
+	c.JSON(http.StatusAccepted, gin.H{"message": "Delivery queued"})
+}
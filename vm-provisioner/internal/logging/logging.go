@@ -0,0 +1,55 @@
+// Package logging sets up the structured logger of the provisioner and
+// carries request-scoped loggers, with fields such as the request, VM and
+// user ID, through contexts. Every record passes a redaction layer that
+// masks passwords, tokens and user-data before it is written.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+
+	"vm-provisioner/internal/config"
+)
+
+type contextKey struct{}
+
+// New returns a logger writing text or JSON records at the configured
+// level to stderr.
+func New(cfg config.LogConfig) *slog.Logger {
+	var level slog.Level
+	levelErr := level.UnmarshalText([]byte(cfg.Level))
+
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+	var handler slog.Handler
+	if strings.EqualFold(cfg.Format, "json") {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+
+	logger := slog.New(handler)
+	if levelErr != nil {
+		logger.Warn("Invalid LOG_LEVEL, using info", "level", cfg.Level)
+	}
+	return logger
+}
+
+// WithLogger returns a context carrying logger.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// With returns a context whose logger adds the given fields to every record.
+func With(ctx context.Context, args ...any) context.Context {
+	return WithLogger(ctx, FromContext(ctx).With(args...))
+}
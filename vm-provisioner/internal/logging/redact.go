@@ -0,0 +1,114 @@
+package logging
+
+import (
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces masked values.
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are matched against field names, lowercased and without
+// separators, so "sshPassword", "user_data" and "X-Api-Key" all match.
+var sensitiveKeys = []string{"password", "passwd", "secret", "token", "authorization", "apikey", "userdata", "privatekey", "motd"}
+
+// secretPatterns mask credentials embedded in free text such as messages
+// and error strings.
+var secretPatterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`(?i)\b(bearer)\s+[^\s"',]+`), "$1 " + Redacted},
+	{regexp.MustCompile(`(?i)\b(password|passwd|secret|token|api[_-]?key)(["']?\s*[:=]\s*["']?)[^\s"',&]+`), "$1$2" + Redacted},
+}
+
+// SensitiveKey reports whether values stored under key must be masked.
+func SensitiveKey(key string) bool {
+	k := strings.ToLower(strings.NewReplacer("_", "", "-", "", ".", "", " ", "").Replace(key))
+	for _, s := range sensitiveKeys {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scrub masks credentials embedded in s.
+func Scrub(s string) string {
+	for _, p := range secretPatterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+	return s
+}
+
+// Redact returns a JSON-shaped copy of v with the values of sensitive keys
+// masked, for logging structs, maps and request bodies.
+func Redact(v any) any {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return Redacted
+	}
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return Redacted
+	}
+	return redactJSON(decoded)
+}
+
+func redactJSON(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			// Flags such as enablePasswordAuth reveal nothing
+			if _, flag := value.(bool); SensitiveKey(key) && !flag {
+				v[key] = Redacted
+			} else {
+				v[key] = redactJSON(value)
+			}
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = redactJSON(value)
+		}
+	case string:
+		return Scrub(v)
+	}
+	return v
+}
+
+// redactAttr is the ReplaceAttr hook of every handler.
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	switch a.Key {
+	case slog.TimeKey, slog.LevelKey, slog.SourceKey:
+		return a
+	case slog.MessageKey:
+		a.Value = slog.StringValue(Scrub(a.Value.String()))
+		return a
+	}
+	if SensitiveKey(a.Key) && a.Value.Kind() != slog.KindBool {
+		return slog.String(a.Key, Redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindDuration:
+		a.Value = slog.StringValue(a.Value.Duration().String())
+	case slog.KindString:
+		a.Value = slog.StringValue(Scrub(a.Value.String()))
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case error:
+			a.Value = slog.StringValue(Scrub(v.Error()))
+		case []byte:
+			a.Value = slog.StringValue(Scrub(string(v)))
+		default:
+			switch reflect.Indirect(reflect.ValueOf(v)).Kind() {
+			case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+				a.Value = slog.AnyValue(Redact(v))
+			}
+		}
+	}
+	return a
+}
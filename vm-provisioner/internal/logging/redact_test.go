@@ -0,0 +1,126 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSensitiveKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"sshPassword", true},
+		{"user_data", true},
+		{"X-Api-Key", true},
+		{"Authorization", true},
+		{"webhook.secret", true},
+		{"ssh private key", true},
+		{"clientToken", true},
+		{"name", false},
+		{"instanceType", false},
+		{"user_id", false},
+	}
+	for _, tt := range tests {
+		if got := SensitiveKey(tt.key); got != tt.want {
+			t.Errorf("SensitiveKey(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestScrub(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"bearer token", "Authorization: Bearer abc.def", "Authorization: Bearer " + Redacted},
+		{"key=value", "dial failed: password=hunter2 host=db", "dial failed: password=" + Redacted + " host=db"},
+		{"query string", "GET /cb?token=xyz&state=1", "GET /cb?token=" + Redacted + "&state=1"},
+		{"JSON field", `{"api_key": "k-123", "name": "vm"}`, `{"api_key": "` + Redacted + `", "name": "vm"}`},
+		{"case-insensitive", "SECRET: s3cr3t", "SECRET: " + Redacted},
+		{"nothing to mask", "instance i-123 is running", "instance i-123 is running"},
+		{"word without value", "password reset required", "password reset required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Scrub(tt.in); got != tt.want {
+				t.Errorf("Scrub(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedact(t *testing.T) {
+	type request struct {
+		Name               string            `json:"name"`
+		SSHPassword        string            `json:"sshPassword,omitempty"`
+		EnablePasswordAuth bool              `json:"enablePasswordAuth"`
+		UserData           string            `json:"userData,omitempty"`
+		Tags               map[string]string `json:"tags,omitempty"`
+		Notes              []string          `json:"notes,omitempty"`
+	}
+
+	tests := []struct {
+		name string
+		in   any
+		want any
+	}{
+		{
+			name: "struct fields",
+			in:   request{Name: "vm", SSHPassword: "hunter2", EnablePasswordAuth: true, UserData: "#!/bin/sh"},
+			want: map[string]any{"name": "vm", "sshPassword": Redacted, "enablePasswordAuth": true, "userData": Redacted},
+		},
+		{
+			name: "nested maps and slices",
+			in:   request{Name: "vm", Tags: map[string]string{"deploy_token": "t", "team": "ml"}, Notes: []string{"uses Bearer abc"}},
+			want: map[string]any{"name": "vm", "enablePasswordAuth": false,
+				"tags": map[string]any{"deploy_token": Redacted, "team": "ml"}, "notes": []any{"uses Bearer " + Redacted}},
+		},
+		{
+			name: "plain string is scrubbed",
+			in:   "token=abc",
+			want: "token=" + Redacted,
+		},
+		{
+			name: "unencodable value",
+			in:   map[string]any{"fn": func() {}},
+			want: Redacted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Redact(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Redact = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactAttr(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{ReplaceAttr: redactAttr}))
+
+	logger.Info("login with password=hunter2",
+		"sshPassword", "hunter2",
+		"enablePasswordAuth", true,
+		"error", errors.New("auth failed: Bearer abc"),
+		"body", []byte(`{"token":"xyz"}`),
+		"vm_id", "i-123")
+
+	out := buf.String()
+	for _, leaked := range []string{"hunter2", "abc", "xyz"} {
+		if strings.Contains(out, leaked) {
+			t.Errorf("log record contains %q: %s", leaked, out)
+		}
+	}
+	for _, kept := range []string{"enablePasswordAuth=true", "vm_id=i-123"} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("log record lacks %q: %s", kept, out)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"vm-provisioner/internal/store"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// countTimeout bounds the store query behind one scrape.
+const countTimeout = 5 * time.Second
+
+var activeVMsDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "active_vms"),
+	"VMs that are not terminated, by provider, status and owner tier (the \"tier\" tag, \"none\" when unset).",
+	[]string{"provider", "status", "tier"}, nil,
+)
+
+// activeVMs counts the live VMs from the store on every scrape, so the
+// gauge is right after restarts and across instances sharing a store.
+type activeVMs struct {
+	store *store.Store
+}
+
+// RegisterActiveVMs exports the active VM gauge, read from st.
+func RegisterActiveVMs(st *store.Store) {
+	Registry.MustRegister(activeVMs{store: st})
+}
+
+func (c activeVMs) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeVMsDesc
+}
+
+func (c activeVMs) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), countTimeout)
+	defer cancel()
+
+	counts, err := c.store.CountActiveVMs(ctx)
+	if err != nil {
+		slog.Error("Failed to count active VMs", "error", err)
+		ch <- prometheus.NewInvalidMetric(activeVMsDesc, err)
+		return
+	}
+	for _, count := range counts {
+		tier := count.Tier
+		if tier == "" {
+			tier = "none"
+		}
+		ch <- prometheus.MustNewConstMetric(activeVMsDesc, prometheus.GaugeValue, float64(count.Count),
+			count.Provider, count.Status, tier)
+	}
+}
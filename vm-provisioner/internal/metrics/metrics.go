@@ -0,0 +1,118 @@
+// Package metrics defines the Prometheus metrics of the provisioner and
+// serves them on /metrics. Collectors are registered on a registry of their
+// own, together with the Go runtime and process collectors.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"vm-provisioner/internal/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "wolkenlauf"
+
+// Registry holds every metric the provisioner exports.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	// VMOperations counts VM creates and deletes at the providers. Every
+	// placement attempt of a create counts on its own.
+	VMOperations = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "vm_operations_total",
+		Help:      "VM creates and deletes by provider, region, instance type and outcome.",
+	}, []string{"operation", "provider", "region", "instance_type", "outcome"})
+
+	VMOperationDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "vm_operation_duration_seconds",
+		Help:      "Time the providers took to create or delete a VM.",
+		Buckets:   []float64{1, 2.5, 5, 10, 20, 30, 60, 120, 300},
+	}, []string{"operation", "provider", "outcome"})
+
+	// ProviderRequests counts calls to the cloud providers by the error code
+	// they returned: "ok", the provider's own code (e.g.
+	// InsufficientInstanceCapacity, resource_unavailable) or the
+	// provisioner's classification of the error.
+	ProviderRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_requests_total",
+		Help:      "Calls to cloud provider APIs by provider, method and error code.",
+	}, []string{"provider", "method", "code"})
+
+	ProviderRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "provider_request_duration_seconds",
+		Help:      "Latency of calls to cloud provider APIs.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"provider", "method"})
+
+	// TimeToRunning is observed once per VM, when it is first seen running.
+	TimeToRunning = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "vm_time_to_running_seconds",
+		Help:      "Time from the provider accepting a VM to the VM first being seen running.",
+		Buckets:   []float64{5, 10, 20, 30, 45, 60, 90, 120, 180, 300, 600, 1200},
+	}, []string{"provider", "region", "instance_type"})
+
+	// ReconcilerDrift holds the drift found by the latest reconciliation pass.
+	ReconcilerDrift = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "reconciler_drift",
+		Help:      "Drift entries found by the latest reconciliation pass, by provider and kind.",
+	}, []string{"provider", "kind"})
+
+	ReconcilerDriftActions = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconciler_drift_total",
+		Help:      "Drift entries handled by reconciliation passes, by provider, kind and action taken.",
+	}, []string{"provider", "kind", "action"})
+
+	ReconcilerLastRun = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "reconciler_last_run_timestamp_seconds",
+		Help:      "Unix time the latest reconciliation pass finished.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Outcome labels the result of a VM operation: "success" or the code of
+// the error.
+func Outcome(err error) string {
+	if err == nil {
+		return "success"
+	}
+	return models.ErrorCode(err)
+}
+
+// ObserveVMOperation records a create or delete of a VM that started at start.
+func ObserveVMOperation(operation, provider, region, instanceType string, start time.Time, err error) {
+	outcome := Outcome(err)
+	VMOperations.WithLabelValues(operation, provider, region, instanceType, outcome).Inc()
+	VMOperationDuration.WithLabelValues(operation, provider, outcome).Observe(time.Since(start).Seconds())
+}
+
+// ObserveTimeToRunning records how long a VM took to come up. It matches
+// the store's OnFirstRunning hook.
+func ObserveTimeToRunning(vm models.VMRecord, elapsed time.Duration) {
+	TimeToRunning.WithLabelValues(vm.Provider, vm.Region, vm.InstanceType).Observe(elapsed.Seconds())
+}
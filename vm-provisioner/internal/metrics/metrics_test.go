@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/store"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestOutcome(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, "success"},
+		{fmt.Errorf("launch: %w", models.ErrInsufficientCapacity), "insufficient_capacity"},
+		{fmt.Errorf("describe: %w", models.ErrVMNotFound), "not_found"},
+		{context.DeadlineExceeded, "timeout"},
+		{errors.New("quota exceeded"), "provider_error"},
+	}
+	for _, tt := range tests {
+		if got := Outcome(tt.err); got != tt.want {
+			t.Errorf("Outcome(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestObserveVMOperation(t *testing.T) {
+	ObserveVMOperation("create", "test", "eu-1", "small", time.Now(), nil)
+	ObserveVMOperation("create", "test", "eu-1", "small", time.Now(), models.ErrInsufficientCapacity)
+	ObserveVMOperation("create", "test", "eu-1", "small", time.Now(), models.ErrInsufficientCapacity)
+
+	got := gather(t, Registry, "wolkenlauf_vm_operations_total")
+	want := map[string]float64{
+		`instance_type="small",operation="create",outcome="success",provider="test",region="eu-1"`:               1,
+		`instance_type="small",operation="create",outcome="insufficient_capacity",provider="test",region="eu-1"`: 2,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("VM operations = %v, want %v", got, want)
+	}
+}
+
+func TestActiveVMs(t *testing.T) {
+	ctx := context.Background()
+	st, err := store.Open(ctx, config.StoreConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer st.Close()
+
+	vms := []struct {
+		id, status, tier string
+	}{
+		{"vm-1", "running", "pro"},
+		{"vm-2", "running", "pro"},
+		{"vm-3", "running", ""},
+		{"vm-4", "stopped", "free"},
+		{"vm-5", "running", "pro"}, // terminated below
+	}
+	for _, vm := range vms {
+		record := &models.VMRecord{ID: vm.id, Provider: "aws", Region: "eu-1", UserID: "u1", Name: vm.id, Status: vm.status}
+		if vm.tier != "" {
+			record.Tags = map[string]string{models.TierTag: vm.tier}
+		}
+		if err := st.CreateVM(ctx, record); err != nil {
+			t.Fatalf("create vm: %v", err)
+		}
+	}
+	if _, err := st.UpdateVMStatus(ctx, "vm-5", "terminated", "", "deleted"); err != nil {
+		t.Fatalf("terminate vm: %v", err)
+	}
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(activeVMs{store: st})
+	got := gather(t, registry, "wolkenlauf_active_vms")
+	want := map[string]float64{
+		`provider="aws",status="running",tier="none"`: 1,
+		`provider="aws",status="running",tier="pro"`:  2,
+		`provider="aws",status="stopped",tier="free"`: 1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("active VMs = %v, want %v", got, want)
+	}
+}
+
+// gather returns the values of the named metric in registry by their labels,
+// written as in the exposition format.
+func gather(t *testing.T, registry prometheus.Gatherer, name string) map[string]float64 {
+	t.Helper()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	values := map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			var labels []string
+			for _, label := range m.GetLabel() {
+				labels = append(labels, fmt.Sprintf("%s=%q", label.GetName(), label.GetValue()))
+			}
+			values[strings.Join(labels, ",")] = m.GetCounter().GetValue() + m.GetGauge().GetValue()
+		}
+	}
+	return values
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"vm-provisioner/internal/auth"
+	"vm-provisioner/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORS sets CORS headers for allowed browser origins and answers preflight
+// requests before authentication runs.
+func CORS(cfg config.CORSConfig) gin.HandlerFunc {
+	allowAny := false
+	allowed := map[string]bool{}
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			allowAny = true
+		}
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		c.Writer.Header().Add("Vary", "Origin")
+		if origin != "" && (allowAny || allowed[origin]) {
+			if allowAny {
+				c.Header("Access-Control-Allow-Origin", "*")
+			} else {
+				c.Header("Access-Control-Allow-Origin", origin)
+			}
+			c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key, traceparent, tracestate, "+auth.TimestampHeader)
+			c.Header("Access-Control-Expose-Headers", "Location, Idempotent-Replayed")
+		}
+
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
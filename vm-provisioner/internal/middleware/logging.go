@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"log/slog"
+	"regexp"
+	"time"
+
+	"vm-provisioner/internal/logging"
+	"vm-provisioner/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the ID of a request. Callers may set it to
+// correlate their logs with ours; otherwise one is generated.
+const RequestIDHeader = "X-Request-ID"
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestLogger assigns every request an ID, puts a logger carrying it into
+// the request context and logs the request once it has been served. The
+// query string is not logged.
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestID := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = utils.GenerateID("req")
+		}
+		c.Header(RequestIDHeader, requestID)
+
+		fields := []any{"request_id", requestID}
+		if userID := c.Query("userId"); userID != "" {
+			fields = append(fields, "user_id", userID)
+		}
+		ctx := logging.With(c.Request.Context(), fields...)
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		level := slog.LevelInfo
+		switch {
+		case c.Writer.Status() >= 500:
+			level = slog.LevelError
+		case c.Writer.Status() >= 400:
+			level = slog.LevelWarn
+		}
+		logging.FromContext(c.Request.Context()).Log(ctx, level, "Request served",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"route", c.FullPath(),
+			"status", c.Writer.Status(),
+			"duration", time.Since(start),
+			"client_ip", c.ClientIP())
+	}
+}
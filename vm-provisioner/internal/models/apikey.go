@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// API key scopes. ScopeAdmin implies every other scope.
+const (
+	ScopeCreate  = "create"
+	ScopeDelete  = "delete"
+	ScopeRead    = "read"
+	ScopeMetrics = "metrics"
+	ScopeAdmin   = "admin"
+)
+
+// Scopes lists every scope an API key can be granted
+var Scopes = []string{ScopeCreate, ScopeDelete, ScopeRead, ScopeMetrics, ScopeAdmin}
+
+// APIKey is a credential issued to a calling service. The secret is only
+// ever returned when the key is created or rotated.
+type APIKey struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"` // calling service, e.g. "frontend"
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RotatedAt *time.Time `json:"rotatedAt,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+
+	Secret string `json:"-"`
+	// PreviousSecret stays valid until PreviousExpiresAt after a rotation
+	PreviousSecret    string     `json:"-"`
+	PreviousExpiresAt *time.Time `json:"-"`
+}
+
+// HasScope reports whether the key grants scope, directly or through admin.
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
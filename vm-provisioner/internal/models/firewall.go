@@ -0,0 +1,80 @@
+package models
+
+import (
+	"context"
+	"slices"
+)
+
+// AnySource matches every IPv4 and IPv6 address.
+var AnySource = []string{"0.0.0.0/0", "::/0"}
+
+// SSHPort is always open to a VM's firewall sources.
+const SSHPort = 22
+
+// FirewallPolicy controls inbound traffic to a VM. SSH is always allowed
+// from SourceCIDRs; everything not listed is dropped. Outbound traffic is
+// not restricted.
+type FirewallPolicy struct {
+	// SourceCIDRs may reach SSH and, unless they name their own, Ports.
+	// Defaults to anywhere.
+	SourceCIDRs []string       `json:"sourceCidrs,omitempty" binding:"omitempty,max=20,dive,cidr"`
+	Ports       []FirewallPort `json:"ports,omitempty" binding:"omitempty,max=20,dive"`
+}
+
+// FirewallPort opens an extra port, e.g. 8888 for Jupyter
+type FirewallPort struct {
+	Port        int      `json:"port" binding:"required,min=1,max=65535"`
+	Protocol    string   `json:"protocol,omitempty" binding:"omitempty,oneof=tcp udp"` // defaults to tcp
+	SourceCIDRs []string `json:"sourceCidrs,omitempty" binding:"omitempty,max=20,dive,cidr"`
+}
+
+// FirewallRule is one port of a policy with its defaults filled in
+type FirewallRule struct {
+	Protocol    string
+	Port        int
+	SourceCIDRs []string
+}
+
+// DefaultFirewallPolicy allows SSH from anywhere, like the shared security
+// group VMs used to get.
+func DefaultFirewallPolicy() *FirewallPolicy {
+	return &FirewallPolicy{SourceCIDRs: AnySource}
+}
+
+// Rules expands the policy into one rule per port, SSH first. A nil policy
+// is the default policy.
+func (p *FirewallPolicy) Rules() []FirewallRule {
+	if p == nil {
+		p = DefaultFirewallPolicy()
+	}
+	sources := p.SourceCIDRs
+	if len(sources) == 0 {
+		sources = AnySource
+	}
+
+	rules := []FirewallRule{{Protocol: "tcp", Port: SSHPort, SourceCIDRs: sources}}
+	for _, port := range p.Ports {
+		rule := FirewallRule{Protocol: port.Protocol, Port: port.Port, SourceCIDRs: port.SourceCIDRs}
+		if rule.Protocol == "" {
+			rule.Protocol = "tcp"
+		}
+		if len(rule.SourceCIDRs) == 0 {
+			rule.SourceCIDRs = sources
+		}
+		if i := slices.IndexFunc(rules, func(r FirewallRule) bool { return r.Protocol == rule.Protocol && r.Port == rule.Port }); i >= 0 {
+			merged := append(slices.Clone(rules[i].SourceCIDRs), rule.SourceCIDRs...)
+			slices.Sort(merged)
+			rules[i].SourceCIDRs = slices.Compact(merged)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// FirewallProvider manages the dedicated firewall of each VM
+type FirewallProvider interface {
+	// SetFirewall replaces the inbound rules of a VM. VMs created before
+	// per-VM firewalls get a dedicated one in place of the shared SSH group.
+	SetFirewall(ctx context.Context, region, vmID string, policy *FirewallPolicy) error
+}
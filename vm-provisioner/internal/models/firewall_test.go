@@ -0,0 +1,76 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFirewallPolicyRules(t *testing.T) {
+	office := []string{"203.0.113.0/24"}
+
+	tests := []struct {
+		name   string
+		policy *FirewallPolicy
+		want   []FirewallRule
+	}{
+		{
+			name:   "nil policy allows SSH from anywhere",
+			policy: nil,
+			want:   []FirewallRule{{Protocol: "tcp", Port: SSHPort, SourceCIDRs: AnySource}},
+		},
+		{
+			name:   "empty sources default to anywhere",
+			policy: &FirewallPolicy{},
+			want:   []FirewallRule{{Protocol: "tcp", Port: SSHPort, SourceCIDRs: AnySource}},
+		},
+		{
+			name: "ports inherit the policy sources and tcp",
+			policy: &FirewallPolicy{SourceCIDRs: office, Ports: []FirewallPort{
+				{Port: 8888},
+				{Port: 51820, Protocol: "udp", SourceCIDRs: []string{"0.0.0.0/0"}},
+			}},
+			want: []FirewallRule{
+				{Protocol: "tcp", Port: SSHPort, SourceCIDRs: office},
+				{Protocol: "tcp", Port: 8888, SourceCIDRs: office},
+				{Protocol: "udp", Port: 51820, SourceCIDRs: []string{"0.0.0.0/0"}},
+			},
+		},
+		{
+			name: "listing SSH merges its sources",
+			policy: &FirewallPolicy{SourceCIDRs: office, Ports: []FirewallPort{
+				{Port: SSHPort, SourceCIDRs: []string{"198.51.100.7/32", "203.0.113.0/24"}},
+			}},
+			want: []FirewallRule{
+				{Protocol: "tcp", Port: SSHPort, SourceCIDRs: []string{"198.51.100.7/32", "203.0.113.0/24"}},
+			},
+		},
+		{
+			name: "duplicate ports merge, other protocols do not",
+			policy: &FirewallPolicy{SourceCIDRs: office, Ports: []FirewallPort{
+				{Port: 443, SourceCIDRs: []string{"10.0.0.0/8"}},
+				{Port: 443, Protocol: "tcp", SourceCIDRs: []string{"192.168.0.0/16", "10.0.0.0/8"}},
+				{Port: 443, Protocol: "udp"},
+			}},
+			want: []FirewallRule{
+				{Protocol: "tcp", Port: SSHPort, SourceCIDRs: office},
+				{Protocol: "tcp", Port: 443, SourceCIDRs: []string{"10.0.0.0/8", "192.168.0.0/16"}},
+				{Protocol: "udp", Port: 443, SourceCIDRs: office},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Rules(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Rules = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFirewallPolicyRulesKeepsPolicy(t *testing.T) {
+	policy := &FirewallPolicy{SourceCIDRs: []string{"203.0.113.0/24"}, Ports: []FirewallPort{{Port: SSHPort, SourceCIDRs: []string{"198.51.100.7/32"}}}}
+	policy.Rules()
+	if want := []string{"203.0.113.0/24"}; !reflect.DeepEqual(policy.SourceCIDRs, want) {
+		t.Errorf("SourceCIDRs = %v after merging, want %v", policy.SourceCIDRs, want)
+	}
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Operation statuses
+const (
+	OperationQueued    = "queued"
+	OperationRunning   = "running"
+	OperationSucceeded = "succeeded"
+	OperationFailed    = "failed"
+)
+
+// Operation is a long-running mutation executed in the background.
+// Mutating endpoints return it with 202 and clients poll GET /operations/:id.
+type Operation struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"` // e.g. "vm.create", "vm.delete"
+	VMID       string          `json:"vmId,omitempty"`
+	UserID     string          `json:"userId,omitempty"`
+	Status     string          `json:"status"`
+	Progress   string          `json:"progress,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      *OperationError `json:"error,omitempty"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	UpdatedAt  time.Time       `json:"updatedAt"`
+	StartedAt  *time.Time      `json:"startedAt,omitempty"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+}
+
+// OperationError is the structured failure of an operation
+type OperationError struct {
+	Code    string `json:"code"` // not_found, not_supported, insufficient_capacity, timeout, canceled, interrupted, shutting_down, provider_error
+	Message string `json:"message"`
+}
+
+// ErrorCode classifies a failed provider call into the codes of
+// OperationError. Errors matching no other code are provider errors.
+func ErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrVMNotFound) || errors.Is(err, ErrVolumeNotFound) || errors.Is(err, ErrSnapshotNotFound):
+		return "not_found"
+	case errors.Is(err, ErrOperationNotSupported):
+		return "not_supported"
+	case errors.Is(err, ErrInsufficientCapacity):
+		return "insufficient_capacity"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	}
+	return "provider_error"
+}
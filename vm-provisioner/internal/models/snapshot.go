@@ -0,0 +1,64 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrSnapshotNotFound is returned by providers when the snapshot does not exist.
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// Snapshot statuses
+const (
+	SnapshotPending   = "pending" // still being captured
+	SnapshotAvailable = "available"
+	SnapshotFailed    = "failed" // did not become available in time; delete it
+	SnapshotDeleted   = "deleted"
+)
+
+// SnapshotRequest captures a VM as a bootable snapshot
+type SnapshotRequest struct {
+	Name string `json:"name" binding:"required"`
+	// NoReboot skips the reboot EC2 does for a consistent filesystem.
+	// Hetzner never reboots; stop the VM first for a consistent snapshot.
+	NoReboot bool `json:"noReboot,omitempty"`
+
+	UserID      string `json:"-"`
+	SSHUsername string `json:"-"` // login user of the VM, derived from its image if empty
+}
+
+// Snapshot is a bootable image of a VM's disks, owned by a user. Pass its ID
+// as VMRequest.Image to restore it.
+type Snapshot struct {
+	ID       string `json:"id"` // provider image ID, e.g. ami-0abc or a Hetzner image ID
+	Provider string `json:"provider"`
+	// Region the snapshot can be booted in; empty where images are global (Hetzner)
+	Region      string     `json:"region,omitempty"`
+	UserID      string     `json:"userId"`
+	VMID        string     `json:"vmId"` // VM the snapshot was taken of
+	Name        string     `json:"name"`
+	Status      string     `json:"status"`
+	SSHUsername string     `json:"sshUsername,omitempty"` // login user of VMs restored from it
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	DeletedAt   *time.Time `json:"deletedAt,omitempty"`
+}
+
+// SnapshotPolicy bounds how many snapshots of a user are kept. Older
+// snapshots beyond either limit are deleted; zero disables a limit.
+type SnapshotPolicy struct {
+	UserID     string `json:"userId"`
+	KeepLast   int    `json:"keepLast"`   // newest available snapshots kept
+	MaxAgeDays int    `json:"maxAgeDays"` // snapshots older than this are deleted
+}
+
+// SnapshotProvider captures VMs as images new VMs can boot from
+type SnapshotProvider interface {
+	// CreateSnapshot starts capturing the VM and returns the pending snapshot.
+	CreateSnapshot(ctx context.Context, region, vmID string, req *SnapshotRequest) (*Snapshot, error)
+	// WaitForSnapshot blocks until the snapshot can be booted.
+	WaitForSnapshot(ctx context.Context, region, id string) error
+	// DeleteSnapshot removes the image and the storage backing it.
+	DeleteSnapshot(ctx context.Context, region, id string) error
+}
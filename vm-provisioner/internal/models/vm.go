@@ -1,6 +1,25 @@
 package models
 
-import "time"
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"time"
+)
+
+var (
+	// ErrVMNotFound is returned by providers when the VM does not exist.
+	ErrVMNotFound = errors.New("vm not found")
+	// ErrOperationNotSupported is returned when a VM cannot perform the
+	// requested operation in its current configuration.
+	ErrOperationNotSupported = errors.New("operation not supported")
+	// ErrInsufficientCapacity is returned when the provider cannot place the
+	// VM right now, e.g. EC2 InsufficientInstanceCapacity. Creates retry it
+	// in the next acceptable placement.
+	ErrInsufficientCapacity = errors.New("insufficient capacity")
+)
 
 // VMRequest represents a request to create a new VM
 type VMRequest struct {
@@ -12,6 +31,36 @@ type VMRequest struct {
 	Image                string `json:"image,omitempty"`
 	AutoTerminateMinutes int    `json:"autoTerminateMinutes,omitempty"`
 	UserID               string `json:"userId" binding:"required"`
+	// AvailabilityZone pins the VM to a zone of Region (AWS only)
+	AvailabilityZone string `json:"availabilityZone,omitempty"`
+	// Placement lists fallbacks, in order, tried when the provider lacks
+	// capacity for the requested placement
+	Placement []PlacementOption `json:"placement,omitempty"`
+
+	// SSH access: inline public keys and/or IDs of keys registered for the
+	// user. When both are empty, all of the user's registered keys are used.
+	SSHPublicKeys []string `json:"sshPublicKeys,omitempty"`
+	SSHKeyIDs     []string `json:"sshKeyIds,omitempty"`
+	// EnablePasswordAuth opts in to a generated password and sshd password login
+	EnablePasswordAuth bool `json:"enablePasswordAuth,omitempty"`
+	// SSHUsername overrides the login user derived from the image (AWS).
+	// Snapshots restored via Image set it to the user of the original VM.
+	SSHUsername string `json:"sshUsername,omitempty"`
+	// Volumes are attached before the VM boots and mounted by cloud-init.
+	// They pin the VM to the volumes' region and zone.
+	Volumes []VolumeMount `json:"volumes,omitempty"`
+	// ReplaceOnInterruption relaunches an equivalent spot VM when the
+	// provider reclaims this one
+	ReplaceOnInterruption bool `json:"replaceOnInterruption,omitempty"`
+	// Firewall restricts inbound traffic. Defaults to SSH from anywhere.
+	Firewall *FirewallPolicy `json:"firewall,omitempty"`
+	// Tags are free-form labels to find the VM by in GET /vm; TierTag
+	// names the owner's plan in metrics
+	Tags map[string]string `json:"tags,omitempty" binding:"omitempty,max=20,dive,max=255"`
+
+	// ClientToken is derived from the Idempotency-Key header and passed to
+	// providers that deduplicate creates server-side (EC2)
+	ClientToken string `json:"-"`
 }
 
 // VMResponse represents the response when creating a VM
@@ -27,20 +76,326 @@ type VMResponse struct {
 	SSHPassword  string    `json:"sshPassword,omitempty"`
 	Image        string    `json:"image,omitempty"`
 	CreatedAt    time.Time `json:"createdAt"`
+
+	SSHKeyFingerprints []string `json:"sshKeyFingerprints,omitempty"`
+
+	AvailabilityZone string `json:"availabilityZone,omitempty"`
+	// Placement explains where the VM landed when fallbacks were given
+	Placement *PlacementReport `json:"placement,omitempty"`
+}
+
+// WithoutSecrets returns a copy of the response without the SSH password,
+// and false if it had none.
+func (r *VMResponse) WithoutSecrets() (any, bool) {
+	if r.SSHPassword == "" {
+		return r, false
+	}
+	stripped := *r
+	stripped.SSHPassword = ""
+	return &stripped, true
+}
+
+// PlacementOption is an acceptable place for a VM. Empty provider, region
+// and instance type fields are taken from the request.
+type PlacementOption struct {
+	Provider         string `json:"provider,omitempty"`
+	Region           string `json:"region,omitempty"`
+	AvailabilityZone string `json:"availabilityZone,omitempty"`
+	InstanceType     string `json:"instanceType,omitempty"`
+}
+
+// PlacementAttempt is a placement tried while creating a VM
+type PlacementAttempt struct {
+	PlacementOption
+	Error string `json:"error,omitempty"`
+}
+
+// PlacementReport records which placement a VM was created in and why
+type PlacementReport struct {
+	Chosen   PlacementOption    `json:"chosen"`
+	Reason   string             `json:"reason"`
+	Attempts []PlacementAttempt `json:"attempts"`
 }
 
 // VMStatus represents the current status of a VM
 type VMStatus struct {
 	ID        string `json:"id"`
+	Region    string `json:"region,omitempty"`
 	Status    string `json:"status"`
 	PublicIP  string `json:"publicIp,omitempty"`
+	UserID    string `json:"userId,omitempty"` // owner tag/label set at creation
 	UpdatedAt time.Time `json:"updatedAt"`
 }
 
-// Provider interface that both AWS and Hetzner must implement
+// labelValuePattern matches values providers accept in every tag or label:
+// at most 63 of [A-Za-z0-9._-], alphanumeric at both ends (Hetzner labels).
+var labelValuePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._-]{0,61}[A-Za-z0-9])?$`)
+
+// OwnerLabel returns the owner tag or label value written for userID where
+// the provider restricts label values. User IDs that do not fit, such as
+// email addresses, are replaced by a digest; the store keeps the real owner.
+func OwnerLabel(userID string) string {
+	if labelValuePattern.MatchString(userID) {
+		return userID
+	}
+	sum := sha256.Sum256([]byte(userID))
+	return "sha256-" + hex.EncodeToString(sum[:28])
+}
+
+// Provider interface that both AWS and Hetzner must implement.
+// Every call receives the request context so that client disconnects and
+// per-operation deadlines abort in-flight cloud API calls.
 type CloudProvider interface {
-	CreateVM(req *VMRequest) (*VMResponse, error)
-	DeleteVM(id string) error
-	GetVMStatus(id string) (*VMStatus, error)
+	CreateVM(ctx context.Context, req *VMRequest) (*VMResponse, error)
+	// region may be empty when the caller does not know where the VM lives;
+	// providers with regional IDs must then locate the VM themselves.
+	DeleteVM(ctx context.Context, region, id string) error
+	GetVMStatus(ctx context.Context, region, id string) (*VMStatus, error)
+	// GetVMStatuses reports many VMs of region at once, batching the
+	// provider calls. VMs the provider no longer knows are left out.
+	GetVMStatuses(ctx context.Context, region string, ids []string) ([]VMStatus, error)
+	// StopVM powers the VM off while keeping its disks; force skips the
+	// graceful guest shutdown.
+	StopVM(ctx context.Context, region, id string, force bool) error
+	StartVM(ctx context.Context, region, id string) error
+	// RebootVM restarts the guest; hard resets it without a clean shutdown.
+	RebootVM(ctx context.Context, region, id string, hard bool) error
 	SupportsInstanceType(instanceType string) bool
-}
\ No newline at end of file
+	// IsGPUInstanceType reports whether instanceType comes with a GPU.
+	IsGPUInstanceType(instanceType string) bool
+	// ListManagedVMs enumerates the VMs tagged as created by wolkenlauf.
+	// regions are scanned in addition to those the provider already uses.
+	ListManagedVMs(ctx context.Context, regions []string) ([]ManagedVM, error)
+	// ListInstanceTypes discovers the supported instance types offered in
+	// region, with specs and prices. An empty region means the provider's
+	// default region, or every location for providers with global types.
+	ListInstanceTypes(ctx context.Context, region string) ([]InstanceTypeSpec, error)
+	// PriceResources prices what a VM created from req is billed for on top
+	// of its instance type.
+	PriceResources(ctx context.Context, req *VMRequest) (*ResourcePrices, error)
+	// CheckSpotInstances reports interruption notices and reclaims for spot
+	// VMs in region. VMs the provider no longer knows are left out.
+	// Providers without a spot market return nothing.
+	CheckSpotInstances(ctx context.Context, region string, ids []string) ([]SpotStatus, error)
+
+	VolumeProvider
+	SnapshotProvider
+	FirewallProvider
+}
+
+// SpotStatus is the provider's view of a spot VM
+type SpotStatus struct {
+	ID     string
+	Status string // normalized VM status
+	// MarkedForTermination is set once the provider announced that it will
+	// reclaim the VM shortly
+	MarkedForTermination bool
+	TerminationTime      *time.Time
+	// Interrupted is set once the provider reclaimed the VM
+	Interrupted bool
+	Reason      string // provider's explanation, e.g. instance-terminated-no-capacity
+}
+
+// ResourcePrices are the hourly charges of a VM besides compute
+type ResourcePrices struct {
+	DiskGiB          int     // root disk size
+	StorageHourly    float64 // root disk; zero when included in the instance price
+	PublicIPv4Hourly float64
+	Currency         string
+}
+
+// CostBreakdown is the projected cost of a VM in one market (on-demand or spot)
+type CostBreakdown struct {
+	ComputeHourly    float64  `json:"computeHourly"`
+	StorageHourly    float64  `json:"storageHourly"`
+	PublicIPv4Hourly float64  `json:"publicIpv4Hourly"`
+	Hourly           float64  `json:"hourly"`
+	Total            *float64 `json:"total,omitempty"` // over AutoTerminateMinutes
+}
+
+// CostEstimate is the projected cost of a VMRequest before launch
+type CostEstimate struct {
+	Provider        string         `json:"provider"`
+	InstanceType    string         `json:"instanceType"`
+	Region          string         `json:"region"`
+	Currency        string         `json:"currency"`
+	DiskGiB         int            `json:"diskGiB,omitempty"`
+	DurationMinutes int            `json:"durationMinutes,omitempty"`
+	UseSpotInstance bool           `json:"useSpotInstance"`
+	OnDemand        CostBreakdown  `json:"onDemand"`
+	Spot            *CostBreakdown `json:"spot,omitempty"` // nil where spot is not offered
+	// HourlyCost and TotalCost are those of the market the request selects
+	HourlyCost float64  `json:"hourlyCost"`
+	TotalCost  *float64 `json:"totalCost,omitempty"`
+}
+
+// CPU architectures reported in the instance type catalog
+const (
+	ArchX86_64 = "x86_64"
+	ArchARM64  = "arm64"
+)
+
+// InstanceTypeSpec is an instance type offered by a provider in a region.
+// Prices are per hour in Currency; SpotPrice is the lowest current spot
+// price across the region's zones, zero when spot is not offered.
+type InstanceTypeSpec struct {
+	Provider     string  `json:"provider"`
+	Name         string  `json:"name"`
+	Region       string  `json:"region"`
+	VCPUs        int     `json:"vcpus"`
+	MemoryGiB    float64 `json:"memoryGiB"`
+	GPUs         int     `json:"gpus,omitempty"`
+	GPUModel     string  `json:"gpuModel,omitempty"`
+	GPUMemoryGiB float64 `json:"gpuMemoryGiB,omitempty"`
+	Architecture string  `json:"architecture"`
+	HourlyPrice  float64 `json:"hourlyPrice,omitempty"`
+	SpotPrice    float64 `json:"spotPrice,omitempty"`
+	Currency     string  `json:"currency"`
+}
+
+// ProviderCapabilities advertises what a cloud provider can do
+type ProviderCapabilities struct {
+	GPU       bool `json:"gpu"`
+	Spot      bool `json:"spot"`
+	ARM       bool `json:"arm"`
+	Snapshots bool `json:"snapshots"`
+}
+
+// Provider availability as reported by GET /providers
+const (
+	ProviderAvailable = "available"
+	ProviderDegraded  = "degraded" // enabled but failed to initialize
+	ProviderDisabled  = "disabled"
+)
+
+// ProviderInfo describes a registered cloud provider
+type ProviderInfo struct {
+	Name         string               `json:"name"`
+	Status       string               `json:"status"`
+	Error        string               `json:"error,omitempty"` // why the provider is degraded
+	Capabilities ProviderCapabilities `json:"capabilities"`
+}
+
+// ManagedVM is a wolkenlauf-tagged VM as reported by the cloud provider
+type ManagedVM struct {
+	ID           string    `json:"id"`
+	Provider     string    `json:"provider"`
+	Region       string    `json:"region"`
+	Name         string    `json:"name,omitempty"`
+	UserID       string    `json:"userId,omitempty"`
+	InstanceType string    `json:"instanceType,omitempty"`
+	Status       string    `json:"status"`
+	PublicIP     string    `json:"publicIp,omitempty"`
+	Spot         bool      `json:"spot,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// TierTag is the VM tag carrying the owner's plan (e.g. free, pro), which
+// breaks down the active VM metrics
+const TierTag = "tier"
+
+// VMCount is the number of live VMs sharing a provider, status and tier
+type VMCount struct {
+	Provider string
+	Status   string
+	Tier     string
+	Count    int
+}
+
+// VMRecord is the provisioner's persisted view of a VM it created
+type VMRecord struct {
+	ID              string     `json:"id"`
+	Provider        string     `json:"provider"`
+	Region          string     `json:"region"`
+	UserID          string     `json:"userId"`
+	Name            string     `json:"name"`
+	InstanceType    string     `json:"instanceType"`
+	Image           string     `json:"image,omitempty"`
+	UseSpotInstance bool       `json:"useSpotInstance"`
+	Status          string     `json:"status"`
+	PublicIP        string     `json:"publicIp,omitempty"`
+	SSHUsername     string     `json:"sshUsername,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+	DeletedAt       *time.Time `json:"deletedAt,omitempty"`
+	ExpiresAt       *time.Time `json:"expiresAt,omitempty"` // auto-termination deadline
+	TTLWarnedAt     *time.Time `json:"-"`                   // when the pre-expiry warning was emitted
+
+	ReplaceOnInterruption bool   `json:"replaceOnInterruption,omitempty"`
+	InterruptionReason    string `json:"interruptionReason,omitempty"` // why the provider reclaimed the spot VM
+	ReplacedBy            string `json:"replacedBy,omitempty"`         // VM launched in its place
+
+	Firewall *FirewallPolicy   `json:"firewall,omitempty"` // nil for VMs on the shared SSH group
+	Tags     map[string]string `json:"tags,omitempty"`
+}
+
+// NewVMRecord builds the record of a VM the provider just created for req.
+func NewVMRecord(req *VMRequest, response *VMResponse) *VMRecord {
+	record := &VMRecord{
+		ID:                    response.ID,
+		Provider:              response.Provider,
+		Region:                response.Region,
+		UserID:                req.UserID,
+		Name:                  response.Name,
+		InstanceType:          response.InstanceType,
+		Image:                 response.Image,
+		UseSpotInstance:       req.UseSpotInstance,
+		Status:                response.Status,
+		PublicIP:              response.PublicIP,
+		SSHUsername:           response.SSHUsername,
+		CreatedAt:             response.CreatedAt,
+		ReplaceOnInterruption: req.UseSpotInstance && req.ReplaceOnInterruption,
+		Firewall:              req.Firewall,
+		Tags:                  req.Tags,
+	}
+	if req.AutoTerminateMinutes > 0 {
+		expiresAt := response.CreatedAt.Add(time.Duration(req.AutoTerminateMinutes) * time.Minute)
+		record.ExpiresAt = &expiresAt
+	}
+	return record
+}
+
+// VMTransition records a single lifecycle status change of a VM
+type VMTransition struct {
+	ID         int64     `json:"id"`
+	VMID       string    `json:"vmId"`
+	FromStatus string    `json:"fromStatus"`
+	ToStatus   string    `json:"toStatus"`
+	Reason     string    `json:"reason,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// Lifecycle event types published by the provisioner
+const (
+	EventTTLWarning = "vm.ttl_warning"
+	EventTTLExpired = "vm.ttl_expired"
+
+	EventSpotInterruptionWarning = "vm.spot_interruption_warning"
+	EventSpotInterrupted         = "vm.spot_interrupted"
+	EventSpotReplaced            = "vm.spot_replaced"
+
+	// Recorded by the store with every status transition and new public IP
+	EventStatusChanged = "vm.status_changed"
+	EventIPAssigned    = "vm.ip_assigned"
+)
+
+// VMEvent is a notable lifecycle event of a VM, persisted in the event log
+type VMEvent struct {
+	ID        int64          `json:"id"`
+	VMID      string         `json:"vmId"`
+	UserID    string         `json:"userId,omitempty"`
+	Type      string         `json:"type"`
+	Message   string         `json:"message,omitempty"`
+	Data      map[string]any `json:"data,omitempty"`
+	CreatedAt time.Time      `json:"createdAt"`
+}
+
+// SSHKey is a public key registered for a user
+type SSHKey struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"userId"`
+	Name        string    `json:"name"`
+	PublicKey   string    `json:"publicKey"`
+	Fingerprint string    `json:"fingerprint"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrVolumeNotFound is returned by providers when the volume does not exist.
+var ErrVolumeNotFound = errors.New("volume not found")
+
+// Volume statuses
+const (
+	VolumeAvailable = "available" // not attached to any VM
+	VolumeAttached  = "attached"
+	VolumeDeleted   = "deleted"
+)
+
+// VolumeRequest represents a request to create a persistent data volume
+type VolumeRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Provider string `json:"provider" binding:"required"`
+	Region   string `json:"region" binding:"required"`
+	// AvailabilityZone places the volume in a zone of Region (AWS only; EBS
+	// volumes can only attach to VMs in their zone). Defaults to the first
+	// zone of the region.
+	AvailabilityZone string `json:"availabilityZone,omitempty"`
+	SizeGiB          int    `json:"sizeGiB" binding:"required,min=1"`
+	UserID           string `json:"userId" binding:"required"`
+}
+
+// Volume is a persistent block device owned by a user. It lives
+// independently of the VMs it is attached to.
+type Volume struct {
+	ID               string     `json:"id"` // provider-assigned, e.g. vol-0abc or a Hetzner volume ID
+	Provider         string     `json:"provider"`
+	Region           string     `json:"region"`
+	AvailabilityZone string     `json:"availabilityZone,omitempty"`
+	UserID           string     `json:"userId"`
+	Name             string     `json:"name"`
+	SizeGiB          int        `json:"sizeGiB"`
+	Status           string     `json:"status"`
+	VMID             string     `json:"vmId,omitempty"`      // VM the volume is attached to
+	MountPath        string     `json:"mountPath,omitempty"` // where cloud-init mounted it
+	CreatedAt        time.Time  `json:"createdAt"`
+	UpdatedAt        time.Time  `json:"updatedAt"`
+	DeletedAt        *time.Time `json:"deletedAt,omitempty"`
+}
+
+// VolumeMount attaches a volume to a VM at creation. Cloud-init formats the
+// volume if it is blank and mounts it at MountPath.
+type VolumeMount struct {
+	VolumeID  string `json:"volumeId" binding:"required"`
+	MountPath string `json:"mountPath,omitempty"` // defaults to /mnt/<volumeId>
+}
+
+// VolumeProvider manages the persistent volumes of a cloud provider
+type VolumeProvider interface {
+	// CreateVolume creates an unattached, unformatted volume.
+	CreateVolume(ctx context.Context, req *VolumeRequest) (*Volume, error)
+	DeleteVolume(ctx context.Context, region, id string) error
+	// AttachVolume attaches a volume to a VM in the same region (and zone),
+	// waiting for the VM to boot and the volume to become free first.
+	AttachVolume(ctx context.Context, region, volumeID, vmID string) error
+	DetachVolume(ctx context.Context, region, volumeID string) error
+	// WaitForVolume blocks until the volume is free to attach, e.g. once the
+	// VM holding it was terminated.
+	WaitForVolume(ctx context.Context, region, id string) error
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Webhook event types. They are derived from the VM event log: status
+// changes become the event of the status reached.
+const (
+	WebhookVMCreated         = "vm.created"
+	WebhookVMRunning         = "vm.running"
+	WebhookVMStopped         = "vm.stopped"
+	WebhookVMTerminated      = "vm.terminated"
+	WebhookVMSpotInterrupted = EventSpotInterrupted
+	WebhookVMTTLWarning      = EventTTLWarning
+)
+
+// WebhookEvents lists every event type a webhook can subscribe to
+var WebhookEvents = []string{
+	WebhookVMCreated, WebhookVMRunning, WebhookVMStopped, WebhookVMTerminated,
+	WebhookVMSpotInterrupted, WebhookVMTTLWarning,
+}
+
+// WebhookEventTypes returns the webhook event types a logged VM event
+// triggers, if any.
+func WebhookEventTypes(event VMEvent) []string {
+	switch event.Type {
+	case EventStatusChanged:
+		var types []string
+		if from, _ := event.Data["from"].(string); from == "" {
+			types = append(types, WebhookVMCreated)
+		}
+		switch event.Data["to"] {
+		case "running":
+			types = append(types, WebhookVMRunning)
+		case "stopped":
+			types = append(types, WebhookVMStopped)
+		case "terminated":
+			types = append(types, WebhookVMTerminated)
+		}
+		return types
+	case EventSpotInterrupted, EventTTLWarning:
+		return []string{event.Type}
+	}
+	return nil
+}
+
+// Webhook is a subscription that receives signed POSTs for VM lifecycle
+// events. The secret is only returned when the webhook is created.
+type Webhook struct {
+	ID string `json:"id"`
+	// UserID limits the webhook to one user's VMs; empty means every user
+	UserID    string    `json:"userId,omitempty"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	Secret string `json:"-"`
+}
+
+// Wants reports whether the webhook subscribed to eventType for userID's VMs.
+func (w *Webhook) Wants(eventType, userID string) bool {
+	return (w.UserID == "" || w.UserID == userID) && slices.Contains(w.Events, eventType)
+}
+
+// Webhook delivery statuses. Dead deliveries exhausted their attempts and
+// stay in the dead-letter log until they are redelivered.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// WebhookDelivery is one event to be POSTed to one webhook.
+type WebhookDelivery struct {
+	ID             int64      `json:"id"`
+	WebhookID      string     `json:"webhookId"`
+	EventID        int64      `json:"eventId"`
+	EventType      string     `json:"eventType"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	LastError      string     `json:"lastError,omitempty"`
+	ResponseStatus int        `json:"responseStatus,omitempty"`
+	NextAttemptAt  time.Time  `json:"nextAttemptAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	DeliveredAt    *time.Time `json:"deliveredAt,omitempty"`
+}
@@ -0,0 +1,295 @@
+package operations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/logging"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/store"
+	"vm-provisioner/internal/tracing"
+	"vm-provisioner/internal/utils"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrQueueFull is returned by Submit when no more operations can be queued.
+var ErrQueueFull = errors.New("operation queue is full")
+
+// ErrShuttingDown is returned by Submit once the workers have stopped.
+var ErrShuttingDown = errors.New("the provisioner is shutting down")
+
+// Func performs the work of an operation and returns its JSON-encodable result.
+type Func func(ctx context.Context) (any, error)
+
+// SecretResult is implemented by results that carry secrets, such as a
+// generated SSH password. Only the result without them is stored; the full
+// result is held in memory until the operation is first read.
+type SecretResult interface {
+	// WithoutSecrets returns the result stripped of its secrets, and false
+	// if it carried none.
+	WithoutSecrets() (any, bool)
+}
+
+// secretResultTTL is how long a full result waits to be read before its
+// secrets are dropped.
+const secretResultTTL = time.Hour
+
+type secretResult struct {
+	encoded   []byte
+	expiresAt time.Time
+}
+
+type job struct {
+	id      string
+	opType  string
+	timeout time.Duration
+	fn      Func
+	// logger carries the fields of the submitting request, spanContext
+	// its trace
+	logger      *slog.Logger
+	spanContext trace.SpanContext
+}
+
+// Manager executes operations on a fixed pool of workers and records their
+// progress and outcome in the store.
+type Manager struct {
+	store   *store.Store
+	cfg     config.OperationsConfig
+	jobs    chan job
+	workers sync.WaitGroup
+	stopped chan struct{} // closed once queued jobs are failed after shutdown
+
+	mu      sync.Mutex
+	closed  bool                    // no more jobs are queued
+	secrets map[string]secretResult // operation ID -> full result
+}
+
+func NewManager(st *store.Store, cfg config.OperationsConfig) *Manager {
+	return &Manager{
+		store:   st,
+		cfg:     cfg,
+		jobs:    make(chan job, cfg.QueueSize),
+		stopped: make(chan struct{}),
+		secrets: map[string]secretResult{},
+	}
+}
+
+// Start fails operations left over from a previous run and starts the
+// workers. Workers stop when ctx is canceled; running operations see the
+// cancellation through their context, and queued ones are failed. Cancel
+// ctx only once nothing submits operations anymore, e.g. after the HTTP
+// server shut down.
+func (m *Manager) Start(ctx context.Context) error {
+	n, err := m.store.FailUnfinishedOperations(ctx, models.OperationError{
+		Code:    "interrupted",
+		Message: "the provisioner restarted before the operation finished",
+	})
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		slog.Warn("Marked unfinished operations from a previous run as interrupted", "count", n)
+	}
+
+	m.workers.Add(m.cfg.Workers)
+	for i := 0; i < m.cfg.Workers; i++ {
+		go func() {
+			defer m.workers.Done()
+			m.worker(ctx)
+		}()
+	}
+	go m.shutdown(ctx)
+	slog.Info("Operation workers started", "workers", m.cfg.Workers, "queue_size", m.cfg.QueueSize)
+	return nil
+}
+
+// Submit persists op as queued and schedules fn with the given timeout.
+func (m *Manager) Submit(ctx context.Context, op models.Operation, timeout time.Duration, fn Func) (*models.Operation, error) {
+	op.ID = utils.GenerateID("op")
+	op.Status = models.OperationQueued
+	if err := m.store.CreateOperation(ctx, &op); err != nil {
+		return nil, err
+	}
+
+	logger := logging.FromContext(ctx).With("operation_id", op.ID, "operation", op.Type)
+
+	err := m.enqueue(job{id: op.ID, opType: op.Type, timeout: timeout, fn: fn, logger: logger, spanContext: trace.SpanContextFromContext(ctx)})
+	if err != nil {
+		code := "queue_full"
+		if errors.Is(err, ErrShuttingDown) {
+			code = "shutting_down"
+		}
+		opErr := &models.OperationError{Code: code, Message: err.Error()}
+		if err := m.store.FinishOperation(ctx, op.ID, nil, opErr); err != nil {
+			logger.Error("Failed to record rejected operation", "error", err)
+		}
+		return nil, err
+	}
+	return &op, nil
+}
+
+func (m *Manager) enqueue(j job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrShuttingDown
+	}
+	select {
+	case m.jobs <- j:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// shutdown stops queueing once ctx is canceled and, after the workers
+// returned, fails the jobs they left in the queue.
+func (m *Manager) shutdown(ctx context.Context) {
+	<-ctx.Done()
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+	m.workers.Wait()
+
+	for {
+		select {
+		case j := <-m.jobs:
+			m.drop(ctx, j)
+		default:
+			close(m.stopped)
+			return
+		}
+	}
+}
+
+// drop fails a job that was queued but never started before shutdown.
+func (m *Manager) drop(ctx context.Context, j job) {
+	opErr := &models.OperationError{Code: "shutting_down", Message: "the provisioner shut down before the operation started"}
+	if err := m.store.FinishOperation(context.WithoutCancel(ctx), j.id, nil, opErr); err != nil {
+		j.logger.Error("Failed to record operation dropped at shutdown", "error", err)
+	}
+}
+
+// Wait blocks until the workers stopped after the context passed to Start
+// was canceled, and every operation is recorded as finished or failed.
+func (m *Manager) Wait() {
+	<-m.stopped
+}
+
+func (m *Manager) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-m.jobs:
+			// Both cases may be ready; jobs never start after shutdown
+			if ctx.Err() != nil {
+				m.drop(ctx, j)
+				return
+			}
+			m.run(ctx, j)
+		}
+	}
+}
+
+func (m *Manager) run(ctx context.Context, j job) {
+	if err := m.store.StartOperation(ctx, j.id); err != nil {
+		j.logger.Error("Failed to record operation start", "error", err)
+	}
+
+	opCtx, cancel := context.WithTimeout(ctx, j.timeout)
+	defer cancel()
+	opCtx = context.WithValue(opCtx, reporterKey{}, &reporter{store: m.store, id: j.id})
+	opCtx = logging.WithLogger(opCtx, j.logger)
+
+	// The operation continues the trace of the request that submitted it
+	opCtx, span := tracing.Start(trace.ContextWithSpanContext(opCtx, j.spanContext), "operation "+j.opType,
+		trace.WithAttributes(attribute.String("operation.id", j.id)))
+	result, err := j.fn(opCtx)
+	tracing.End(span, &err)
+
+	var encoded []byte
+	var opErr *models.OperationError
+	if err != nil {
+		opErr = classify(opCtx, err)
+		j.logger.Error("Operation failed", "code", opErr.Code, "error", err)
+	} else if result != nil {
+		if encoded, err = m.encodeResult(j.id, result); err != nil {
+			opErr = &models.OperationError{Code: "internal", Message: fmt.Sprintf("failed to encode result: %v", err)}
+		}
+	}
+
+	// Record the outcome even if the operation ran out of time.
+	if err := m.store.FinishOperation(context.WithoutCancel(ctx), j.id, encoded, opErr); err != nil {
+		j.logger.Error("Failed to record operation outcome", "error", err)
+	}
+}
+
+// encodeResult encodes the result to store. The full result of one with
+// secrets is kept for TakeSecretResult instead.
+func (m *Manager) encodeResult(id string, result any) ([]byte, error) {
+	secret, ok := result.(SecretResult)
+	if !ok {
+		return json.Marshal(result)
+	}
+	stripped, ok := secret.WithoutSecrets()
+	if !ok {
+		return json.Marshal(result)
+	}
+
+	full, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	m.mu.Lock()
+	for opID, held := range m.secrets {
+		if now.After(held.expiresAt) {
+			delete(m.secrets, opID)
+		}
+	}
+	m.secrets[id] = secretResult{encoded: full, expiresAt: now.Add(secretResultTTL)}
+	m.mu.Unlock()
+	return json.Marshal(stripped)
+}
+
+// TakeSecretResult returns the full result of an operation whose stored
+// result had secrets stripped, once: later calls, calls on other instances
+// and calls after secretResultTTL find nothing.
+func (m *Manager) TakeSecretResult(id string) (json.RawMessage, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	held, ok := m.secrets[id]
+	if !ok {
+		return nil, false
+	}
+	delete(m.secrets, id)
+	if time.Now().After(held.expiresAt) {
+		return nil, false
+	}
+	return held.encoded, true
+}
+
+// classify turns an error into the structured error reported to clients.
+// Provider errors of an operation that ran out of time or was canceled are
+// reported as such.
+func classify(ctx context.Context, err error) *models.OperationError {
+	code := models.ErrorCode(err)
+	if code == "provider_error" {
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			code = "timeout"
+		case errors.Is(ctx.Err(), context.Canceled):
+			code = "canceled"
+		}
+	}
+	return &models.OperationError{Code: code, Message: err.Error()}
+}
@@ -0,0 +1,290 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/store"
+)
+
+func newTestManager(t *testing.T, workers, queueSize int) (*Manager, *store.Store) {
+	t.Helper()
+	st, err := store.Open(context.Background(), config.StoreConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return NewManager(st, config.OperationsConfig{Workers: workers, QueueSize: queueSize}), st
+}
+
+// start starts the workers of m and stops them before the store closes.
+func start(t *testing.T, m *Manager) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := m.Start(ctx); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		m.Wait()
+	})
+}
+
+// waitFinished polls the store until the operation succeeded or failed.
+func waitFinished(t *testing.T, st *store.Store, id string) *models.Operation {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		op, err := st.GetOperation(context.Background(), id)
+		if err != nil {
+			t.Fatalf("get operation: %v", err)
+		}
+		if op.Status == models.OperationSucceeded || op.Status == models.OperationFailed {
+			return op
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("operation %s still %s", id, op.Status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// credentials is a result carrying a secret
+type credentials struct {
+	Host     string `json:"host"`
+	Password string `json:"password,omitempty"`
+}
+
+func (c credentials) WithoutSecrets() (any, bool) {
+	if c.Password == "" {
+		return c, false
+	}
+	return credentials{Host: c.Host}, true
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		timeout    time.Duration
+		fn         Func
+		wantStatus string
+		wantResult string
+		wantCode   string
+		wantSecret string // full result handed out once, if any
+	}{
+		{
+			name:       "result",
+			fn:         func(ctx context.Context) (any, error) { return map[string]string{"id": "vm-1"}, nil },
+			wantStatus: models.OperationSucceeded,
+			wantResult: `{"id":"vm-1"}`,
+		},
+		{
+			name:       "no result",
+			fn:         func(ctx context.Context) (any, error) { return nil, nil },
+			wantStatus: models.OperationSucceeded,
+		},
+		{
+			name:       "result without secrets",
+			fn:         func(ctx context.Context) (any, error) { return credentials{Host: "h"}, nil },
+			wantStatus: models.OperationSucceeded,
+			wantResult: `{"host":"h"}`,
+		},
+		{
+			name:       "secrets are kept out of the store",
+			fn:         func(ctx context.Context) (any, error) { return credentials{Host: "h", Password: "hunter2"}, nil },
+			wantStatus: models.OperationSucceeded,
+			wantResult: `{"host":"h"}`,
+			wantSecret: `{"host":"h","password":"hunter2"}`,
+		},
+		{
+			name:       "classified error",
+			fn:         func(ctx context.Context) (any, error) { return nil, fmt.Errorf("lookup: %w", models.ErrVMNotFound) },
+			wantStatus: models.OperationFailed,
+			wantCode:   "not_found",
+		},
+		{
+			name:    "provider error after the deadline",
+			timeout: time.Millisecond,
+			fn: func(ctx context.Context) (any, error) {
+				<-ctx.Done()
+				return nil, errors.New("request aborted")
+			},
+			wantStatus: models.OperationFailed,
+			wantCode:   "timeout",
+		},
+		{
+			name: "progress is recorded",
+			fn: func(ctx context.Context) (any, error) {
+				ReportProgress(ctx, "halfway")
+				return nil, errors.New("boom")
+			},
+			wantStatus: models.OperationFailed,
+			wantCode:   "provider_error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, st := newTestManager(t, 1, 1)
+			start(t, m)
+
+			timeout := tt.timeout
+			if timeout == 0 {
+				timeout = time.Minute
+			}
+			submitted, err := m.Submit(context.Background(), models.Operation{Type: "test"}, timeout, tt.fn)
+			if err != nil {
+				t.Fatalf("submit: %v", err)
+			}
+			op := waitFinished(t, st, submitted.ID)
+
+			if op.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", op.Status, tt.wantStatus)
+			}
+			if string(op.Result) != tt.wantResult {
+				t.Errorf("stored result = %s, want %s", op.Result, tt.wantResult)
+			}
+			if code := ""; op.Error != nil {
+				code = op.Error.Code
+				if code != tt.wantCode {
+					t.Errorf("error code = %s, want %s", code, tt.wantCode)
+				}
+			} else if tt.wantCode != "" {
+				t.Errorf("no error, want %s", tt.wantCode)
+			}
+
+			full, ok := m.TakeSecretResult(op.ID)
+			if ok != (tt.wantSecret != "") || string(full) != tt.wantSecret {
+				t.Errorf("TakeSecretResult = %s, %v, want %s", full, ok, tt.wantSecret)
+			}
+			if _, ok := m.TakeSecretResult(op.ID); ok {
+				t.Error("full result was handed out twice")
+			}
+		})
+	}
+}
+
+func TestSecretResultExpires(t *testing.T) {
+	m, _ := newTestManager(t, 1, 1)
+	if _, err := m.encodeResult("op_old", credentials{Host: "h", Password: "p"}); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	m.mu.Lock()
+	held := m.secrets["op_old"]
+	held.expiresAt = time.Now().Add(-time.Second)
+	m.secrets["op_old"] = held
+	m.mu.Unlock()
+
+	if _, ok := m.TakeSecretResult("op_old"); ok {
+		t.Error("expired full result was handed out")
+	}
+
+	// Expired results are dropped when the next one is held
+	m.encodeResult("op_expired", credentials{Host: "h", Password: "p"})
+	m.mu.Lock()
+	held = m.secrets["op_expired"]
+	held.expiresAt = time.Now().Add(-time.Second)
+	m.secrets["op_expired"] = held
+	m.mu.Unlock()
+	m.encodeResult("op_new", credentials{Host: "h", Password: "p"})
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.secrets["op_expired"]; ok {
+		t.Error("expired full result is still held")
+	}
+}
+
+func TestSubmitQueueFull(t *testing.T) {
+	m, _ := newTestManager(t, 1, 1)
+	start(t, m)
+	ctx := context.Background()
+
+	// Occupy the worker, then the single queue slot
+	release := make(chan struct{})
+	started := make(chan struct{})
+	m.Submit(ctx, models.Operation{Type: "test"}, time.Minute, func(ctx context.Context) (any, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	<-started
+	defer close(release)
+	if _, err := m.Submit(ctx, models.Operation{Type: "test"}, time.Minute, func(ctx context.Context) (any, error) { return nil, nil }); err != nil {
+		t.Fatalf("submit to queue: %v", err)
+	}
+
+	op, err := m.Submit(ctx, models.Operation{Type: "test"}, time.Minute, func(ctx context.Context) (any, error) { return nil, nil })
+	if !errors.Is(err, ErrQueueFull) || op != nil {
+		t.Fatalf("submit to full queue = %v, %v, want ErrQueueFull", op, err)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	m, st := newTestManager(t, 1, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := m.Start(ctx); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	// A running operation sees the cancellation, a queued one never starts
+	started := make(chan struct{})
+	running, err := m.Submit(context.Background(), models.Operation{Type: "test"}, time.Minute, func(ctx context.Context) (any, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	<-started
+	ran := false
+	queued, err := m.Submit(context.Background(), models.Operation{Type: "test"}, time.Minute, func(ctx context.Context) (any, error) {
+		ran = true
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		m.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait did not return after shutdown")
+	}
+
+	tests := []struct {
+		id       string
+		wantCode string
+	}{
+		{running.ID, "canceled"},
+		{queued.ID, "shutting_down"},
+	}
+	for _, tt := range tests {
+		op, err := st.GetOperation(context.Background(), tt.id)
+		if err != nil {
+			t.Fatalf("get operation: %v", err)
+		}
+		if op.Status != models.OperationFailed || op.Error == nil || op.Error.Code != tt.wantCode {
+			t.Errorf("operation %s = %s (%+v), want failed with %s", tt.id, op.Status, op.Error, tt.wantCode)
+		}
+	}
+	if ran {
+		t.Error("queued operation ran after shutdown")
+	}
+
+	op, err := m.Submit(context.Background(), models.Operation{Type: "test"}, time.Minute, func(ctx context.Context) (any, error) { return nil, nil })
+	if !errors.Is(err, ErrShuttingDown) || op != nil {
+		t.Fatalf("submit after shutdown = %v, %v, want ErrShuttingDown", op, err)
+	}
+}
@@ -0,0 +1,39 @@
+package operations
+
+import (
+	"context"
+
+	"vm-provisioner/internal/logging"
+	"vm-provisioner/internal/store"
+)
+
+type reporterKey struct{}
+
+type reporter struct {
+	store *store.Store
+	id    string
+}
+
+// ReportProgress records a progress message on the operation running in ctx.
+// Outside an operation it does nothing, so providers can call it freely.
+func ReportProgress(ctx context.Context, message string) {
+	r, ok := ctx.Value(reporterKey{}).(*reporter)
+	if !ok {
+		return
+	}
+	if err := r.store.UpdateOperationProgress(context.WithoutCancel(ctx), r.id, message); err != nil {
+		logging.FromContext(ctx).Error("Failed to record operation progress", "error", err)
+	}
+}
+
+// LinkVM records the VM an operation acts on once it is known, e.g. after
+// the provider assigned the ID of a newly created VM.
+func LinkVM(ctx context.Context, vmID string) {
+	r, ok := ctx.Value(reporterKey{}).(*reporter)
+	if !ok {
+		return
+	}
+	if err := r.store.SetOperationVM(context.WithoutCancel(ctx), r.id, vmID); err != nil {
+		logging.FromContext(ctx).Error("Failed to link operation to VM", "vm_id", vmID, "error", err)
+	}
+}
@@ -0,0 +1,76 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/store"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestOperationContinuesTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	st, err := store.Open(context.Background(), config.StoreConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer st.Close()
+	m := NewManager(st, config.OperationsConfig{Workers: 1, QueueSize: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := m.Start(ctx); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	// The request ends its span before the operation runs
+	reqCtx, request := provider.Tracer("test").Start(context.Background(), "POST /vm/create")
+	op, err := m.Submit(reqCtx, models.Operation{Type: "vm.create"}, time.Minute, func(ctx context.Context) (any, error) {
+		return nil, errors.New("quota exceeded")
+	})
+	request.End()
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		stored, err := st.GetOperation(context.Background(), op.ID)
+		if err != nil {
+			t.Fatalf("get operation: %v", err)
+		}
+		if stored.Status == models.OperationFailed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("operation still %s", stored.Status)
+		}
+	}
+
+	var span sdktrace.ReadOnlySpan
+	for _, ended := range recorder.Ended() {
+		if ended.Name() == "operation vm.create" {
+			span = ended
+		}
+	}
+	if span == nil {
+		t.Fatal("operation was not traced")
+	}
+	if span.Parent().SpanID() != request.SpanContext().SpanID() || span.SpanContext().TraceID() != request.SpanContext().TraceID() {
+		t.Error("operation span is not a child of the request span")
+	}
+	if span.Status().Code != codes.Error {
+		t.Errorf("status = %v, want the error of the operation", span.Status())
+	}
+}
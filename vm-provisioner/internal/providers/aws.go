@@ -4,21 +4,31 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/logging"
 	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/operations"
+	"vm-provisioner/internal/tracing"
 	"vm-provisioner/internal/utils"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type AWSProvider struct {
-	client *ec2.Client
+	awsCfg aws.Config
 	config config.AWSConfig
+
+	mu      sync.Mutex
+	clients map[string]*ec2.Client // region -> client
 }
 
 var awsGPUInstances = map[string]bool{
@@ -44,17 +54,24 @@ var awsGPUInstances = map[string]bool{
 	"g5.48xlarge":    true,
 }
 
+func init() {
+	Register("aws", models.ProviderCapabilities{GPU: true, Spot: true, Snapshots: true},
+		func(cfg *config.Config) (models.CloudProvider, error) { return NewAWSProvider(cfg.AWS) })
+}
+
 func NewAWSProvider(cfg config.AWSConfig) (*AWSProvider, error) {
 	awsCfg, err := awsconfig.LoadDefaultConfig(context.TODO(),
 		awsconfig.WithRegion(cfg.Region),
+		awsconfig.WithAPIOptions([]func(*middleware.Stack) error{traceAPICalls}),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
 
 	return &AWSProvider{
-		client: ec2.NewFromConfig(awsCfg),
-		config: cfg,
+		awsCfg:  awsCfg,
+		config:  cfg,
+		clients: make(map[string]*ec2.Client),
 	}, nil
 }
 
@@ -67,56 +84,55 @@ func (p *AWSProvider) SupportsInstanceType(instanceType string) bool {
 		awsGPUInstances[instanceType]
 }
 
-func (p *AWSProvider) CreateVM(req *models.VMRequest) (*models.VMResponse, error) {
-	// Generate SSH credentials
-	sshPassword := utils.GenerateRandomPassword(16)
+func (p *AWSProvider) IsGPUInstanceType(instanceType string) bool {
+	return awsGPUInstances[instanceType]
+}
+
+func (p *AWSProvider) CreateVM(ctx context.Context, req *models.VMRequest) (*models.VMResponse, error) {
+	region, err := p.resolveRegion(req.Region)
+	if err != nil {
+		return nil, err
+	}
+	client := p.clientFor(region)
+
+	// Generate a password only if the caller opted in to password login
+	sshPassword := ""
+	if req.EnablePasswordAuth {
+		sshPassword = utils.GenerateRandomPassword(16)
+	}
 	
 	// Get the correct AMI for the region
+	operations.ReportProgress(ctx, "resolving AMI in "+region)
 	ami := req.Image
 	if ami == "" {
-		var err error
-		if awsGPUInstances[req.InstanceType] {
-			// Find latest Deep Learning AMI
-			ami, err = p.getLatestDeepLearningAMI(req.Region)
-			if err != nil {
-				fmt.Printf("⚠️  Deep Learning AMI not found, falling back to Ubuntu: %v\n", err)
-				// Fallback to Ubuntu if Deep Learning AMI not found
-				ami, err = p.getLatestUbuntuAMI(req.Region)
-				if err != nil {
-					return nil, fmt.Errorf("failed to find suitable AMI: %w", err)
-				}
-			}
-		} else {
-			// Find latest Ubuntu 20.04 LTS
-			ami, err = p.getLatestUbuntuAMI(req.Region)
-			if err != nil {
-				return nil, fmt.Errorf("failed to find Ubuntu AMI: %w", err)
-			}
+		ami, err = p.defaultAMI(ctx, region, req.InstanceType)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	fmt.Printf("🖼️  Using AMI: %s for region %s\n", ami, req.Region)
+	logging.FromContext(ctx).Info("Using AMI", "ami", ami, "region", region)
 
-	// Create or get security group that allows SSH
-	securityGroupID, err := p.ensureSSHSecurityGroup()
+	// Every VM gets its own security group holding its firewall policy
+	operations.ReportProgress(ctx, "creating security group")
+	vpcID, err := defaultVPC(ctx, client)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create security group: %w", err)
+		return nil, err
+	}
+	securityGroupID, err := createSecurityGroup(ctx, client, vpcID, req.UserID, req.Firewall)
+	if err != nil {
+		return nil, err
 	}
 
 	// Determine the correct username for the AMI
-	sshUsername := "ec2-user" // Amazon Linux 2 default
-	if strings.Contains(strings.ToLower(ami), "ubuntu") {
-		sshUsername = "ubuntu"
+	sshUsername := req.SSHUsername
+	if sshUsername == "" {
+		sshUsername = p.sshUsernameForAMI(ctx, client, ami)
 	}
 
 	// Generate cloud-init script
 	cloudInitScript := fmt.Sprintf(`#!/bin/bash
-# Set up SSH access for %s user
-echo '%s:%s' | chpasswd
-sed -i 's/PasswordAuthentication no/PasswordAuthentication yes/' /etc/ssh/sshd_config
-sed -i 's/#PasswordAuthentication yes/PasswordAuthentication yes/' /etc/ssh/sshd_config
-systemctl restart sshd
-
+%s
 # Install basic tools (detect package manager)
 if command -v yum &> /dev/null; then
     # Amazon Linux 2
@@ -141,7 +157,7 @@ cat > /etc/motd << 'EOF'
 Instance Type: %s
 Provider: AWS
 SSH Username: %s
-SSH Password: %s
+%s
 
 Commands to try:
 - htop: System monitoring
@@ -152,7 +168,8 @@ Happy coding! 🎉
 EOF
 
 echo "✅ VM setup complete!"
-`, sshUsername, sshUsername, sshPassword, req.InstanceType, sshUsername, sshPassword)
+`, sshAccessScript(sshUsername, "/home/"+sshUsername, req.SSHPublicKeys, sshPassword)+volumeMountScript(req.Volumes, awsVolumeDevicePaths),
+		req.InstanceType, sshUsername, motdLoginLine(sshPassword))
 
 	// Create EC2 instance
 	runInput := &ec2.RunInstancesInput{
@@ -175,6 +192,16 @@ echo "✅ VM setup complete!"
 		},
 	}
 
+	// Let EC2 deduplicate retried creates
+	if req.ClientToken != "" {
+		runInput.ClientToken = aws.String(req.ClientToken)
+	}
+
+	// Pin the instance to a zone of the region
+	if req.AvailabilityZone != "" {
+		runInput.Placement = &types.Placement{AvailabilityZone: aws.String(req.AvailabilityZone)}
+	}
+
 	// Handle spot instances
 	if req.UseSpotInstance {
 		runInput.InstanceMarketOptions = &types.InstanceMarketOptionsRequest{
@@ -185,14 +212,54 @@ echo "✅ VM setup complete!"
 		}
 	}
 
-	result, err := p.client.RunInstances(context.TODO(), runInput)
+	operations.ReportProgress(ctx, "launching EC2 instance")
+	result, err := client.RunInstances(ctx, runInput)
 	if err != nil {
+		deleteSecurityGroup(context.WithoutCancel(ctx), client, securityGroupID)
+		if isInsufficientCapacity(err) {
+			return nil, fmt.Errorf("failed to create EC2 instance in %s: %w: %w", region, models.ErrInsufficientCapacity, err)
+		}
 		return nil, fmt.Errorf("failed to create EC2 instance: %w", err)
 	}
 
 	instance := result.Instances[0]
 	instanceID := *instance.InstanceId
 
+	// A replayed client token returns the instance of the original request,
+	// which has its own security group; the one created above goes unused
+	if groupID, replayed := replayedSecurityGroup(instance, securityGroupID); replayed {
+		logging.FromContext(ctx).Info("EC2 returned the instance of an earlier request with this client token",
+			"vm_id", instanceID, "security_group", groupID)
+		deleteSecurityGroup(context.WithoutCancel(ctx), client, securityGroupID)
+		securityGroupID = groupID
+	}
+
+	if _, err := client.CreateTags(ctx, &ec2.CreateTagsInput{
+		Resources: []string{securityGroupID},
+		Tags:      []types.Tag{{Key: aws.String("InstanceID"), Value: aws.String(instanceID)}},
+	}); err != nil {
+		logging.FromContext(ctx).Warn("Failed to tag security group", "security_group", securityGroupID, "error", err)
+	}
+
+	// EC2 attaches existing volumes only after launch; without them the
+	// instance is of no use, so it does not outlive a failed attach
+	if len(req.Volumes) > 0 {
+		if err := attachVolumesAtLaunch(ctx, client, instanceID, req.Volumes); err != nil {
+			if _, termErr := client.TerminateInstances(context.WithoutCancel(ctx), &ec2.TerminateInstancesInput{
+				InstanceIds: []string{instanceID},
+			}); termErr != nil {
+				logging.FromContext(ctx).Error("Failed to terminate instance after failed volume attach", "vm_id", instanceID, "error", termErr)
+			} else {
+				go deleteSecurityGroupAfterTermination(context.WithoutCancel(ctx), client, instanceID, securityGroupID)
+			}
+			return nil, err
+		}
+	}
+	availabilityZone := ""
+	if instance.Placement != nil {
+		availabilityZone = aws.ToString(instance.Placement.AvailabilityZone)
+	}
+
 	// For now, don't allocate Elastic IP - use the instance's natural public IP
 	// The monitoring will update the correct IP when the instance is running
 
@@ -201,46 +268,46 @@ echo "✅ VM setup complete!"
 		Name:         req.Name,
 		Provider:     "aws",
 		InstanceType: req.InstanceType,
-		Region:       req.Region,
+		Region:       region,
 		Status:       "pending",
 		PublicIP:     "", // Will be updated when instance is running
 		SSHUsername:  sshUsername,
 		SSHPassword:  sshPassword,
 		Image:        ami,
 		CreatedAt:    time.Now(),
+
+		AvailabilityZone: availabilityZone,
 	}, nil
 }
 
-func (p *AWSProvider) DeleteVM(id string) error {
-	// Get instance details to find associated Elastic IP
-	describeResult, err := p.client.DescribeInstances(context.TODO(), &ec2.DescribeInstancesInput{
-		InstanceIds: []string{id},
-	})
+func (p *AWSProvider) DeleteVM(ctx context.Context, region, id string) error {
+	// Get instance details (and the region it lives in) to find associated Elastic IP
+	client, instance, err := p.locateInstance(ctx, region, id)
 	if err != nil {
-		return fmt.Errorf("failed to describe instance: %w", err)
+		return err
 	}
 
 	// Release Elastic IP if associated
-	if len(describeResult.Reservations) > 0 && len(describeResult.Reservations[0].Instances) > 0 {
-		instance := describeResult.Reservations[0].Instances[0]
-		if instance.PublicIpAddress != nil {
-			// Find and release the Elastic IP
-			addressesResult, err := p.client.DescribeAddresses(context.TODO(), &ec2.DescribeAddressesInput{
-				PublicIps: []string{*instance.PublicIpAddress},
-			})
-			if err == nil && len(addressesResult.Addresses) > 0 {
-				allocationID := addressesResult.Addresses[0].AllocationId
-				if allocationID != nil {
-					p.client.ReleaseAddress(context.TODO(), &ec2.ReleaseAddressInput{
-						AllocationId: allocationID,
-					})
-				}
+	if instance.PublicIpAddress != nil {
+		// Find and release the Elastic IP
+		addressesResult, err := client.DescribeAddresses(ctx, &ec2.DescribeAddressesInput{
+			PublicIps: []string{*instance.PublicIpAddress},
+		})
+		if err == nil && len(addressesResult.Addresses) > 0 {
+			allocationID := addressesResult.Addresses[0].AllocationId
+			if allocationID != nil {
+				client.ReleaseAddress(ctx, &ec2.ReleaseAddressInput{
+					AllocationId: allocationID,
+				})
 			}
 		}
 	}
 
+	// Free the VM's own security group
+	releaseFirewall(ctx, client, instance)
+
 	// Terminate the instance
-	_, err = p.client.TerminateInstances(context.TODO(), &ec2.TerminateInstancesInput{
+	_, err = client.TerminateInstances(ctx, &ec2.TerminateInstancesInput{
 		InstanceIds: []string{id},
 	})
 	if err != nil {
@@ -250,32 +317,13 @@ func (p *AWSProvider) DeleteVM(id string) error {
 	return nil
 }
 
-func (p *AWSProvider) GetVMStatus(id string) (*models.VMStatus, error) {
-	result, err := p.client.DescribeInstances(context.TODO(), &ec2.DescribeInstancesInput{
-		InstanceIds: []string{id},
-	})
+func (p *AWSProvider) GetVMStatus(ctx context.Context, region, id string) (*models.VMStatus, error) {
+	client, instance, err := p.locateInstance(ctx, region, id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to describe instance: %w", err)
+		return nil, err
 	}
 
-	if len(result.Reservations) == 0 || len(result.Reservations[0].Instances) == 0 {
-		return nil, fmt.Errorf("instance not found")
-	}
-
-	instance := result.Reservations[0].Instances[0]
-	status := string(instance.State.Name)
-	
-	// Convert AWS states to our standard states
-	switch status {
-	case "pending":
-		status = "pending"
-	case "running":
-		status = "running"
-	case "stopping", "stopped":
-		status = "stopped"
-	case "terminating", "terminated":
-		status = "terminated"
-	}
+	status := normalizeAWSState(instance.State.Name)
 
 	publicIP := ""
 	if instance.PublicIpAddress != nil {
@@ -284,26 +332,76 @@ func (p *AWSProvider) GetVMStatus(id string) (*models.VMStatus, error) {
 
 	return &models.VMStatus{
 		ID:        id,
+		Region:    client.Options().Region,
 		Status:    status,
 		PublicIP:  publicIP,
+		UserID:    tagValue(instance.Tags, "UserID"),
 		UpdatedAt: time.Now(),
 	}, nil
 }
 
+// tagValue returns the value of the tag with the given key, or "".
+func tagValue(tags []types.Tag, key string) string {
+	for _, tag := range tags {
+		if aws.ToString(tag.Key) == key {
+			return aws.ToString(tag.Value)
+		}
+	}
+	return ""
+}
+
+// normalizeAWSState converts AWS states to our standard states
+func normalizeAWSState(state types.InstanceStateName) string {
+	status := string(state)
+	switch status {
+	case "pending":
+		status = "pending"
+	case "running":
+		status = "running"
+	case "stopping":
+		status = "stopping"
+	case "stopped":
+		status = "stopped"
+	case "shutting-down", "terminating", "terminated":
+		status = "terminated"
+	}
+	return status
+}
+
 // Helper function to find the latest Ubuntu 20.04 LTS AMI
-func (p *AWSProvider) getLatestUbuntuAMI(region string) (string, error) {
+func (p *AWSProvider) getLatestUbuntuAMI(ctx context.Context, region string) (string, error) {
 	// Try Amazon Linux 2 first (more stable and widely available)
-	ami, err := p.searchAMI("amzn2-ami-hvm-*-x86_64-gp2", "amazon")
+	ami, err := p.searchAMI(ctx, region, "amzn2-ami-hvm-*-x86_64-gp2", "amazon")
 	if err == nil {
 		return ami, nil
 	}
 	
 	// Fallback to Ubuntu
-	return p.searchAMI("ubuntu/images/hvm-ssd/ubuntu-focal-20.04-amd64-server-*", "099720109477")
+	return p.searchAMI(ctx, region, "ubuntu/images/hvm-ssd/ubuntu-focal-20.04-amd64-server-*", "099720109477")
+}
+
+// defaultAMI picks the image for requests without one: the latest Deep
+// Learning AMI for GPU instances, Ubuntu otherwise.
+func (p *AWSProvider) defaultAMI(ctx context.Context, region, instanceType string) (string, error) {
+	if awsGPUInstances[instanceType] {
+		// Find latest Deep Learning AMI
+		ami, err := p.getLatestDeepLearningAMI(ctx, region)
+		if err == nil {
+			return ami, nil
+		}
+		logging.FromContext(ctx).Warn("Deep Learning AMI not found, falling back to Ubuntu", "region", region, "error", err)
+	}
+
+	// Find latest Ubuntu 20.04 LTS
+	ami, err := p.getLatestUbuntuAMI(ctx, region)
+	if err != nil {
+		return "", fmt.Errorf("failed to find Ubuntu AMI: %w", err)
+	}
+	return ami, nil
 }
 
 // Helper function to find the latest Deep Learning AMI
-func (p *AWSProvider) getLatestDeepLearningAMI(region string) (string, error) {
+func (p *AWSProvider) getLatestDeepLearningAMI(ctx context.Context, region string) (string, error) {
 	// Try various Deep Learning AMI patterns
 	patterns := []string{
 		"Deep Learning AMI (Ubuntu 20.04)*",
@@ -312,18 +410,24 @@ func (p *AWSProvider) getLatestDeepLearningAMI(region string) (string, error) {
 	}
 	
 	for _, pattern := range patterns {
-		ami, err := p.searchAMI(pattern, "amazon")
+		ami, err := p.searchAMI(ctx, region, pattern, "amazon")
 		if err == nil {
 			return ami, nil
 		}
 	}
 	
 	// If no Deep Learning AMI found, fallback to regular Ubuntu
-	return p.getLatestUbuntuAMI(region)
+	return p.getLatestUbuntuAMI(ctx, region)
 }
 
 // Generic AMI search function
-func (p *AWSProvider) searchAMI(namePattern, owner string) (string, error) {
+func (p *AWSProvider) searchAMI(ctx context.Context, region, namePattern, owner string) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "aws.searchAMI", trace.WithAttributes(
+		attribute.String("aws.ami.name_pattern", namePattern),
+		attribute.String("aws.ami.owner", owner),
+	))
+	defer tracing.End(span, &err)
+
 	input := &ec2.DescribeImagesInput{
 		Filters: []types.Filter{
 			{
@@ -338,7 +442,7 @@ func (p *AWSProvider) searchAMI(namePattern, owner string) (string, error) {
 		Owners: []string{owner},
 	}
 
-	result, err := p.client.DescribeImages(context.TODO(), input)
+	result, err := p.clientFor(region).DescribeImages(ctx, input)
 	if err != nil {
 		return "", fmt.Errorf("failed to search for AMI: %w", err)
 	}
@@ -358,89 +462,4 @@ func (p *AWSProvider) searchAMI(namePattern, owner string) (string, error) {
 	}
 
 	return *latestAMI.ImageId, nil
-}
-
-// ensureSSHSecurityGroup creates or gets a security group that allows SSH access
-func (p *AWSProvider) ensureSSHSecurityGroup() (string, error) {
-	ctx := context.TODO()
-	
-	// Try to find existing security group
-	groupName := "wolkenlauf-ssh-access"
-	describeResult, err := p.client.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{
-		Filters: []types.Filter{
-			{
-				Name:   aws.String("group-name"),
-				Values: []string{groupName},
-			},
-		},
-	})
-	
-	if err == nil && len(describeResult.SecurityGroups) > 0 {
-		// Security group already exists
-		return *describeResult.SecurityGroups[0].GroupId, nil
-	}
-	
-	// Get default VPC
-	vpcs, err := p.client.DescribeVpcs(ctx, &ec2.DescribeVpcsInput{
-		Filters: []types.Filter{
-			{
-				Name:   aws.String("is-default"),
-				Values: []string{"true"},
-			},
-		},
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to find default VPC: %w", err)
-	}
-	
-	if len(vpcs.Vpcs) == 0 {
-		return "", fmt.Errorf("no default VPC found")
-	}
-	
-	vpcID := *vpcs.Vpcs[0].VpcId
-	
-	// Create security group
-	createResult, err := p.client.CreateSecurityGroup(ctx, &ec2.CreateSecurityGroupInput{
-		GroupName:   aws.String(groupName),
-		Description: aws.String("Wolkenlauf SSH access security group"),
-		VpcId:       aws.String(vpcID),
-		TagSpecifications: []types.TagSpecification{
-			{
-				ResourceType: types.ResourceTypeSecurityGroup,
-				Tags: []types.Tag{
-					{Key: aws.String("Name"), Value: aws.String(groupName)},
-					{Key: aws.String("ManagedBy"), Value: aws.String("wolkenlauf")},
-				},
-			},
-		},
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to create security group: %w", err)
-	}
-	
-	securityGroupID := *createResult.GroupId
-	
-	// Add SSH rule (port 22)
-	_, err = p.client.AuthorizeSecurityGroupIngress(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
-		GroupId: aws.String(securityGroupID),
-		IpPermissions: []types.IpPermission{
-			{
-				IpProtocol: aws.String("tcp"),
-				FromPort:   aws.Int32(22),
-				ToPort:     aws.Int32(22),
-				IpRanges: []types.IpRange{
-					{
-						CidrIp:      aws.String("0.0.0.0/0"),
-						Description: aws.String("SSH access from anywhere"),
-					},
-				},
-			},
-		},
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to add SSH rule: %w", err)
-	}
-	
-	fmt.Printf("🔒 Created security group %s with SSH access\n", securityGroupID)
-	return securityGroupID, nil
 }
\ No newline at end of file
@@ -0,0 +1,229 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"vm-provisioner/internal/models"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// awsOnDemandPrices are us-east-1 Linux on-demand list prices in USD per
+// hour. EC2 has no pricing call of its own, so other regions use these as
+// an estimate; spot prices are always looked up live.
+var awsOnDemandPrices = map[string]float64{
+	"t2.micro":      0.0116,
+	"t2.small":      0.023,
+	"t2.medium":     0.0464,
+	"t2.large":      0.0928,
+	"t2.xlarge":     0.1856,
+	"t2.2xlarge":    0.3712,
+	"t3.nano":       0.0052,
+	"t3.micro":      0.0104,
+	"t3.small":      0.0208,
+	"t3.medium":     0.0416,
+	"t3.large":      0.0832,
+	"t3.xlarge":     0.1664,
+	"t3.2xlarge":    0.3328,
+	"m5.large":      0.096,
+	"m5.xlarge":     0.192,
+	"m5.2xlarge":    0.384,
+	"m5.4xlarge":    0.768,
+	"m5.8xlarge":    1.536,
+	"m5.12xlarge":   2.304,
+	"m5.16xlarge":   3.072,
+	"m5.24xlarge":   4.608,
+	"c5.large":      0.085,
+	"c5.xlarge":     0.17,
+	"c5.2xlarge":    0.34,
+	"c5.4xlarge":    0.68,
+	"c5.9xlarge":    1.53,
+	"c5.12xlarge":   2.04,
+	"c5.18xlarge":   3.06,
+	"c5.24xlarge":   4.08,
+	"g4dn.xlarge":   0.526,
+	"g4dn.2xlarge":  0.752,
+	"g4dn.4xlarge":  1.204,
+	"g4dn.8xlarge":  2.176,
+	"g4dn.12xlarge": 3.912,
+	"g4dn.16xlarge": 4.352,
+	"g4dn.metal":    7.824,
+	"p3.2xlarge":    3.06,
+	"p3.8xlarge":    12.24,
+	"p3.16xlarge":   24.48,
+	"p3dn.24xlarge": 31.212,
+	"p4d.24xlarge":  32.7726,
+	"g5.xlarge":     1.006,
+	"g5.2xlarge":    1.212,
+	"g5.4xlarge":    1.624,
+	"g5.8xlarge":    2.448,
+	"g5.12xlarge":   5.672,
+	"g5.16xlarge":   4.096,
+	"g5.24xlarge":   8.144,
+	"g5.48xlarge":   16.288,
+}
+
+// awsCatalogFilter matches the families SupportsInstanceType accepts.
+var awsCatalogFilter = []string{"t2.*", "t3.*", "m5.*", "c5.*", "g4dn.*", "g5.*", "p3.*", "p3dn.*", "p4d.*"}
+
+// ListInstanceTypes describes the supported instance types offered in region
+// and adds the current spot prices there.
+func (p *AWSProvider) ListInstanceTypes(ctx context.Context, region string) ([]models.InstanceTypeSpec, error) {
+	region, err := p.resolveRegion(region)
+	if err != nil {
+		return nil, err
+	}
+	client := p.clientFor(region)
+
+	var specs []models.InstanceTypeSpec
+	paginator := ec2.NewDescribeInstanceTypesPaginator(client, &ec2.DescribeInstanceTypesInput{
+		Filters: []types.Filter{{Name: aws.String("instance-type"), Values: awsCatalogFilter}},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe instance types in %s: %w", region, err)
+		}
+		for _, info := range page.InstanceTypes {
+			if p.SupportsInstanceType(string(info.InstanceType)) {
+				specs = append(specs, instanceTypeSpec(region, info))
+			}
+		}
+	}
+
+	spotPrices, err := p.spotPrices(ctx, client, specs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range specs {
+		specs[i].SpotPrice = spotPrices[specs[i].Name]
+	}
+	return specs, nil
+}
+
+func instanceTypeSpec(region string, info types.InstanceTypeInfo) models.InstanceTypeSpec {
+	spec := models.InstanceTypeSpec{
+		Provider:     "aws",
+		Name:         string(info.InstanceType),
+		Region:       region,
+		Architecture: models.ArchX86_64,
+		HourlyPrice:  awsOnDemandPrices[string(info.InstanceType)],
+		Currency:     "USD",
+	}
+	if info.VCpuInfo != nil {
+		spec.VCPUs = int(aws.ToInt32(info.VCpuInfo.DefaultVCpus))
+	}
+	if info.MemoryInfo != nil {
+		spec.MemoryGiB = float64(aws.ToInt64(info.MemoryInfo.SizeInMiB)) / 1024
+	}
+	if info.ProcessorInfo != nil {
+		for _, arch := range info.ProcessorInfo.SupportedArchitectures {
+			if arch == types.ArchitectureTypeArm64 {
+				spec.Architecture = models.ArchARM64
+			}
+		}
+	}
+	if info.GpuInfo != nil {
+		for _, gpu := range info.GpuInfo.Gpus {
+			spec.GPUs += int(aws.ToInt32(gpu.Count))
+			spec.GPUModel = aws.ToString(gpu.Manufacturer) + " " + aws.ToString(gpu.Name)
+		}
+		spec.GPUMemoryGiB = float64(aws.ToInt32(info.GpuInfo.TotalGpuMemoryInMiB)) / 1024
+	}
+	return spec
+}
+
+// spotPrices returns the lowest current Linux spot price per instance type
+// across the zones of the client's region.
+func (p *AWSProvider) spotPrices(ctx context.Context, client *ec2.Client, specs []models.InstanceTypeSpec) (map[string]float64, error) {
+	prices := map[string]float64{}
+	if len(specs) == 0 {
+		return prices, nil
+	}
+
+	instanceTypes := make([]types.InstanceType, len(specs))
+	for i, spec := range specs {
+		instanceTypes[i] = types.InstanceType(spec.Name)
+	}
+
+	// Without a start time in the past EC2 only returns the current price per zone
+	paginator := ec2.NewDescribeSpotPriceHistoryPaginator(client, &ec2.DescribeSpotPriceHistoryInput{
+		InstanceTypes:       instanceTypes,
+		ProductDescriptions: []string{"Linux/UNIX"},
+		StartTime:           aws.Time(time.Now()),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up spot prices in %s: %w", client.Options().Region, err)
+		}
+		for _, sp := range page.SpotPriceHistory {
+			price, err := strconv.ParseFloat(aws.ToString(sp.SpotPrice), 64)
+			if err != nil {
+				continue
+			}
+			name := string(sp.InstanceType)
+			if current, ok := prices[name]; !ok || price < current {
+				prices[name] = price
+			}
+		}
+	}
+	return prices, nil
+}
+
+// Region-independent AWS list prices in USD that EC2 cannot look up
+const (
+	awsPublicIPv4Hourly = 0.005 // per in-use public IPv4 address
+	awsHoursPerMonth    = 730
+)
+
+// awsEBSMonthlyPerGiB are us-east-1 EBS prices per GiB-month by volume type
+var awsEBSMonthlyPerGiB = map[types.VolumeType]float64{
+	types.VolumeTypeGp2:      0.10,
+	types.VolumeTypeGp3:      0.08,
+	types.VolumeTypeIo1:      0.125,
+	types.VolumeTypeIo2:      0.125,
+	types.VolumeTypeSt1:      0.045,
+	types.VolumeTypeSc1:      0.015,
+	types.VolumeTypeStandard: 0.05,
+}
+
+// PriceResources sizes the root EBS volume from the AMI the VM would boot
+// and prices it together with the public IPv4 address.
+func (p *AWSProvider) PriceResources(ctx context.Context, req *models.VMRequest) (*models.ResourcePrices, error) {
+	region, err := p.resolveRegion(req.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	ami := req.Image
+	if ami == "" {
+		if ami, err = p.defaultAMI(ctx, region, req.InstanceType); err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := p.clientFor(region).DescribeImages(ctx, &ec2.DescribeImagesInput{ImageIds: []string{ami}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe AMI %s: %w", ami, err)
+	}
+	if len(result.Images) == 0 {
+		return nil, fmt.Errorf("AMI %s not found in %s", ami, region)
+	}
+
+	prices := &models.ResourcePrices{PublicIPv4Hourly: awsPublicIPv4Hourly, Currency: "USD"}
+	image := result.Images[0]
+	for _, mapping := range image.BlockDeviceMappings {
+		if mapping.Ebs == nil || aws.ToString(mapping.DeviceName) != aws.ToString(image.RootDeviceName) {
+			continue
+		}
+		prices.DiskGiB = int(aws.ToInt32(mapping.Ebs.VolumeSize))
+		prices.StorageHourly = float64(prices.DiskGiB) * awsEBSMonthlyPerGiB[mapping.Ebs.VolumeType] / awsHoursPerMonth
+	}
+	return prices, nil
+}
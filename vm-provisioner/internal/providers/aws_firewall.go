@@ -0,0 +1,228 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"vm-provisioner/internal/logging"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/tracing"
+	"vm-provisioner/internal/utils"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// vmFirewallPrefix names the firewalls dedicated to a single VM, as opposed
+// to the shared wolkenlauf-ssh-access group of older VMs.
+const vmFirewallPrefix = "wolkenlauf-vm"
+
+func isVMFirewall(name string) bool {
+	return strings.HasPrefix(name, vmFirewallPrefix+"_")
+}
+
+// SetFirewall replaces the VM's security group with a new one holding the
+// policy, so the instance never runs with half-applied rules.
+func (p *AWSProvider) SetFirewall(ctx context.Context, region, vmID string, policy *models.FirewallPolicy) error {
+	client, instance, err := p.locateInstance(ctx, region, vmID)
+	if err != nil {
+		return err
+	}
+
+	groupID, err := createSecurityGroup(ctx, client, aws.ToString(instance.VpcId), tagValue(instance.Tags, "UserID"), policy)
+	if err != nil {
+		return err
+	}
+	if _, err := client.CreateTags(ctx, &ec2.CreateTagsInput{
+		Resources: []string{groupID},
+		Tags:      []types.Tag{{Key: aws.String("InstanceID"), Value: aws.String(vmID)}},
+	}); err != nil {
+		logging.FromContext(ctx).Warn("Failed to tag security group", "security_group", groupID, "error", err)
+	}
+
+	_, err = client.ModifyInstanceAttribute(ctx, &ec2.ModifyInstanceAttributeInput{
+		InstanceId: aws.String(vmID),
+		Groups:     []string{groupID},
+	})
+	if err != nil {
+		deleteSecurityGroup(context.WithoutCancel(ctx), client, groupID)
+		return fmt.Errorf("failed to apply security group to instance %s: %w", vmID, err)
+	}
+
+	for _, group := range instance.SecurityGroups {
+		if isVMFirewall(aws.ToString(group.GroupName)) {
+			deleteSecurityGroup(ctx, client, aws.ToString(group.GroupId))
+		}
+	}
+	return nil
+}
+
+// createSecurityGroup creates a dedicated security group in the VPC that
+// admits exactly what the policy allows.
+func createSecurityGroup(ctx context.Context, client *ec2.Client, vpcID, userID string, policy *models.FirewallPolicy) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "aws.createSecurityGroup", trace.WithAttributes(attribute.String("aws.vpc_id", vpcID)))
+	defer tracing.End(span, &err)
+
+	groupName := utils.GenerateID(vmFirewallPrefix)
+	createResult, err := client.CreateSecurityGroup(ctx, &ec2.CreateSecurityGroupInput{
+		GroupName:   aws.String(groupName),
+		Description: aws.String("Wolkenlauf VM firewall"),
+		VpcId:       aws.String(vpcID),
+		TagSpecifications: []types.TagSpecification{
+			{
+				ResourceType: types.ResourceTypeSecurityGroup,
+				Tags: []types.Tag{
+					{Key: aws.String("Name"), Value: aws.String(groupName)},
+					{Key: aws.String("ManagedBy"), Value: aws.String("wolkenlauf")},
+					{Key: aws.String("UserID"), Value: aws.String(userID)},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create security group: %w", err)
+	}
+	groupID := aws.ToString(createResult.GroupId)
+
+	_, err = client.AuthorizeSecurityGroupIngress(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
+		GroupId:       aws.String(groupID),
+		IpPermissions: ipPermissions(policy),
+	})
+	if err != nil {
+		deleteSecurityGroup(context.WithoutCancel(ctx), client, groupID)
+		return "", fmt.Errorf("failed to add firewall rules: %w", err)
+	}
+
+	logging.FromContext(ctx).Info("Created security group", "security_group", groupID, "name", groupName)
+	return groupID, nil
+}
+
+// ipPermissions converts a policy into EC2 ingress rules, one per port.
+func ipPermissions(policy *models.FirewallPolicy) []types.IpPermission {
+	var permissions []types.IpPermission
+	for _, rule := range policy.Rules() {
+		permission := types.IpPermission{
+			IpProtocol: aws.String(rule.Protocol),
+			FromPort:   aws.Int32(int32(rule.Port)),
+			ToPort:     aws.Int32(int32(rule.Port)),
+		}
+		for _, cidr := range rule.SourceCIDRs {
+			if prefix, err := netip.ParsePrefix(cidr); err == nil && prefix.Addr().Is6() {
+				permission.Ipv6Ranges = append(permission.Ipv6Ranges, types.Ipv6Range{CidrIpv6: aws.String(cidr)})
+			} else {
+				permission.IpRanges = append(permission.IpRanges, types.IpRange{CidrIp: aws.String(cidr)})
+			}
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions
+}
+
+// defaultVPC returns the ID of the region's default VPC, where instances
+// without a subnet are launched.
+func defaultVPC(ctx context.Context, client *ec2.Client) (string, error) {
+	vpcs, err := client.DescribeVpcs(ctx, &ec2.DescribeVpcsInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("is-default"),
+				Values: []string{"true"},
+			},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to find default VPC: %w", err)
+	}
+	if len(vpcs.Vpcs) == 0 {
+		return "", fmt.Errorf("no default VPC found")
+	}
+	return aws.ToString(vpcs.Vpcs[0].VpcId), nil
+}
+
+// releaseFirewall frees the dedicated security group of an instance that is
+// about to be terminated. A group cannot be deleted while an instance uses
+// it, so live instances are moved to the VPC's default group first, which
+// admits nothing from outside. Failures are logged: they leave a stray
+// group behind but must not keep the instance alive.
+func releaseFirewall(ctx context.Context, client *ec2.Client, instance types.Instance) {
+	var groupIDs []string
+	for _, group := range instance.SecurityGroups {
+		if isVMFirewall(aws.ToString(group.GroupName)) {
+			groupIDs = append(groupIDs, aws.ToString(group.GroupId))
+		}
+	}
+	if len(groupIDs) == 0 {
+		return
+	}
+
+	instanceID := aws.ToString(instance.InstanceId)
+	if instance.State == nil || normalizeAWSState(instance.State.Name) != "terminated" {
+		groups, err := client.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{
+			Filters: []types.Filter{
+				{Name: aws.String("group-name"), Values: []string{"default"}},
+				{Name: aws.String("vpc-id"), Values: []string{aws.ToString(instance.VpcId)}},
+			},
+		})
+		if err == nil && len(groups.SecurityGroups) == 0 {
+			err = errors.New("VPC has no default security group")
+		}
+		if err == nil {
+			_, err = client.ModifyInstanceAttribute(ctx, &ec2.ModifyInstanceAttributeInput{
+				InstanceId: aws.String(instanceID),
+				Groups:     []string{aws.ToString(groups.SecurityGroups[0].GroupId)},
+			})
+		}
+		if err != nil {
+			logging.FromContext(ctx).Warn("Failed to detach security groups from instance", "security_groups", groupIDs, "vm_id", instanceID, "error", err)
+			return
+		}
+	}
+
+	for _, groupID := range groupIDs {
+		deleteSecurityGroup(ctx, client, groupID)
+	}
+}
+
+// deleteSecurityGroupAfterTermination deletes the group of an instance that
+// was terminated right after launch, once EC2 has let go of it.
+func deleteSecurityGroupAfterTermination(ctx context.Context, client *ec2.Client, instanceID, groupID string) {
+	waiter := ec2.NewInstanceTerminatedWaiter(client)
+	if err := waiter.Wait(ctx, &ec2.DescribeInstancesInput{InstanceIds: []string{instanceID}}, 5*time.Minute); err != nil {
+		logging.FromContext(ctx).Warn("Instance did not terminate, keeping its security group", "vm_id", instanceID, "security_group", groupID, "error", err)
+		return
+	}
+	deleteSecurityGroup(ctx, client, groupID)
+}
+
+// replayedSecurityGroup reports whether instance was launched without the
+// security group created for it, returning the group it has instead.
+func replayedSecurityGroup(instance types.Instance, groupID string) (string, bool) {
+	if len(instance.SecurityGroups) == 0 {
+		return "", false
+	}
+	for _, group := range instance.SecurityGroups {
+		if aws.ToString(group.GroupId) == groupID {
+			return "", false
+		}
+	}
+	return aws.ToString(instance.SecurityGroups[0].GroupId), true
+}
+
+func deleteSecurityGroup(ctx context.Context, client *ec2.Client, groupID string) {
+	_, err := client.DeleteSecurityGroup(ctx, &ec2.DeleteSecurityGroupInput{GroupId: aws.String(groupID)})
+	if err != nil && !isSecurityGroupNotFound(err) {
+		logging.FromContext(ctx).Warn("Failed to delete security group", "security_group", groupID, "error", err)
+	}
+}
+
+func isSecurityGroupNotFound(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidGroup.NotFound"
+}
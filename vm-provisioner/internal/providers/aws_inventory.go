@@ -0,0 +1,115 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"vm-provisioner/internal/models"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// ListManagedVMs returns every live instance tagged Provider=wolkenlauf in the
+// given regions plus all regions the provider already knows about. A failure
+// in any region fails the whole listing, so callers never mistake an
+// unreachable region for missing VMs.
+func (p *AWSProvider) ListManagedVMs(ctx context.Context, regions []string) ([]models.ManagedVM, error) {
+	seen := map[string]bool{}
+	var vms []models.ManagedVM
+
+	for _, region := range append(p.knownRegions(), regions...) {
+		if region == "" || seen[region] {
+			continue
+		}
+		seen[region] = true
+
+		paginator := ec2.NewDescribeInstancesPaginator(p.clientFor(region), &ec2.DescribeInstancesInput{
+			Filters: []types.Filter{
+				{Name: aws.String("tag:Provider"), Values: []string{"wolkenlauf"}},
+				{Name: aws.String("instance-state-name"), Values: []string{"pending", "running", "stopping", "stopped"}},
+			},
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list instances in %s: %w", region, err)
+			}
+			for _, reservation := range page.Reservations {
+				for _, instance := range reservation.Instances {
+					vms = append(vms, managedVMFromInstance(region, instance))
+				}
+			}
+		}
+	}
+
+	return vms, nil
+}
+
+func managedVMFromInstance(region string, instance types.Instance) models.ManagedVM {
+	vm := models.ManagedVM{
+		ID:           aws.ToString(instance.InstanceId),
+		Provider:     "aws",
+		Region:       region,
+		InstanceType: string(instance.InstanceType),
+		Status:       normalizeAWSState(instance.State.Name),
+		PublicIP:     aws.ToString(instance.PublicIpAddress),
+		Spot:         instance.InstanceLifecycle == types.InstanceLifecycleTypeSpot,
+	}
+	if instance.LaunchTime != nil {
+		vm.CreatedAt = *instance.LaunchTime
+	}
+	for _, tag := range instance.Tags {
+		switch aws.ToString(tag.Key) {
+		case "Name":
+			vm.Name = aws.ToString(tag.Value)
+		case "UserID":
+			vm.UserID = aws.ToString(tag.Value)
+		}
+	}
+	return vm
+}
+
+// awsFilterValueLimit is the most values EC2 accepts in one filter.
+const awsFilterValueLimit = 200
+
+// GetVMStatuses describes the instances with one paginated DescribeInstances
+// call per 200 IDs.
+func (p *AWSProvider) GetVMStatuses(ctx context.Context, region string, ids []string) ([]models.VMStatus, error) {
+	region, err := p.resolveRegion(region)
+	if err != nil {
+		return nil, err
+	}
+	client := p.clientFor(region)
+
+	var statuses []models.VMStatus
+	for start := 0; start < len(ids); start += awsFilterValueLimit {
+		batch := ids[start:min(start+awsFilterValueLimit, len(ids))]
+
+		// Filtering instead of InstanceIds leaves out unknown IDs instead of failing the call
+		paginator := ec2.NewDescribeInstancesPaginator(client, &ec2.DescribeInstancesInput{
+			Filters: []types.Filter{{Name: aws.String("instance-id"), Values: batch}},
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe instances in %s: %w", region, err)
+			}
+			for _, reservation := range page.Reservations {
+				for _, instance := range reservation.Instances {
+					statuses = append(statuses, models.VMStatus{
+						ID:        aws.ToString(instance.InstanceId),
+						Region:    region,
+						Status:    normalizeAWSState(instance.State.Name),
+						PublicIP:  aws.ToString(instance.PublicIpAddress),
+						UserID:    tagValue(instance.Tags, "UserID"),
+						UpdatedAt: time.Now(),
+					})
+				}
+			}
+		}
+	}
+	return statuses, nil
+}
@@ -0,0 +1,92 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+
+	"vm-provisioner/internal/models"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// StopVM stops an instance, keeping its EBS volumes. One-time spot instances
+// cannot be stopped and must be deleted instead.
+func (p *AWSProvider) StopVM(ctx context.Context, region, id string, force bool) error {
+	client, instance, err := p.locateInstance(ctx, region, id)
+	if err != nil {
+		return err
+	}
+	if err := p.checkStoppable(ctx, client, instance); err != nil {
+		return err
+	}
+
+	_, err = client.StopInstances(ctx, &ec2.StopInstancesInput{
+		InstanceIds: []string{id},
+		Force:       aws.Bool(force),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to stop instance: %w", err)
+	}
+	return nil
+}
+
+func (p *AWSProvider) StartVM(ctx context.Context, region, id string) error {
+	client, _, err := p.locateInstance(ctx, region, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.StartInstances(ctx, &ec2.StartInstancesInput{
+		InstanceIds: []string{id},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start instance: %w", err)
+	}
+	return nil
+}
+
+// RebootVM requests a reboot. EC2 has no hard reboot to ask for: it performs
+// one itself when the guest does not shut down cleanly within four minutes,
+// so hard reboots are refused rather than silently run as clean ones.
+func (p *AWSProvider) RebootVM(ctx context.Context, region, id string, hard bool) error {
+	if hard {
+		return fmt.Errorf("EC2 instances cannot be hard rebooted, stop them with force instead: %w", models.ErrOperationNotSupported)
+	}
+	client, _, err := p.locateInstance(ctx, region, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.RebootInstances(ctx, &ec2.RebootInstancesInput{
+		InstanceIds: []string{id},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reboot instance: %w", err)
+	}
+	return nil
+}
+
+// checkStoppable rejects spot instances backed by a one-time request, which
+// EC2 refuses to stop. Persistent spot requests can be stopped.
+func (p *AWSProvider) checkStoppable(ctx context.Context, client *ec2.Client, instance types.Instance) error {
+	if instance.InstanceLifecycle != types.InstanceLifecycleTypeSpot {
+		return nil
+	}
+	if instance.SpotInstanceRequestId == nil {
+		return fmt.Errorf("spot instance %s cannot be stopped: %w", aws.ToString(instance.InstanceId), models.ErrOperationNotSupported)
+	}
+
+	result, err := client.DescribeSpotInstanceRequests(ctx, &ec2.DescribeSpotInstanceRequestsInput{
+		SpotInstanceRequestIds: []string{*instance.SpotInstanceRequestId},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe spot request: %w", err)
+	}
+	if len(result.SpotInstanceRequests) == 0 || result.SpotInstanceRequests[0].Type != types.SpotInstanceTypePersistent {
+		return fmt.Errorf("one-time spot instance %s cannot be stopped, delete it instead: %w",
+			aws.ToString(instance.InstanceId), models.ErrOperationNotSupported)
+	}
+	return nil
+}
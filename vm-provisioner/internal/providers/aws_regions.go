@@ -0,0 +1,127 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"vm-provisioner/internal/models"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+)
+
+// resolveRegion returns the region a request should run in, falling back to
+// the configured default and rejecting regions outside the allowlist.
+func (p *AWSProvider) resolveRegion(region string) (string, error) {
+	if region == "" {
+		return p.config.Region, nil
+	}
+	if len(p.config.Regions) == 0 {
+		return region, nil
+	}
+	for _, allowed := range p.config.Regions {
+		if allowed == region {
+			return region, nil
+		}
+	}
+	return "", fmt.Errorf("AWS region %s is not enabled (allowed: %v)", region, p.config.Regions)
+}
+
+// clientFor returns the EC2 client for a region, creating it on first use.
+// All clients share the credentials loaded in NewAWSProvider.
+func (p *AWSProvider) clientFor(region string) *ec2.Client {
+	if region == "" {
+		region = p.config.Region
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if client, ok := p.clients[region]; ok {
+		return client
+	}
+	client := ec2.NewFromConfig(p.awsCfg, func(o *ec2.Options) {
+		o.Region = region
+	})
+	p.clients[region] = client
+	return client
+}
+
+// knownRegions lists the regions a VM of unknown location may live in:
+// the default region, the allowlist, and every region we have talked to.
+func (p *AWSProvider) knownRegions() []string {
+	seen := map[string]bool{}
+	var regions []string
+	add := func(region string) {
+		if region != "" && !seen[region] {
+			seen[region] = true
+			regions = append(regions, region)
+		}
+	}
+
+	add(p.config.Region)
+	for _, region := range p.config.Regions {
+		add(region)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for region := range p.clients {
+		add(region)
+	}
+	return regions
+}
+
+// locateInstance describes an instance in the given region, or searches all
+// known regions when the region is not known to the caller.
+func (p *AWSProvider) locateInstance(ctx context.Context, region, id string) (*ec2.Client, types.Instance, error) {
+	regions := []string{region}
+	if region == "" {
+		regions = p.knownRegions()
+	}
+
+	for _, r := range regions {
+		client := p.clientFor(r)
+		result, err := client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+			InstanceIds: []string{id},
+		})
+		if err != nil {
+			if isInstanceNotFound(err) {
+				continue
+			}
+			return nil, types.Instance{}, fmt.Errorf("failed to describe instance in %s: %w", r, err)
+		}
+		if len(result.Reservations) > 0 && len(result.Reservations[0].Instances) > 0 {
+			return client, result.Reservations[0].Instances[0], nil
+		}
+	}
+
+	return nil, types.Instance{}, fmt.Errorf("instance %s not found in regions %v: %w", id, regions, models.ErrVMNotFound)
+}
+
+func isInstanceNotFound(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "InvalidInstanceID.NotFound", "InvalidInstanceID.Malformed":
+			return true
+		}
+	}
+	return false
+}
+
+// isInsufficientCapacity reports whether RunInstances failed because EC2 has
+// no room for the instance type (or spot market) in the region or zone.
+func isInsufficientCapacity(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "InsufficientInstanceCapacity", "InsufficientHostCapacity", "InsufficientCapacity",
+			"SpotMaxPriceTooLow", "MaxSpotInstanceCountExceeded", "Unsupported":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package providers
+
+import (
+	"reflect"
+	"testing"
+
+	"vm-provisioner/internal/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+func TestResolveRegion(t *testing.T) {
+	tests := []struct {
+		name    string
+		regions []string // allowlist
+		region  string
+		want    string // empty when the region is refused
+	}{
+		{"default region", nil, "", "us-east-1"},
+		{"any region without allowlist", nil, "ap-south-1", "ap-south-1"},
+		{"allowed region", []string{"eu-west-1", "eu-central-1"}, "eu-central-1", "eu-central-1"},
+		{"region outside the allowlist", []string{"eu-west-1"}, "ap-south-1", ""},
+		{"default region with allowlist", []string{"eu-west-1"}, "", "us-east-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &AWSProvider{config: config.AWSConfig{Region: "us-east-1", Regions: tt.regions}}
+			got, err := p.resolveRegion(tt.region)
+			if (err != nil) != (tt.want == "") || got != tt.want {
+				t.Errorf("resolveRegion(%q) = %q, %v, want %q", tt.region, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientFor(t *testing.T) {
+	p := &AWSProvider{
+		awsCfg:  aws.Config{Region: "us-east-1"},
+		config:  config.AWSConfig{Region: "us-east-1", Regions: []string{"eu-west-1"}},
+		clients: map[string]*ec2.Client{},
+	}
+
+	eu := p.clientFor("eu-west-1")
+	if got := eu.Options().Region; got != "eu-west-1" {
+		t.Errorf("client region = %s, want eu-west-1", got)
+	}
+	if p.clientFor("eu-west-1") != eu {
+		t.Error("client for eu-west-1 was created twice")
+	}
+	if got := p.clientFor("").Options().Region; got != "us-east-1" {
+		t.Errorf("default client region = %s, want us-east-1", got)
+	}
+
+	// Regions talked to are searched for VMs of unknown location
+	p.clientFor("ap-south-1")
+	want := []string{"us-east-1", "eu-west-1", "ap-south-1"}
+	if got := p.knownRegions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("knownRegions = %v, want %v", got, want)
+	}
+}
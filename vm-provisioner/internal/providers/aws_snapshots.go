@@ -0,0 +1,148 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"vm-provisioner/internal/models"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+)
+
+// awsSnapshotWait bounds waiting for an AMI to become available; the
+// caller's deadline usually ends it sooner.
+const awsSnapshotWait = 2 * time.Hour
+
+// CreateSnapshot registers an AMI of the instance, backed by EBS snapshots
+// of all its volumes. The login user is tagged on the AMI so VMs restored
+// from it use the right one.
+func (p *AWSProvider) CreateSnapshot(ctx context.Context, region, vmID string, req *models.SnapshotRequest) (*models.Snapshot, error) {
+	client, instance, err := p.locateInstance(ctx, region, vmID)
+	if err != nil {
+		return nil, err
+	}
+
+	sshUsername := req.SSHUsername
+	if sshUsername == "" {
+		sshUsername = p.sshUsernameForAMI(ctx, client, aws.ToString(instance.ImageId))
+	}
+	tags := []types.Tag{
+		{Key: aws.String("Name"), Value: aws.String(req.Name)},
+		{Key: aws.String("Provider"), Value: aws.String("wolkenlauf")},
+		{Key: aws.String("UserID"), Value: aws.String(req.UserID)},
+		{Key: aws.String("SourceVM"), Value: aws.String(vmID)},
+		{Key: aws.String("SSHUsername"), Value: aws.String(sshUsername)},
+	}
+
+	// AMI names must be unique per region
+	result, err := client.CreateImage(ctx, &ec2.CreateImageInput{
+		InstanceId: aws.String(vmID),
+		Name:       aws.String(fmt.Sprintf("wolkenlauf-%s-%d", sanitizeHetznerName(req.Name), time.Now().Unix())),
+		NoReboot:   aws.Bool(req.NoReboot),
+		TagSpecifications: []types.TagSpecification{
+			{ResourceType: types.ResourceTypeImage, Tags: tags},
+			{ResourceType: types.ResourceTypeSnapshot, Tags: tags},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AMI of %s: %w", vmID, err)
+	}
+
+	return &models.Snapshot{
+		ID:          aws.ToString(result.ImageId),
+		Provider:    "aws",
+		Region:      client.Options().Region,
+		UserID:      req.UserID,
+		VMID:        vmID,
+		Name:        req.Name,
+		Status:      models.SnapshotPending,
+		SSHUsername: sshUsername,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+func (p *AWSProvider) WaitForSnapshot(ctx context.Context, region, id string) error {
+	region, err := p.resolveRegion(region)
+	if err != nil {
+		return err
+	}
+
+	err = ec2.NewImageAvailableWaiter(p.clientFor(region)).Wait(ctx, &ec2.DescribeImagesInput{ImageIds: []string{id}}, awsSnapshotWait)
+	if err != nil {
+		return fmt.Errorf("AMI %s did not become available: %w", id, err)
+	}
+	return nil
+}
+
+// DeleteSnapshot deregisters the AMI and deletes the EBS snapshots behind
+// it, which EC2 would otherwise keep billing.
+func (p *AWSProvider) DeleteSnapshot(ctx context.Context, region, id string) error {
+	region, err := p.resolveRegion(region)
+	if err != nil {
+		return err
+	}
+	client := p.clientFor(region)
+
+	result, err := client.DescribeImages(ctx, &ec2.DescribeImagesInput{ImageIds: []string{id}})
+	if err != nil && !isImageNotFound(err) {
+		return fmt.Errorf("failed to describe AMI %s: %w", id, err)
+	}
+	if err != nil || len(result.Images) == 0 {
+		return fmt.Errorf("snapshot %s: %w", id, models.ErrSnapshotNotFound)
+	}
+
+	if _, err := client.DeregisterImage(ctx, &ec2.DeregisterImageInput{ImageId: aws.String(id)}); err != nil {
+		return fmt.Errorf("failed to deregister AMI %s: %w", id, err)
+	}
+	for _, mapping := range result.Images[0].BlockDeviceMappings {
+		if mapping.Ebs == nil || mapping.Ebs.SnapshotId == nil {
+			continue
+		}
+		if _, err := client.DeleteSnapshot(ctx, &ec2.DeleteSnapshotInput{SnapshotId: mapping.Ebs.SnapshotId}); err != nil {
+			return fmt.Errorf("failed to delete EBS snapshot %s of AMI %s: %w", aws.ToString(mapping.Ebs.SnapshotId), id, err)
+		}
+	}
+	return nil
+}
+
+// sshUsernameForAMI derives the login user of an AMI from its SSHUsername
+// tag (set on snapshots) or the distribution in its name, falling back to
+// the Amazon Linux default.
+func (p *AWSProvider) sshUsernameForAMI(ctx context.Context, client *ec2.Client, ami string) string {
+	result, err := client.DescribeImages(ctx, &ec2.DescribeImagesInput{ImageIds: []string{ami}})
+	if err != nil || len(result.Images) == 0 {
+		return "ec2-user"
+	}
+
+	image := result.Images[0]
+	if username := tagValue(image.Tags, "SSHUsername"); username != "" {
+		return username
+	}
+	name := strings.ToLower(aws.ToString(image.Name) + " " + aws.ToString(image.Description))
+	switch {
+	case strings.Contains(name, "ubuntu"):
+		return "ubuntu"
+	case strings.Contains(name, "debian"):
+		return "admin"
+	case strings.Contains(name, "centos"):
+		return "centos"
+	}
+	return "ec2-user"
+}
+
+func isImageNotFound(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "InvalidAMIID.NotFound", "InvalidAMIID.Malformed", "InvalidAMIID.Unavailable":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"vm-provisioner/internal/models"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// awsSpotNotice is how long EC2 gives a spot instance between the
+// interruption notice and reclaiming it.
+const awsSpotNotice = 2 * time.Minute
+
+// CheckSpotInstances reads the spot request status of each instance, which
+// EC2 moves to marked-for-termination when it issues the interruption notice
+// and to instance-terminated-* once the instance was reclaimed.
+func (p *AWSProvider) CheckSpotInstances(ctx context.Context, region string, ids []string) ([]models.SpotStatus, error) {
+	region, err := p.resolveRegion(region)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	client := p.clientFor(region)
+
+	var instances []types.Instance
+	requests := map[string]types.SpotInstanceRequest{}
+	for start := 0; start < len(ids); start += awsFilterValueLimit {
+		batch := ids[start:min(start+awsFilterValueLimit, len(ids))]
+
+		// Filtering instead of InstanceIds leaves out unknown IDs instead of failing the call
+		var requestIDs []string
+		paginator := ec2.NewDescribeInstancesPaginator(client, &ec2.DescribeInstancesInput{
+			Filters: []types.Filter{{Name: aws.String("instance-id"), Values: batch}},
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe spot instances in %s: %w", region, err)
+			}
+			for _, reservation := range page.Reservations {
+				for _, instance := range reservation.Instances {
+					instances = append(instances, instance)
+					if instance.SpotInstanceRequestId != nil {
+						requestIDs = append(requestIDs, *instance.SpotInstanceRequestId)
+					}
+				}
+			}
+		}
+		if len(requestIDs) == 0 {
+			continue
+		}
+
+		// At most one request per instance, so the batch stays within the limit
+		requestPaginator := ec2.NewDescribeSpotInstanceRequestsPaginator(client, &ec2.DescribeSpotInstanceRequestsInput{
+			Filters: []types.Filter{{Name: aws.String("spot-instance-request-id"), Values: requestIDs}},
+		})
+		for requestPaginator.HasMorePages() {
+			page, err := requestPaginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe spot requests in %s: %w", region, err)
+			}
+			for _, request := range page.SpotInstanceRequests {
+				requests[aws.ToString(request.SpotInstanceRequestId)] = request
+			}
+		}
+	}
+
+	statuses := make([]models.SpotStatus, 0, len(instances))
+	for _, instance := range instances {
+		status := models.SpotStatus{
+			ID:     aws.ToString(instance.InstanceId),
+			Status: normalizeAWSState(instance.State.Name),
+		}
+
+		if request, ok := requests[aws.ToString(instance.SpotInstanceRequestId)]; ok && request.Status != nil {
+			code := aws.ToString(request.Status.Code)
+			switch {
+			case code == "marked-for-termination":
+				status.MarkedForTermination = true
+				if request.Status.UpdateTime != nil {
+					terminationTime := request.Status.UpdateTime.Add(awsSpotNotice)
+					status.TerminationTime = &terminationTime
+				}
+				status.Reason = aws.ToString(request.Status.Message)
+			case strings.HasPrefix(code, "instance-terminated-") && code != "instance-terminated-by-user":
+				status.Interrupted = true
+				status.Reason = code
+			}
+		}
+
+		// The request can be gone already, but the state reason outlives it
+		if !status.Interrupted && instance.StateReason != nil &&
+			aws.ToString(instance.StateReason.Code) == "Server.SpotInstanceTermination" {
+			status.Interrupted = true
+			status.Reason = aws.ToString(instance.StateReason.Message)
+		}
+
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
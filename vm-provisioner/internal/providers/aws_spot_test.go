@@ -0,0 +1,134 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"vm-provisioner/internal/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// fakeEC2 answers DescribeInstances and DescribeSpotInstanceRequests for the
+// instances it knows, one item per page. It records the largest filter it
+// was sent.
+type fakeEC2 struct {
+	instances map[string]string // instance ID -> spot request ID
+	requests  map[string]string // spot request ID -> status code
+
+	mu        sync.Mutex
+	maxFilter int
+}
+
+func (f *fakeEC2) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var values []string
+	for i := 1; r.Form.Has("Filter.1.Value." + strconv.Itoa(i)); i++ {
+		values = append(values, r.Form.Get("Filter.1.Value."+strconv.Itoa(i)))
+	}
+	f.mu.Lock()
+	f.maxFilter = max(f.maxFilter, len(values))
+	f.mu.Unlock()
+
+	// Page through the matches one at a time, the token being the next index
+	var matches []string
+	known := f.instances
+	if r.Form.Get("Action") == "DescribeSpotInstanceRequests" {
+		known = f.requests
+	}
+	for _, value := range values {
+		if _, ok := known[value]; ok {
+			matches = append(matches, value)
+		}
+	}
+	next, _ := strconv.Atoi(r.Form.Get("NextToken"))
+	var item, token string
+	if next < len(matches) {
+		item = matches[next]
+		if next+1 < len(matches) {
+			token = fmt.Sprintf("<nextToken>%d</nextToken>", next+1)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+	switch r.Form.Get("Action") {
+	case "DescribeInstances":
+		body := ""
+		if item != "" {
+			body = fmt.Sprintf(`<item><instancesSet><item><instanceId>%s</instanceId>`+
+				`<instanceState><code>16</code><name>running</name></instanceState>`+
+				`<spotInstanceRequestId>%s</spotInstanceRequestId></item></instancesSet></item>`, item, f.instances[item])
+		}
+		fmt.Fprintf(w, `<DescribeInstancesResponse><reservationSet>%s</reservationSet>%s</DescribeInstancesResponse>`, body, token)
+	case "DescribeSpotInstanceRequests":
+		body := ""
+		if item != "" {
+			body = fmt.Sprintf(`<item><spotInstanceRequestId>%s</spotInstanceRequestId>`+
+				`<status><code>%s</code><updateTime>2026-01-02T03:04:05.000Z</updateTime></status></item>`, item, f.requests[item])
+		}
+		fmt.Fprintf(w, `<DescribeSpotInstanceRequestsResponse><spotInstanceRequestSet>%s</spotInstanceRequestSet>%s</DescribeSpotInstanceRequestsResponse>`, body, token)
+	default:
+		http.Error(w, "unexpected action "+r.Form.Get("Action"), http.StatusBadRequest)
+	}
+}
+
+func TestCheckSpotInstancesBatchesAndPages(t *testing.T) {
+	fake := &fakeEC2{
+		instances: map[string]string{"i-5": "sir-5", "i-6": "sir-6", "i-210": "sir-210", "i-211": "sir-211"},
+		requests: map[string]string{
+			"sir-5":   "fulfilled",
+			"sir-6":   "marked-for-termination",
+			"sir-210": "instance-terminated-no-capacity",
+			"sir-211": "instance-terminated-by-user",
+		},
+	}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	p := &AWSProvider{
+		awsCfg: aws.Config{
+			Region:       "us-east-1",
+			Credentials:  aws.AnonymousCredentials{},
+			BaseEndpoint: aws.String(srv.URL),
+		},
+		config:  config.AWSConfig{Region: "us-east-1"},
+		clients: map[string]*ec2.Client{},
+	}
+
+	// More IDs than fit into one filter
+	var ids []string
+	for i := range awsFilterValueLimit + 50 {
+		ids = append(ids, "i-"+strconv.Itoa(i))
+	}
+	statuses, err := p.CheckSpotInstances(context.Background(), "us-east-1", ids)
+	if err != nil {
+		t.Fatalf("CheckSpotInstances: %v", err)
+	}
+	if fake.maxFilter > awsFilterValueLimit {
+		t.Errorf("filter had %d values, want at most %d", fake.maxFilter, awsFilterValueLimit)
+	}
+
+	var got []string
+	for _, status := range statuses {
+		got = append(got, fmt.Sprintf("%s:marked=%v,interrupted=%v", status.ID, status.MarkedForTermination, status.Interrupted))
+	}
+	want := []string{
+		"i-5:marked=false,interrupted=false",
+		"i-6:marked=true,interrupted=false",
+		"i-210:marked=false,interrupted=true",
+		"i-211:marked=false,interrupted=false",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("statuses = %v, want %v", got, want)
+	}
+}
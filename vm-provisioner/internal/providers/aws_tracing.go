@@ -0,0 +1,37 @@
+package providers
+
+import (
+	"context"
+
+	"vm-provisioner/internal/tracing"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceAPICalls adds a span for every AWS API call, named after the
+// operation (e.g. EC2.RunInstances) and spanning its retries.
+func traceAPICalls(stack *middleware.Stack) error {
+	// After the service metadata middleware, which names the operation
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("Tracing",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (out middleware.InitializeOutput, metadata middleware.Metadata, err error) {
+			service, operation := awsmiddleware.GetServiceID(ctx), awsmiddleware.GetOperationName(ctx)
+			ctx, span := tracing.Start(ctx, service+"."+operation,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					attribute.String("rpc.system", "aws-api"),
+					attribute.String("rpc.service", service),
+					attribute.String("rpc.method", operation),
+					attribute.String("cloud.region", awsmiddleware.GetRegion(ctx)),
+				))
+			defer tracing.End(span, &err)
+
+			out, metadata, err = next.HandleInitialize(ctx, in)
+			if requestID, ok := awsmiddleware.GetRequestIDMetadata(metadata); ok {
+				span.SetAttributes(attribute.String("aws.request_id", requestID))
+			}
+			return out, metadata, err
+		}), middleware.After)
+}
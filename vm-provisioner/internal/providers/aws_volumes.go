@@ -0,0 +1,247 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/operations"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+)
+
+// awsVolumeDevices are the device names data volumes are attached under, in
+// order. Nitro instances expose every EBS volume as an NVMe device instead,
+// which cloud-init finds by the volume ID.
+var awsVolumeDevices = []string{
+	"/dev/sdf", "/dev/sdg", "/dev/sdh", "/dev/sdi", "/dev/sdj", "/dev/sdk",
+	"/dev/sdl", "/dev/sdm", "/dev/sdn", "/dev/sdo", "/dev/sdp",
+}
+
+// awsAttachWait bounds waiting for an instance to boot or a volume to free
+// up before attaching; the caller's deadline usually ends it sooner.
+const awsAttachWait = 5 * time.Minute
+
+// awsVolumeDevicePaths lists where the i-th volume attached at launch shows
+// up: the NVMe alias on Nitro instances, the Xen name on older ones.
+func awsVolumeDevicePaths(i int, volumeID string) []string {
+	return []string{
+		"/dev/disk/by-id/nvme-Amazon_Elastic_Block_Store_" + strings.ReplaceAll(volumeID, "-", ""),
+		strings.Replace(awsVolumeDevices[i], "/dev/sd", "/dev/xvd", 1),
+	}
+}
+
+// CreateVolume creates a gp3 volume, in the first zone of the region unless
+// the request names one.
+func (p *AWSProvider) CreateVolume(ctx context.Context, req *models.VolumeRequest) (*models.Volume, error) {
+	region, err := p.resolveRegion(req.Region)
+	if err != nil {
+		return nil, err
+	}
+	client := p.clientFor(region)
+
+	zone := req.AvailabilityZone
+	if zone == "" {
+		if zone, err = defaultZone(ctx, client); err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := client.CreateVolume(ctx, &ec2.CreateVolumeInput{
+		AvailabilityZone: aws.String(zone),
+		Size:             aws.Int32(int32(req.SizeGiB)),
+		VolumeType:       types.VolumeTypeGp3,
+		TagSpecifications: []types.TagSpecification{
+			{
+				ResourceType: types.ResourceTypeVolume,
+				Tags: []types.Tag{
+					{Key: aws.String("Name"), Value: aws.String(req.Name)},
+					{Key: aws.String("Provider"), Value: aws.String("wolkenlauf")},
+					{Key: aws.String("UserID"), Value: aws.String(req.UserID)},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create EBS volume in %s: %w", zone, err)
+	}
+
+	return &models.Volume{
+		ID:               aws.ToString(result.VolumeId),
+		Provider:         "aws",
+		Region:           region,
+		AvailabilityZone: zone,
+		UserID:           req.UserID,
+		Name:             req.Name,
+		SizeGiB:          int(aws.ToInt32(result.Size)),
+		Status:           models.VolumeAvailable,
+		CreatedAt:        time.Now(),
+	}, nil
+}
+
+// defaultZone returns the alphabetically first available zone of the
+// client's region.
+func defaultZone(ctx context.Context, client *ec2.Client) (string, error) {
+	result, err := client.DescribeAvailabilityZones(ctx, &ec2.DescribeAvailabilityZonesInput{
+		Filters: []types.Filter{{Name: aws.String("state"), Values: []string{"available"}}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list zones of %s: %w", client.Options().Region, err)
+	}
+	var zones []string
+	for _, zone := range result.AvailabilityZones {
+		zones = append(zones, aws.ToString(zone.ZoneName))
+	}
+	if len(zones) == 0 {
+		return "", fmt.Errorf("no available zone in %s", client.Options().Region)
+	}
+	slices.Sort(zones)
+	return zones[0], nil
+}
+
+func (p *AWSProvider) DeleteVolume(ctx context.Context, region, id string) error {
+	region, err := p.resolveRegion(region)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.clientFor(region).DeleteVolume(ctx, &ec2.DeleteVolumeInput{VolumeId: aws.String(id)})
+	if err != nil {
+		if isVolumeNotFound(err) {
+			return fmt.Errorf("volume %s: %w", id, models.ErrVolumeNotFound)
+		}
+		return fmt.Errorf("failed to delete volume %s: %w", id, err)
+	}
+	return nil
+}
+
+// AttachVolume attaches the volume under the first device name the
+// instance does not use yet.
+func (p *AWSProvider) AttachVolume(ctx context.Context, region, volumeID, vmID string) error {
+	client, instance, err := p.locateInstance(ctx, region, vmID)
+	if err != nil {
+		return err
+	}
+	if instance.State != nil && instance.State.Name == types.InstanceStateNamePending {
+		if instance, err = waitForInstance(ctx, client, vmID); err != nil {
+			return err
+		}
+	}
+
+	used := map[string]bool{}
+	for _, mapping := range instance.BlockDeviceMappings {
+		used[aws.ToString(mapping.DeviceName)] = true
+	}
+	for _, device := range awsVolumeDevices {
+		if !used[device] && !used[strings.Replace(device, "/dev/sd", "/dev/xvd", 1)] {
+			return attachVolume(ctx, client, volumeID, vmID, device)
+		}
+	}
+	return fmt.Errorf("instance %s has no free device name for volume %s: %w", vmID, volumeID, models.ErrOperationNotSupported)
+}
+
+func (p *AWSProvider) DetachVolume(ctx context.Context, region, volumeID string) error {
+	region, err := p.resolveRegion(region)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.clientFor(region).DetachVolume(ctx, &ec2.DetachVolumeInput{VolumeId: aws.String(volumeID)})
+	if err != nil {
+		if isVolumeNotFound(err) {
+			return fmt.Errorf("volume %s: %w", volumeID, models.ErrVolumeNotFound)
+		}
+		return fmt.Errorf("failed to detach volume %s: %w", volumeID, err)
+	}
+	return nil
+}
+
+func (p *AWSProvider) WaitForVolume(ctx context.Context, region, id string) error {
+	region, err := p.resolveRegion(region)
+	if err != nil {
+		return err
+	}
+	return waitForVolume(ctx, p.clientFor(region), id)
+}
+
+// attachVolumesAtLaunch attaches the volumes of a new instance in order, so
+// the i-th volume gets the i-th device name cloud-init looks for.
+func attachVolumesAtLaunch(ctx context.Context, client *ec2.Client, instanceID string, mounts []models.VolumeMount) error {
+	if len(mounts) > len(awsVolumeDevices) {
+		return fmt.Errorf("at most %d volumes can be attached: %w", len(awsVolumeDevices), models.ErrOperationNotSupported)
+	}
+
+	operations.ReportProgress(ctx, "waiting for instance to attach volumes")
+	if _, err := waitForInstance(ctx, client, instanceID); err != nil {
+		return err
+	}
+	for i, mount := range mounts {
+		operations.ReportProgress(ctx, "attaching volume "+mount.VolumeID)
+		if err := attachVolume(ctx, client, mount.VolumeID, instanceID, awsVolumeDevices[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachVolume waits for the volume to be free, e.g. released by a
+// terminated instance, and attaches it.
+func attachVolume(ctx context.Context, client *ec2.Client, volumeID, instanceID, device string) error {
+	if err := waitForVolume(ctx, client, volumeID); err != nil {
+		return err
+	}
+
+	_, err := client.AttachVolume(ctx, &ec2.AttachVolumeInput{
+		VolumeId:   aws.String(volumeID),
+		InstanceId: aws.String(instanceID),
+		Device:     aws.String(device),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to attach volume %s to %s: %w", volumeID, instanceID, err)
+	}
+	return nil
+}
+
+// waitForVolume waits until the volume is available, i.e. not attached.
+func waitForVolume(ctx context.Context, client *ec2.Client, volumeID string) error {
+	err := ec2.NewVolumeAvailableWaiter(client).Wait(ctx, &ec2.DescribeVolumesInput{VolumeIds: []string{volumeID}}, awsAttachWait)
+	if err != nil {
+		if isVolumeNotFound(err) {
+			return fmt.Errorf("volume %s: %w", volumeID, models.ErrVolumeNotFound)
+		}
+		return fmt.Errorf("volume %s did not become available: %w", volumeID, err)
+	}
+	return nil
+}
+
+// waitForInstance waits until a new instance is running; volumes cannot be
+// attached while it is pending.
+func waitForInstance(ctx context.Context, client *ec2.Client, instanceID string) (types.Instance, error) {
+	result, err := ec2.NewInstanceRunningWaiter(client).WaitForOutput(ctx,
+		&ec2.DescribeInstancesInput{InstanceIds: []string{instanceID}}, awsAttachWait)
+	if err != nil {
+		return types.Instance{}, fmt.Errorf("instance %s did not start: %w", instanceID, err)
+	}
+	if len(result.Reservations) == 0 || len(result.Reservations[0].Instances) == 0 {
+		return types.Instance{}, fmt.Errorf("instance %s: %w", instanceID, models.ErrVMNotFound)
+	}
+	return result.Reservations[0].Instances[0], nil
+}
+
+func isVolumeNotFound(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "InvalidVolume.NotFound", "InvalidVolumeID.Malformed":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package providers
+
+import (
+	"fmt"
+	"strings"
+
+	"vm-provisioner/internal/models"
+)
+
+// sshAccessScript returns the cloud-init shell snippet that installs the
+// given public keys for username and configures sshd password login. Password
+// login is only enabled when a password is given; otherwise it is disabled
+// explicitly, since some images ship with it turned on.
+func sshAccessScript(username, home string, keys []string, password string) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Set up SSH access for %s user\n", username)
+	if len(keys) > 0 {
+		fmt.Fprintf(&b, "mkdir -p %s/.ssh\n", home)
+		fmt.Fprintf(&b, "cat >> %s/.ssh/authorized_keys << 'WOLKENLAUF_KEYS'\n", home)
+		for _, key := range keys {
+			b.WriteString(key + "\n")
+		}
+		b.WriteString("WOLKENLAUF_KEYS\n")
+		fmt.Fprintf(&b, "chmod 700 %s/.ssh\n", home)
+		fmt.Fprintf(&b, "chmod 600 %s/.ssh/authorized_keys\n", home)
+		fmt.Fprintf(&b, "chown -R %s:%s %s/.ssh\n", username, username, home)
+	}
+
+	passwordAuth := "no"
+	if password != "" {
+		passwordAuth = "yes"
+		fmt.Fprintf(&b, "echo '%s:%s' | chpasswd\n", username, password)
+	}
+	fmt.Fprintf(&b, "sed -i -E 's/^#?PasswordAuthentication .*/PasswordAuthentication %s/' /etc/ssh/sshd_config\n", passwordAuth)
+	// sshd keeps the first value it reads; 00- sorts before cloud-init's drop-in
+	fmt.Fprintf(&b, "if [ -d /etc/ssh/sshd_config.d ]; then echo 'PasswordAuthentication %s' > /etc/ssh/sshd_config.d/00-wolkenlauf.conf; fi\n", passwordAuth)
+	b.WriteString("systemctl restart sshd 2>/dev/null || systemctl restart ssh\n")
+
+	return b.String()
+}
+
+// motdLoginLine describes how to log in, for the welcome message. The
+// message is world-readable, so it never contains the password itself.
+func motdLoginLine(password string) string {
+	if password != "" {
+		return "SSH Login: public key or the password returned at creation"
+	}
+	return "SSH Login: public key only"
+}
+
+// volumeMountScript returns the cloud-init shell snippet that waits for each
+// volume to show up under one of its device paths, formats it if it is
+// blank and mounts it at its mount path, also across reboots. Volumes
+// already holding a filesystem keep their data.
+func volumeMountScript(mounts []models.VolumeMount, devicePaths func(i int, volumeID string) []string) string {
+	var b strings.Builder
+
+	for i, mount := range mounts {
+		fmt.Fprintf(&b, "# Mount volume %s at %s\n", mount.VolumeID, mount.MountPath)
+		b.WriteString("dev=''\n")
+		b.WriteString("for attempt in $(seq 60); do\n")
+		fmt.Fprintf(&b, "    for candidate in %s; do\n", strings.Join(devicePaths(i, mount.VolumeID), " "))
+		b.WriteString("        if [ -e \"$candidate\" ]; then dev=$(readlink -f \"$candidate\"); break; fi\n")
+		b.WriteString("    done\n")
+		b.WriteString("    [ -n \"$dev\" ] && break\n")
+		b.WriteString("    sleep 5\n")
+		b.WriteString("done\n")
+		b.WriteString("if [ -n \"$dev\" ]; then\n")
+		b.WriteString("    blkid \"$dev\" > /dev/null || mkfs.ext4 -q \"$dev\"\n")
+		fmt.Fprintf(&b, "    mkdir -p '%s'\n", mount.MountPath)
+		fmt.Fprintf(&b, "    echo \"UUID=$(blkid -s UUID -o value \"$dev\") %s ext4 defaults,nofail 0 2\" >> /etc/fstab\n", mount.MountPath)
+		fmt.Fprintf(&b, "    mount '%s'\n", mount.MountPath)
+		b.WriteString("else\n")
+		fmt.Fprintf(&b, "    echo \"⚠️  Volume %s did not appear, not mounted\"\n", mount.VolumeID)
+		b.WriteString("fi\n")
+	}
+
+	return b.String()
+}
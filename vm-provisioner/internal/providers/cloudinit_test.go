@@ -0,0 +1,40 @@
+package providers
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"vm-provisioner/internal/models"
+)
+
+func TestVolumeMountScript(t *testing.T) {
+	mounts := []models.VolumeMount{
+		{VolumeID: "vol-1", MountPath: "/data"},
+		{VolumeID: "vol-2", MountPath: "/mnt/vol-2"},
+	}
+	script := volumeMountScript(mounts, func(i int, volumeID string) []string {
+		return []string{fmt.Sprintf("/dev/disk/by-id/%s", volumeID), fmt.Sprintf("/dev/xvd%c", 'f'+i)}
+	})
+
+	for _, want := range []string{
+		"for candidate in /dev/disk/by-id/vol-1 /dev/xvdf; do",
+		"for candidate in /dev/disk/by-id/vol-2 /dev/xvdg; do",
+		`blkid "$dev" > /dev/null || mkfs.ext4 -q "$dev"`,
+		`/data ext4 defaults,nofail 0 2" >> /etc/fstab`,
+		`/mnt/vol-2 ext4 defaults,nofail 0 2" >> /etc/fstab`,
+		"mount '/data'",
+		"mount '/mnt/vol-2'",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script lacks %q:\n%s", want, script)
+		}
+	}
+
+	if sh, err := exec.LookPath("sh"); err == nil {
+		if out, err := exec.Command(sh, "-n", "-c", script).CombinedOutput(); err != nil {
+			t.Errorf("script does not parse: %v\n%s", err, out)
+		}
+	}
+}
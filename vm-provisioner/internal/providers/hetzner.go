@@ -3,15 +3,23 @@ package providers
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/logging"
 	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/operations"
+	"vm-provisioner/internal/tracing"
 	"vm-provisioner/internal/utils"
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type HetznerProvider struct {
@@ -35,15 +43,22 @@ var hetznerInstanceTypes = map[string]bool{
 	"cx52":  true, // 16 vCPU, 32 GB RAM (Intel)
 }
 
+func init() {
+	Register("hetzner", models.ProviderCapabilities{ARM: true, Snapshots: true},
+		func(cfg *config.Config) (models.CloudProvider, error) { return NewHetznerProvider(cfg.Hetzner) })
+}
+
 func NewHetznerProvider(cfg config.HetznerConfig) (*HetznerProvider, error) {
 	if cfg.Token == "" {
 		return nil, fmt.Errorf("Hetzner token is required")
 	}
 
-	fmt.Printf("🔑 Initializing Hetzner provider with token: %s...%s\n", 
-		cfg.Token[:8], cfg.Token[len(cfg.Token)-8:])
+	slog.Info("Initializing Hetzner provider")
 
-	client := hcloud.NewClient(hcloud.WithToken(cfg.Token))
+	client := hcloud.NewClient(
+		hcloud.WithToken(cfg.Token),
+		hcloud.WithHTTPClient(&http.Client{Transport: tracing.Transport(http.DefaultTransport)}),
+	)
 
 	return &HetznerProvider{
 		client: client,
@@ -55,78 +70,39 @@ func (p *HetznerProvider) SupportsInstanceType(instanceType string) bool {
 	return hetznerInstanceTypes[instanceType]
 }
 
-func (p *HetznerProvider) CreateVM(req *models.VMRequest) (*models.VMResponse, error) {
-	ctx := context.Background()
+// IsGPUInstanceType reports false; Hetzner Cloud offers no GPU servers.
+func (p *HetznerProvider) IsGPUInstanceType(instanceType string) bool {
+	return false
+}
 
-	// Test API connection first
-	fmt.Printf("🔍 Testing Hetzner API connection...\n")
-	serverTypes, _, err := p.client.ServerType.List(ctx, hcloud.ServerTypeListOpts{})
+func (p *HetznerProvider) CreateVM(ctx context.Context, req *models.VMRequest) (*models.VMResponse, error) {
+	operations.ReportProgress(ctx, "looking up server type")
+	serverType, err := p.lookupServerType(ctx, req.InstanceType)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Hetzner API: %w", err)
+		return nil, err
 	}
-	fmt.Printf("✅ Successfully connected to Hetzner API, found %d server types\n", len(serverTypes))
-
-	// Generate SSH credentials
-	sshPassword := utils.GenerateRandomPassword(16)
 
-	// Get server type
-	fmt.Printf("🔍 Looking for server type: %s\n", req.InstanceType)
-	
-	// First, let's see all available server types
-	fmt.Printf("🔍 Available Hetzner server types:\n")
-	for _, st := range serverTypes {
-		fmt.Printf("  - %s: %d CPU, %.1fGB RAM\n", 
-			st.Name, st.Cores, st.Memory)
-	}
-	
-	serverType, _, err := p.client.ServerType.GetByName(ctx, req.InstanceType)
-	if err != nil {
-		return nil, fmt.Errorf("invalid instance type '%s' - see available types above: %w", req.InstanceType, err)
+	// Generate a password only if the caller opted in to password login
+	sshPassword := ""
+	if req.EnablePasswordAuth {
+		sshPassword = utils.GenerateRandomPassword(16)
 	}
 
-	// Get datacenter/location
-	datacenter, _, err := p.client.Datacenter.GetByName(ctx, req.Region)
+	operations.ReportProgress(ctx, "resolving datacenter")
+	datacenter, err := p.lookupDatacenter(ctx, req.Region)
 	if err != nil {
-		// Try as location instead
-		location, _, err := p.client.Location.GetByName(ctx, req.Region)
-		if err != nil {
-			return nil, fmt.Errorf("invalid region %s: %w", req.Region, err)
-		}
-		// Get first datacenter from location
-		datacenters, _, err := p.client.Datacenter.List(ctx, hcloud.DatacenterListOpts{})
-		if err != nil {
-			return nil, fmt.Errorf("failed to list datacenters: %w", err)
-		}
-		for _, dc := range datacenters {
-			if dc.Location.Name == location.Name {
-				datacenter = dc
-				break
-			}
-		}
-		if datacenter == nil {
-			return nil, fmt.Errorf("no datacenter found for location %s", req.Region)
-		}
+		return nil, err
 	}
 
-	// Get image
-	imageName := req.Image
-	if imageName == "" {
-		imageName = "ubuntu-20.04"
-	}
-	
-	image, _, err := p.client.Image.GetByName(ctx, imageName)
+	operations.ReportProgress(ctx, "resolving image")
+	image, err := p.lookupImage(ctx, req.Image)
 	if err != nil {
-		return nil, fmt.Errorf("invalid image %s: %w", imageName, err)
+		return nil, err
 	}
 
 	// Generate cloud-init script
 	cloudInitScript := fmt.Sprintf(`#!/bin/bash
-# Set up SSH access
-echo 'root:%s' | chpasswd
-sed -i 's/PasswordAuthentication no/PasswordAuthentication yes/' /etc/ssh/sshd_config
-sed -i 's/#PasswordAuthentication yes/PasswordAuthentication yes/' /etc/ssh/sshd_config
-systemctl restart sshd
-
+%s
 # Install basic development tools
 apt-get update
 apt-get install -y htop git curl wget build-essential python3 python3-pip nodejs npm docker.io
@@ -144,7 +120,7 @@ cat > /etc/motd << 'EOF'
 
 Instance Type: %s
 Provider: Hetzner Cloud
-SSH Password: %s
+%s
 
 Pre-installed software:
 - Python 3 with PyTorch (CPU), TensorFlow (CPU), Jupyter
@@ -158,26 +134,52 @@ Happy coding! 🎉
 EOF
 
 echo "✅ Hetzner VM setup complete!"
-`, sshPassword, req.InstanceType, sshPassword)
+`, sshAccessScript("root", "/root", req.SSHPublicKeys, sshPassword)+volumeMountScript(req.Volumes, hetznerVolumeDevicePaths),
+		req.InstanceType, motdLoginLine(sshPassword))
+
+	// Volumes are attached at creation and mounted by cloud-init
+	var volumes []*hcloud.Volume
+	for _, mount := range req.Volumes {
+		volume, err := p.getVolume(ctx, mount.VolumeID)
+		if err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, volume)
+	}
+
+	// Every server gets its own firewall holding its policy
+	operations.ReportProgress(ctx, "creating firewall")
+	firewall, err := p.createFirewall(ctx, req.UserID, req.Firewall, nil)
+	if err != nil {
+		return nil, err
+	}
 
 	// Sanitize server name for Hetzner (alphanumeric + hyphens only, max 63 chars)
 	sanitizedName := sanitizeHetznerName(req.Name)
 
 	// Create server
+	operations.ReportProgress(ctx, "creating server")
 	createOpts := hcloud.ServerCreateOpts{
 		Name:       sanitizedName,
 		ServerType: serverType,
 		Image:      image,
 		Datacenter: datacenter,
 		UserData:   cloudInitScript,
+		Volumes:    volumes,
+		Firewalls:  []*hcloud.ServerCreateFirewall{{Firewall: *firewall}},
 		Labels: map[string]string{
 			"provider": "wolkenlauf",
 			"managed":  "true",
+			"userId":   models.OwnerLabel(req.UserID),
 		},
 	}
 
 	result, _, err := p.client.Server.Create(ctx, createOpts)
 	if err != nil {
+		p.deleteFirewall(context.WithoutCancel(ctx), firewall)
+		if hcloud.IsError(err, hcloud.ErrorCodeResourceUnavailable) || hcloud.IsError(err, hcloud.ErrorCodePlacementError) {
+			return nil, fmt.Errorf("failed to create Hetzner server in %s: %w: %w", req.Region, models.ErrInsufficientCapacity, err)
+		}
 		return nil, fmt.Errorf("failed to create Hetzner server: %w", err)
 	}
 
@@ -201,33 +203,184 @@ echo "✅ Hetzner VM setup complete!"
 	}, nil
 }
 
-func (p *HetznerProvider) DeleteVM(id string) error {
-	ctx := context.Background()
+func (p *HetznerProvider) lookupServerType(ctx context.Context, instanceType string) (_ *hcloud.ServerType, err error) {
+	ctx, span := tracing.Start(ctx, "hetzner.lookupServerType", trace.WithAttributes(attribute.String("hetzner.server_type", instanceType)))
+	defer tracing.End(span, &err)
 
-	// Convert string ID to int64
-	var serverID int64
-	fmt.Sscanf(id, "%d", &serverID)
+	// Test API connection first
+	logger := logging.FromContext(ctx)
+	serverTypes, _, err := p.client.ServerType.List(ctx, hcloud.ServerTypeListOpts{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Hetzner API: %w", err)
+	}
+	logger.Debug("Connected to Hetzner API", "server_types", len(serverTypes))
 
-	server, _, err := p.client.Server.GetByID(ctx, serverID)
+	// Get server type
+	logger.Debug("Looking for server type", "instance_type", instanceType)
+	
+	// First, let's see all available server types
+	for _, st := range serverTypes {
+		logger.Debug("Available Hetzner server type", "name", st.Name, "cores", st.Cores, "memory_gb", st.Memory)
+	}
+	
+	serverType, _, err := p.client.ServerType.GetByName(ctx, instanceType)
 	if err != nil {
-		return fmt.Errorf("failed to find server: %w", err)
+		return nil, fmt.Errorf("invalid instance type '%s' - see available types above: %w", instanceType, err)
 	}
+	return serverType, nil
+}
 
-	if server == nil {
-		return fmt.Errorf("server not found")
+// lookupDatacenter accepts a datacenter or, failing that, a location name.
+func (p *HetznerProvider) lookupDatacenter(ctx context.Context, region string) (_ *hcloud.Datacenter, err error) {
+	ctx, span := tracing.Start(ctx, "hetzner.lookupDatacenter", trace.WithAttributes(attribute.String("cloud.region", region)))
+	defer tracing.End(span, &err)
+
+	// Get datacenter/location
+	datacenter, _, err := p.client.Datacenter.GetByName(ctx, region)
+	if err != nil {
+		// Try as location instead
+		location, _, err := p.client.Location.GetByName(ctx, region)
+		if err != nil {
+			return nil, fmt.Errorf("invalid region %s: %w", region, err)
+		}
+		// Get first datacenter from location
+		datacenters, _, err := p.client.Datacenter.List(ctx, hcloud.DatacenterListOpts{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list datacenters: %w", err)
+		}
+		for _, dc := range datacenters {
+			if dc.Location.Name == location.Name {
+				datacenter = dc
+				break
+			}
+		}
+		if datacenter == nil {
+			return nil, fmt.Errorf("no datacenter found for location %s", region)
+		}
 	}
+	return datacenter, nil
+}
 
-	_, err = p.client.Server.Delete(ctx, server)
+func (p *HetznerProvider) lookupImage(ctx context.Context, imageName string) (_ *hcloud.Image, err error) {
+	if imageName == "" {
+		imageName = "ubuntu-20.04"
+	}
+	ctx, span := tracing.Start(ctx, "hetzner.lookupImage", trace.WithAttributes(attribute.String("hetzner.image", imageName)))
+	defer tracing.End(span, &err)
+
+	// Snapshots are addressed by ID, system images by name
+	image, _, err := p.client.Image.Get(ctx, imageName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image %s: %w", imageName, err)
+	}
+	if image == nil {
+		return nil, fmt.Errorf("image %s not found", imageName)
+	}
+	return image, nil
+}
+
+// DeleteVM ignores region: Hetzner server IDs are global.
+func (p *HetznerProvider) DeleteVM(ctx context.Context, region, id string) error {
+	server, err := p.getServer(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	firewalls, err := p.serverFirewalls(ctx, server)
+	if err != nil {
+		return err
+	}
+
+	result, _, err := p.client.Server.DeleteWithResult(ctx, server)
 	if err != nil {
 		return fmt.Errorf("failed to delete server: %w", err)
 	}
 
+	// Firewalls can only be deleted once the server is gone
+	if len(firewalls) > 0 {
+		if err := p.client.Action.WaitFor(ctx, result.Action); err != nil {
+			logging.FromContext(ctx).Warn("Server deletion not confirmed, keeping its firewall", "vm_id", id, "error", err)
+			return nil
+		}
+		for _, firewall := range firewalls {
+			p.deleteFirewall(ctx, firewall)
+		}
+	}
+
+	return nil
+}
+
+// StopVM shuts the server down gracefully (ACPI), or powers it off when
+// force is set. Stopped Hetzner servers keep their disk and are still billed.
+func (p *HetznerProvider) StopVM(ctx context.Context, region, id string, force bool) error {
+	server, err := p.getServer(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if force {
+		_, _, err = p.client.Server.Poweroff(ctx, server)
+	} else {
+		_, _, err = p.client.Server.Shutdown(ctx, server)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stop server: %w", err)
+	}
+	return nil
+}
+
+func (p *HetznerProvider) StartVM(ctx context.Context, region, id string) error {
+	server, err := p.getServer(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if _, _, err := p.client.Server.Poweron(ctx, server); err != nil {
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+	return nil
+}
+
+// RebootVM reboots via ACPI, or resets the server (hard reboot) when hard is set.
+func (p *HetznerProvider) RebootVM(ctx context.Context, region, id string, hard bool) error {
+	server, err := p.getServer(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if hard {
+		_, _, err = p.client.Server.Reset(ctx, server)
+	} else {
+		_, _, err = p.client.Server.Reboot(ctx, server)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reboot server: %w", err)
+	}
 	return nil
 }
 
-func (p *HetznerProvider) GetVMStatus(id string) (*models.VMStatus, error) {
-	ctx := context.Background()
+// getServer parses a server ID and fetches the server.
+func (p *HetznerProvider) getServer(ctx context.Context, id string) (*hcloud.Server, error) {
+	// Convert string ID to int64
+	var serverID int64
+	n, err := fmt.Sscanf(id, "%d", &serverID)
+	if err != nil || n != 1 {
+		return nil, fmt.Errorf("invalid server ID format '%s': %w", id, err)
+	}
+
+	server, _, err := p.client.Server.GetByID(ctx, serverID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find server: %w", err)
+	}
+
+	if server == nil {
+		return nil, fmt.Errorf("server %s: %w", id, models.ErrVMNotFound)
+	}
+	return server, nil
+}
 
+// GetVMStatus ignores region: Hetzner server IDs are global.
+func (p *HetznerProvider) GetVMStatus(ctx context.Context, region, id string) (*models.VMStatus, error) {
 	// Convert string ID to int64
 	var serverID int64
 	n, err := fmt.Sscanf(id, "%d", &serverID)
@@ -235,7 +388,8 @@ func (p *HetznerProvider) GetVMStatus(id string) (*models.VMStatus, error) {
 		return nil, fmt.Errorf("invalid server ID format '%s': %w", id, err)
 	}
 
-	fmt.Printf("🔍 Checking Hetzner server status for ID: %s (parsed as %d)\n", id, serverID)
+	logger := logging.FromContext(ctx)
+	logger.Debug("Checking Hetzner server status", "vm_id", id)
 
 	server, _, err := p.client.Server.GetByID(ctx, serverID)
 	if err != nil {
@@ -243,51 +397,136 @@ func (p *HetznerProvider) GetVMStatus(id string) (*models.VMStatus, error) {
 	}
 
 	if server == nil {
-		return nil, fmt.Errorf("server not found")
+		return nil, fmt.Errorf("server %s: %w", id, models.ErrVMNotFound)
 	}
 
 	// Log the raw status from Hetzner API
 	rawStatus := string(server.Status)
-	fmt.Printf("📊 Raw Hetzner server status: '%s'\n", rawStatus)
+	logger.Debug("Raw Hetzner server status", "vm_id", id, "status", rawStatus)
 
 	// Convert Hetzner status to our standard status
-	status := strings.ToLower(rawStatus)
-	originalStatus := status
-	
-	switch status {
-	case "initializing":
-		status = "pending"
-	case "starting":
-		status = "pending"
-	case "running":
-		status = "running"
-	case "stopping":
-		status = "stopping"
-	case "off":
-		status = "stopped"
-	case "deleting":
-		status = "terminated"
-	default:
-		// Log unknown status for debugging
-		fmt.Printf("⚠️  Unknown Hetzner status '%s', defaulting to 'pending'\n", originalStatus)
-		status = "pending"
-	}
+	originalStatus := strings.ToLower(rawStatus)
+	status := normalizeHetznerStatus(server.Status)
 
 	publicIP := ""
 	if server.PublicNet.IPv4.IP != nil {
 		publicIP = server.PublicNet.IPv4.IP.String()
 	}
 
-	fmt.Printf("📡 Hetzner VM %s: Status %s -> %s, IP: %s\n", id, originalStatus, status, publicIP)
+	logger.Debug("Hetzner VM status", "vm_id", id, "raw_status", originalStatus, "status", status, "public_ip", publicIP)
+
+	location := ""
+	if server.Datacenter != nil && server.Datacenter.Location != nil {
+		location = server.Datacenter.Location.Name
+	}
 
 	return &models.VMStatus{
 		ID:        id,
+		Region:    location,
 		Status:    status,
 		PublicIP:  publicIP,
+		UserID:    server.Labels["userId"],
 		UpdatedAt: time.Now(),
 	}, nil
 }
 
+// GetVMStatuses lists all servers labelled provider=wolkenlauf in one
+// paginated call and picks the requested ones. region is ignored: Hetzner
+// server IDs are global.
+func (p *HetznerProvider) GetVMStatuses(ctx context.Context, region string, ids []string) ([]models.VMStatus, error) {
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	servers, err := p.client.Server.AllWithOpts(ctx, hcloud.ServerListOpts{
+		ListOpts: hcloud.ListOpts{LabelSelector: "provider=wolkenlauf"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Hetzner servers: %w", err)
+	}
+
+	var statuses []models.VMStatus
+	for _, server := range servers {
+		id := strconv.FormatInt(server.ID, 10)
+		if !wanted[id] {
+			continue
+		}
+
+		status := models.VMStatus{
+			ID:        id,
+			Status:    normalizeHetznerStatus(server.Status),
+			UserID:    server.Labels["userId"],
+			UpdatedAt: time.Now(),
+		}
+		if server.PublicNet.IPv4.IP != nil {
+			status.PublicIP = server.PublicNet.IPv4.IP.String()
+		}
+		if server.Datacenter != nil && server.Datacenter.Location != nil {
+			status.Region = server.Datacenter.Location.Name
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// ListManagedVMs returns every server labelled provider=wolkenlauf. Hetzner
+// lists all locations at once, so regions is ignored.
+func (p *HetznerProvider) ListManagedVMs(ctx context.Context, regions []string) ([]models.ManagedVM, error) {
+	servers, err := p.client.Server.AllWithOpts(ctx, hcloud.ServerListOpts{
+		ListOpts: hcloud.ListOpts{LabelSelector: "provider=wolkenlauf"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Hetzner servers: %w", err)
+	}
+
+	vms := make([]models.ManagedVM, 0, len(servers))
+	for _, server := range servers {
+		vm := models.ManagedVM{
+			ID:        fmt.Sprintf("%d", server.ID),
+			Provider:  "hetzner",
+			Name:      server.Name,
+			UserID:    server.Labels["userId"],
+			Status:    normalizeHetznerStatus(server.Status),
+			CreatedAt: server.Created,
+		}
+		if server.ServerType != nil {
+			vm.InstanceType = server.ServerType.Name
+		}
+		if server.Datacenter != nil && server.Datacenter.Location != nil {
+			vm.Region = server.Datacenter.Location.Name
+		}
+		if server.PublicNet.IPv4.IP != nil {
+			vm.PublicIP = server.PublicNet.IPv4.IP.String()
+		}
+		vms = append(vms, vm)
+	}
+	return vms, nil
+}
+
+// normalizeHetznerStatus converts Hetzner status to our standard status
+func normalizeHetznerStatus(serverStatus hcloud.ServerStatus) string {
+	status := strings.ToLower(string(serverStatus))
+	switch status {
+	case "initializing":
+		return "pending"
+	case "starting":
+		return "pending"
+	case "running":
+		return "running"
+	case "stopping":
+		return "stopping"
+	case "off":
+		return "stopped"
+	case "deleting":
+		return "terminated"
+	default:
+		// Log unknown status for debugging
+		slog.Warn("Unknown Hetzner status, defaulting to pending", "status", status)
+		return "pending"
+	}
+}
+
 // sanitizeHetznerName cleans the name to meet Hetzner requirements
 // Rules: alphanumeric + hyphens only, max 63 chars, no leading/trailing hyphens
 func sanitizeHetznerName(name string) string {
@@ -317,4 +556,91 @@ func sanitizeHetznerName(name string) string {
 	}
 	
 	return name
-}
\ No newline at end of file
+}
+
+// ListInstanceTypes lists the supported server types with their price in
+// every location, or only in region when it names a location or datacenter.
+func (p *HetznerProvider) ListInstanceTypes(ctx context.Context, region string) ([]models.InstanceTypeSpec, error) {
+	serverTypes, err := p.client.ServerType.All(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Hetzner server types: %w", err)
+	}
+
+	var specs []models.InstanceTypeSpec
+	for _, serverType := range serverTypes {
+		if !p.SupportsInstanceType(serverType.Name) || serverType.IsDeprecated() {
+			continue
+		}
+
+		architecture := models.ArchX86_64
+		if serverType.Architecture == hcloud.ArchitectureARM {
+			architecture = models.ArchARM64
+		}
+
+		for _, pricing := range serverType.Pricings {
+			if pricing.Location == nil {
+				continue
+			}
+			location := pricing.Location.Name
+			if region != "" && region != location && !strings.HasPrefix(region, location+"-") {
+				continue
+			}
+
+			hourly, err := strconv.ParseFloat(pricing.Hourly.Gross, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid hourly price %q for %s in %s: %w", pricing.Hourly.Gross, serverType.Name, location, err)
+			}
+			specs = append(specs, models.InstanceTypeSpec{
+				Provider:     "hetzner",
+				Name:         serverType.Name,
+				Region:       location,
+				VCPUs:        serverType.Cores,
+				MemoryGiB:    float64(serverType.Memory),
+				Architecture: architecture,
+				HourlyPrice:  hourly,
+				Currency:     pricing.Hourly.Currency,
+			})
+		}
+	}
+	return specs, nil
+}
+
+// PriceResources looks up the primary IPv4 price of the request's location.
+// The local disk is included in the server price.
+func (p *HetznerProvider) PriceResources(ctx context.Context, req *models.VMRequest) (*models.ResourcePrices, error) {
+	serverType, _, err := p.client.ServerType.GetByName(ctx, req.InstanceType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up server type %s: %w", req.InstanceType, err)
+	}
+	if serverType == nil {
+		return nil, fmt.Errorf("unknown server type %s", req.InstanceType)
+	}
+
+	pricing, _, err := p.client.Pricing.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Hetzner pricing: %w", err)
+	}
+
+	prices := &models.ResourcePrices{DiskGiB: serverType.Disk, Currency: pricing.Image.PerGBMonth.Currency}
+	for _, primaryIP := range pricing.PrimaryIPs {
+		if primaryIP.Type != string(hcloud.PrimaryIPTypeIPv4) {
+			continue
+		}
+		for _, locationPricing := range primaryIP.Pricings {
+			if req.Region != locationPricing.Location && !strings.HasPrefix(req.Region, locationPricing.Location+"-") {
+				continue
+			}
+			hourly, err := strconv.ParseFloat(locationPricing.Hourly.Gross, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IPv4 price %q in %s: %w", locationPricing.Hourly.Gross, locationPricing.Location, err)
+			}
+			prices.PublicIPv4Hourly = hourly
+		}
+	}
+	return prices, nil
+}
+
+// CheckSpotInstances reports nothing; Hetzner has no spot market.
+func (p *HetznerProvider) CheckSpotInstances(ctx context.Context, region string, ids []string) ([]models.SpotStatus, error) {
+	return nil, nil
+}
@@ -0,0 +1,123 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"vm-provisioner/internal/logging"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/tracing"
+	"vm-provisioner/internal/utils"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// SetFirewall ignores region: Hetzner firewall and server IDs are global.
+// Rules of the VM's firewall are replaced in one call; servers created
+// without one get a new firewall applied.
+func (p *HetznerProvider) SetFirewall(ctx context.Context, region, vmID string, policy *models.FirewallPolicy) error {
+	server, err := p.getServer(ctx, vmID)
+	if err != nil {
+		return err
+	}
+	firewalls, err := p.serverFirewalls(ctx, server)
+	if err != nil {
+		return err
+	}
+
+	if len(firewalls) == 0 {
+		firewall, err := p.createFirewall(ctx, server.Labels["userId"], policy, server)
+		if err != nil {
+			return err
+		}
+		logging.FromContext(ctx).Info("Applied firewall to server", "firewall_id", firewall.ID, "vm_id", vmID)
+		return nil
+	}
+
+	actions, _, err := p.client.Firewall.SetRules(ctx, firewalls[0], hcloud.FirewallSetRulesOpts{Rules: hetznerFirewallRules(policy)})
+	if err == nil {
+		err = p.client.Action.WaitFor(ctx, actions...)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update firewall of server %s: %w", vmID, err)
+	}
+	return nil
+}
+
+// createFirewall creates a firewall holding the policy, applied to server
+// if one is given.
+func (p *HetznerProvider) createFirewall(ctx context.Context, userID string, policy *models.FirewallPolicy, server *hcloud.Server) (_ *hcloud.Firewall, err error) {
+	ctx, span := tracing.Start(ctx, "hetzner.createFirewall")
+	defer tracing.End(span, &err)
+
+	opts := hcloud.FirewallCreateOpts{
+		Name:  utils.GenerateID(vmFirewallPrefix),
+		Rules: hetznerFirewallRules(policy),
+		Labels: map[string]string{
+			"provider": "wolkenlauf",
+			"managed":  "true",
+			"userId":   models.OwnerLabel(userID),
+		},
+	}
+	if server != nil {
+		opts.ApplyTo = []hcloud.FirewallResource{{
+			Type:   hcloud.FirewallResourceTypeServer,
+			Server: &hcloud.FirewallResourceServer{ID: server.ID},
+		}}
+	}
+
+	result, _, err := p.client.Firewall.Create(ctx, opts)
+	if err == nil {
+		err = p.client.Action.WaitFor(ctx, result.Actions...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create firewall: %w", err)
+	}
+	return result.Firewall, nil
+}
+
+// serverFirewalls returns the firewalls dedicated to the server, leaving
+// out firewalls shared with other servers.
+func (p *HetznerProvider) serverFirewalls(ctx context.Context, server *hcloud.Server) ([]*hcloud.Firewall, error) {
+	var firewalls []*hcloud.Firewall
+	for _, status := range server.PublicNet.Firewalls {
+		firewall, _, err := p.client.Firewall.GetByID(ctx, status.Firewall.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find firewall %d: %w", status.Firewall.ID, err)
+		}
+		if firewall != nil && isVMFirewall(firewall.Name) {
+			firewalls = append(firewalls, firewall)
+		}
+	}
+	return firewalls, nil
+}
+
+// deleteFirewall deletes a firewall no server uses anymore. Failures are
+// logged: they leave a stray firewall behind but do not fail the caller.
+func (p *HetznerProvider) deleteFirewall(ctx context.Context, firewall *hcloud.Firewall) {
+	if _, err := p.client.Firewall.Delete(ctx, firewall); err != nil && !hcloud.IsError(err, hcloud.ErrorCodeNotFound) {
+		logging.FromContext(ctx).Warn("Failed to delete firewall", "firewall_id", firewall.ID, "error", err)
+	}
+}
+
+// hetznerFirewallRules converts a policy into inbound firewall rules.
+func hetznerFirewallRules(policy *models.FirewallPolicy) []hcloud.FirewallRule {
+	var rules []hcloud.FirewallRule
+	for _, rule := range policy.Rules() {
+		var sources []net.IPNet
+		for _, cidr := range rule.SourceCIDRs {
+			if _, network, err := net.ParseCIDR(cidr); err == nil {
+				sources = append(sources, *network)
+			}
+		}
+		rules = append(rules, hcloud.FirewallRule{
+			Direction: hcloud.FirewallRuleDirectionIn,
+			SourceIPs: sources,
+			Protocol:  hcloud.FirewallRuleProtocol(rule.Protocol),
+			Port:      hcloud.Ptr(strconv.Itoa(rule.Port)),
+		})
+	}
+	return rules
+}
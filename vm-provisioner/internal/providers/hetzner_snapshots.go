@@ -0,0 +1,99 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"vm-provisioner/internal/models"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// hetznerSnapshotPoll is how often a pending snapshot image is checked.
+const hetznerSnapshotPoll = 5 * time.Second
+
+// CreateSnapshot creates a snapshot image of the server's disk. Hetzner
+// images are global, so the snapshot has no region.
+func (p *HetznerProvider) CreateSnapshot(ctx context.Context, region, vmID string, req *models.SnapshotRequest) (*models.Snapshot, error) {
+	server, err := p.getServer(ctx, vmID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, _, err := p.client.Server.CreateImage(ctx, server, &hcloud.ServerCreateImageOpts{
+		Type:        hcloud.ImageTypeSnapshot,
+		Description: hcloud.Ptr(req.Name),
+		Labels: map[string]string{
+			"provider": "wolkenlauf",
+			"managed":  "true",
+			"userId":   models.OwnerLabel(req.UserID),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot of server %s: %w", vmID, err)
+	}
+
+	return &models.Snapshot{
+		ID:          fmt.Sprintf("%d", result.Image.ID),
+		Provider:    "hetzner",
+		UserID:      req.UserID,
+		VMID:        vmID,
+		Name:        req.Name,
+		Status:      models.SnapshotPending,
+		SSHUsername: "root",
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+// WaitForSnapshot ignores region: Hetzner image IDs are global.
+func (p *HetznerProvider) WaitForSnapshot(ctx context.Context, region, id string) error {
+	ticker := time.NewTicker(hetznerSnapshotPoll)
+	defer ticker.Stop()
+
+	for {
+		image, err := p.getImage(ctx, id)
+		if err != nil {
+			return err
+		}
+		if image.Status == hcloud.ImageStatusAvailable {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("snapshot %s did not become available: %w", id, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeleteSnapshot ignores region: Hetzner image IDs are global.
+func (p *HetznerProvider) DeleteSnapshot(ctx context.Context, region, id string) error {
+	image, err := p.getImage(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := p.client.Image.Delete(ctx, image); err != nil {
+		return fmt.Errorf("failed to delete snapshot: %w", err)
+	}
+	return nil
+}
+
+// getImage parses an image ID and fetches the image.
+func (p *HetznerProvider) getImage(ctx context.Context, id string) (*hcloud.Image, error) {
+	var imageID int64
+	if n, err := fmt.Sscanf(id, "%d", &imageID); err != nil || n != 1 {
+		return nil, fmt.Errorf("invalid image ID format '%s': %w", id, err)
+	}
+
+	image, _, err := p.client.Image.GetByID(ctx, imageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find image: %w", err)
+	}
+	if image == nil {
+		return nil, fmt.Errorf("snapshot %s: %w", id, models.ErrSnapshotNotFound)
+	}
+	return image, nil
+}
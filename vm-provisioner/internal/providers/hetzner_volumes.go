@@ -0,0 +1,162 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"vm-provisioner/internal/models"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// hetznerVolumePoll is how often a volume held by a server is checked.
+const hetznerVolumePoll = 5 * time.Second
+
+// hetznerVolumeDevicePaths lists where a Hetzner volume shows up in the guest.
+func hetznerVolumeDevicePaths(_ int, volumeID string) []string {
+	return []string{"/dev/disk/by-id/scsi-0HC_Volume_" + volumeID}
+}
+
+// CreateVolume creates an unformatted volume in the location of req.Region,
+// which may name a location or one of its datacenters.
+func (p *HetznerProvider) CreateVolume(ctx context.Context, req *models.VolumeRequest) (*models.Volume, error) {
+	location, _, err := p.client.Location.GetByName(ctx, req.Region)
+	if err == nil && location == nil {
+		var datacenter *hcloud.Datacenter
+		datacenter, _, err = p.client.Datacenter.GetByName(ctx, req.Region)
+		if datacenter != nil {
+			location = datacenter.Location
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up region %s: %w", req.Region, err)
+	}
+	if location == nil {
+		return nil, fmt.Errorf("invalid region %s", req.Region)
+	}
+
+	result, _, err := p.client.Volume.Create(ctx, hcloud.VolumeCreateOpts{
+		Name:     sanitizeHetznerName(req.Name),
+		Size:     req.SizeGiB,
+		Location: location,
+		Labels: map[string]string{
+			"provider": "wolkenlauf",
+			"managed":  "true",
+			"userId":   models.OwnerLabel(req.UserID),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Hetzner volume: %w", err)
+	}
+	if result.Action != nil {
+		if err := p.client.Action.WaitFor(ctx, result.Action); err != nil {
+			return nil, fmt.Errorf("failed to create Hetzner volume: %w", err)
+		}
+	}
+
+	return &models.Volume{
+		ID:        fmt.Sprintf("%d", result.Volume.ID),
+		Provider:  "hetzner",
+		Region:    req.Region,
+		UserID:    req.UserID,
+		Name:      req.Name,
+		SizeGiB:   result.Volume.Size,
+		Status:    models.VolumeAvailable,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// DeleteVolume ignores region: Hetzner volume IDs are global.
+func (p *HetznerProvider) DeleteVolume(ctx context.Context, region, id string) error {
+	volume, err := p.getVolume(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := p.client.Volume.Delete(ctx, volume); err != nil {
+		return fmt.Errorf("failed to delete volume: %w", err)
+	}
+	return nil
+}
+
+// AttachVolume attaches without automount; cloud-init mounts volumes
+// attached at creation, later ones are left to the user.
+func (p *HetznerProvider) AttachVolume(ctx context.Context, region, volumeID, vmID string) error {
+	volume, err := p.getVolume(ctx, volumeID)
+	if err != nil {
+		return err
+	}
+	server, err := p.getServer(ctx, vmID)
+	if err != nil {
+		return err
+	}
+
+	action, _, err := p.client.Volume.AttachWithOpts(ctx, volume, hcloud.VolumeAttachOpts{
+		Server:    server,
+		Automount: hcloud.Ptr(false),
+	})
+	if err == nil {
+		err = p.client.Action.WaitFor(ctx, action)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to attach volume %s to server %s: %w", volumeID, vmID, err)
+	}
+	return nil
+}
+
+func (p *HetznerProvider) DetachVolume(ctx context.Context, region, volumeID string) error {
+	volume, err := p.getVolume(ctx, volumeID)
+	if err != nil {
+		return err
+	}
+
+	action, _, err := p.client.Volume.Detach(ctx, volume)
+	if err == nil {
+		err = p.client.Action.WaitFor(ctx, action)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to detach volume %s: %w", volumeID, err)
+	}
+	return nil
+}
+
+// WaitForVolume ignores region: Hetzner volume IDs are global. Volumes are
+// detached when their server is deleted.
+func (p *HetznerProvider) WaitForVolume(ctx context.Context, region, id string) error {
+	ticker := time.NewTicker(hetznerVolumePoll)
+	defer ticker.Stop()
+
+	for {
+		volume, err := p.getVolume(ctx, id)
+		if err != nil {
+			return err
+		}
+		if volume.Server == nil && volume.Status == hcloud.VolumeStatusAvailable {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("volume %s did not become available: %w", id, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// getVolume parses a volume ID and fetches the volume.
+func (p *HetznerProvider) getVolume(ctx context.Context, id string) (*hcloud.Volume, error) {
+	var volumeID int64
+	if n, err := fmt.Sscanf(id, "%d", &volumeID); err != nil || n != 1 {
+		return nil, fmt.Errorf("invalid volume ID format '%s': %w", id, err)
+	}
+
+	volume, _, err := p.client.Volume.GetByID(ctx, volumeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find volume: %w", err)
+	}
+	if volume == nil {
+		return nil, fmt.Errorf("volume %s: %w", id, models.ErrVolumeNotFound)
+	}
+	return volume, nil
+}
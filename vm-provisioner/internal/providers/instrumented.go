@@ -0,0 +1,186 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"vm-provisioner/internal/metrics"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/tracing"
+
+	"github.com/aws/smithy-go"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumented records the latency and error code of every call to a
+// provider and traces it. The registry wraps each provider it starts.
+type instrumented struct {
+	name     string
+	provider models.CloudProvider
+}
+
+func instrument(name string, provider models.CloudProvider) models.CloudProvider {
+	return &instrumented{name: name, provider: provider}
+}
+
+// start opens the span of a call and returns the function that records its
+// outcome, to be deferred with the named error result of the call.
+func (p *instrumented) start(ctx context.Context, method string) (context.Context, func(err *error)) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, p.name+"."+method, trace.WithAttributes(attribute.String("cloud.provider", p.name)))
+	return ctx, func(err *error) {
+		metrics.ProviderRequests.WithLabelValues(p.name, method, errorCode(*err)).Inc()
+		metrics.ProviderRequestDuration.WithLabelValues(p.name, method).Observe(time.Since(start).Seconds())
+		tracing.End(span, err)
+	}
+}
+
+// errorCode prefers the error code of the provider's API over the
+// provisioner's classification.
+func errorCode(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	var hcloudErr hcloud.Error
+	if errors.As(err, &hcloudErr) {
+		return string(hcloudErr.Code)
+	}
+	return models.ErrorCode(err)
+}
+
+func (p *instrumented) CreateVM(ctx context.Context, req *models.VMRequest) (_ *models.VMResponse, err error) {
+	ctx, end := p.start(ctx, "CreateVM")
+	defer end(&err)
+	return p.provider.CreateVM(ctx, req)
+}
+
+func (p *instrumented) DeleteVM(ctx context.Context, region, id string) (err error) {
+	ctx, end := p.start(ctx, "DeleteVM")
+	defer end(&err)
+	return p.provider.DeleteVM(ctx, region, id)
+}
+
+func (p *instrumented) GetVMStatus(ctx context.Context, region, id string) (_ *models.VMStatus, err error) {
+	ctx, end := p.start(ctx, "GetVMStatus")
+	defer end(&err)
+	return p.provider.GetVMStatus(ctx, region, id)
+}
+
+func (p *instrumented) GetVMStatuses(ctx context.Context, region string, ids []string) (_ []models.VMStatus, err error) {
+	ctx, end := p.start(ctx, "GetVMStatuses")
+	defer end(&err)
+	return p.provider.GetVMStatuses(ctx, region, ids)
+}
+
+func (p *instrumented) StopVM(ctx context.Context, region, id string, force bool) (err error) {
+	ctx, end := p.start(ctx, "StopVM")
+	defer end(&err)
+	return p.provider.StopVM(ctx, region, id, force)
+}
+
+func (p *instrumented) StartVM(ctx context.Context, region, id string) (err error) {
+	ctx, end := p.start(ctx, "StartVM")
+	defer end(&err)
+	return p.provider.StartVM(ctx, region, id)
+}
+
+func (p *instrumented) RebootVM(ctx context.Context, region, id string, hard bool) (err error) {
+	ctx, end := p.start(ctx, "RebootVM")
+	defer end(&err)
+	return p.provider.RebootVM(ctx, region, id, hard)
+}
+
+// SupportsInstanceType does not call the provider's API.
+func (p *instrumented) SupportsInstanceType(instanceType string) bool {
+	return p.provider.SupportsInstanceType(instanceType)
+}
+
+// IsGPUInstanceType does not call the provider's API.
+func (p *instrumented) IsGPUInstanceType(instanceType string) bool {
+	return p.provider.IsGPUInstanceType(instanceType)
+}
+
+func (p *instrumented) ListManagedVMs(ctx context.Context, regions []string) (_ []models.ManagedVM, err error) {
+	ctx, end := p.start(ctx, "ListManagedVMs")
+	defer end(&err)
+	return p.provider.ListManagedVMs(ctx, regions)
+}
+
+func (p *instrumented) ListInstanceTypes(ctx context.Context, region string) (_ []models.InstanceTypeSpec, err error) {
+	ctx, end := p.start(ctx, "ListInstanceTypes")
+	defer end(&err)
+	return p.provider.ListInstanceTypes(ctx, region)
+}
+
+func (p *instrumented) PriceResources(ctx context.Context, req *models.VMRequest) (_ *models.ResourcePrices, err error) {
+	ctx, end := p.start(ctx, "PriceResources")
+	defer end(&err)
+	return p.provider.PriceResources(ctx, req)
+}
+
+func (p *instrumented) CheckSpotInstances(ctx context.Context, region string, ids []string) (_ []models.SpotStatus, err error) {
+	ctx, end := p.start(ctx, "CheckSpotInstances")
+	defer end(&err)
+	return p.provider.CheckSpotInstances(ctx, region, ids)
+}
+
+func (p *instrumented) CreateVolume(ctx context.Context, req *models.VolumeRequest) (_ *models.Volume, err error) {
+	ctx, end := p.start(ctx, "CreateVolume")
+	defer end(&err)
+	return p.provider.CreateVolume(ctx, req)
+}
+
+func (p *instrumented) DeleteVolume(ctx context.Context, region, id string) (err error) {
+	ctx, end := p.start(ctx, "DeleteVolume")
+	defer end(&err)
+	return p.provider.DeleteVolume(ctx, region, id)
+}
+
+func (p *instrumented) AttachVolume(ctx context.Context, region, volumeID, vmID string) (err error) {
+	ctx, end := p.start(ctx, "AttachVolume")
+	defer end(&err)
+	return p.provider.AttachVolume(ctx, region, volumeID, vmID)
+}
+
+func (p *instrumented) DetachVolume(ctx context.Context, region, volumeID string) (err error) {
+	ctx, end := p.start(ctx, "DetachVolume")
+	defer end(&err)
+	return p.provider.DetachVolume(ctx, region, volumeID)
+}
+
+func (p *instrumented) WaitForVolume(ctx context.Context, region, id string) (err error) {
+	ctx, end := p.start(ctx, "WaitForVolume")
+	defer end(&err)
+	return p.provider.WaitForVolume(ctx, region, id)
+}
+
+func (p *instrumented) CreateSnapshot(ctx context.Context, region, vmID string, req *models.SnapshotRequest) (_ *models.Snapshot, err error) {
+	ctx, end := p.start(ctx, "CreateSnapshot")
+	defer end(&err)
+	return p.provider.CreateSnapshot(ctx, region, vmID, req)
+}
+
+func (p *instrumented) WaitForSnapshot(ctx context.Context, region, id string) (err error) {
+	ctx, end := p.start(ctx, "WaitForSnapshot")
+	defer end(&err)
+	return p.provider.WaitForSnapshot(ctx, region, id)
+}
+
+func (p *instrumented) DeleteSnapshot(ctx context.Context, region, id string) (err error) {
+	ctx, end := p.start(ctx, "DeleteSnapshot")
+	defer end(&err)
+	return p.provider.DeleteSnapshot(ctx, region, id)
+}
+
+func (p *instrumented) SetFirewall(ctx context.Context, region, vmID string, policy *models.FirewallPolicy) (err error) {
+	ctx, end := p.start(ctx, "SetFirewall")
+	defer end(&err)
+	return p.provider.SetFirewall(ctx, region, vmID, policy)
+}
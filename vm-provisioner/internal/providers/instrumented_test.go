@@ -0,0 +1,35 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"vm-provisioner/internal/models"
+
+	"github.com/aws/smithy-go"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"success", nil, "ok"},
+		{"EC2 error", fmt.Errorf("run instances: %w", &smithy.GenericAPIError{Code: "InsufficientInstanceCapacity"}), "InsufficientInstanceCapacity"},
+		{"Hetzner error", fmt.Errorf("create server: %w", hcloud.Error{Code: hcloud.ErrorCodeResourceUnavailable}), "resource_unavailable"},
+		{"classified error", fmt.Errorf("describe: %w", models.ErrVMNotFound), "not_found"},
+		{"deadline", context.DeadlineExceeded, "timeout"},
+		{"other error", errors.New("connection reset"), "provider_error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorCode(tt.err); got != tt.want {
+				t.Errorf("errorCode() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
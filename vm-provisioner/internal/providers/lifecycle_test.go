@@ -0,0 +1,44 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"vm-provisioner/internal/models"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// Both providers must report a VM going through a stop the same way.
+func TestNormalizeStatus(t *testing.T) {
+	tests := []struct {
+		aws     types.InstanceStateName
+		hetzner hcloud.ServerStatus
+		want    string
+	}{
+		{types.InstanceStateNamePending, hcloud.ServerStatusInitializing, "pending"},
+		{types.InstanceStateNameRunning, hcloud.ServerStatusRunning, "running"},
+		{types.InstanceStateNameStopping, hcloud.ServerStatusStopping, "stopping"},
+		{types.InstanceStateNameStopped, hcloud.ServerStatusOff, "stopped"},
+		{types.InstanceStateNameShuttingDown, hcloud.ServerStatusDeleting, "terminated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := normalizeAWSState(tt.aws); got != tt.want {
+				t.Errorf("normalizeAWSState(%s) = %s, want %s", tt.aws, got, tt.want)
+			}
+			if got := normalizeHetznerStatus(tt.hetzner); got != tt.want {
+				t.Errorf("normalizeHetznerStatus(%s) = %s, want %s", tt.hetzner, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAWSHardRebootNotSupported(t *testing.T) {
+	p := &AWSProvider{}
+	if err := p.RebootVM(context.Background(), "us-east-1", "i-0123", true); !errors.Is(err, models.ErrOperationNotSupported) {
+		t.Fatalf("RebootVM(hard) = %v, want ErrOperationNotSupported", err)
+	}
+}
@@ -0,0 +1,135 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"sync"
+
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/models"
+)
+
+var (
+	// ErrUnknownProvider is returned for provider names nobody registered.
+	ErrUnknownProvider = errors.New("unsupported provider")
+	// ErrProviderUnavailable is returned for providers that are disabled or
+	// failed to initialize.
+	ErrProviderUnavailable = errors.New("provider unavailable")
+)
+
+// Factory builds a provider from the provisioner configuration.
+type Factory func(cfg *config.Config) (models.CloudProvider, error)
+
+type registration struct {
+	capabilities models.ProviderCapabilities
+	factory      Factory
+}
+
+var (
+	registrationsMu sync.Mutex
+	registrations   = map[string]registration{}
+)
+
+// Register makes a provider available under name. Providers call it from
+// init, so adding a cloud only needs its own file and config section.
+func Register(name string, capabilities models.ProviderCapabilities, factory Factory) {
+	registrationsMu.Lock()
+	defer registrationsMu.Unlock()
+
+	if _, dup := registrations[name]; dup {
+		panic("providers: Register called twice for " + name)
+	}
+	registrations[name] = registration{capabilities: capabilities, factory: factory}
+}
+
+// Registry holds the providers started for this process.
+type Registry struct {
+	providers map[string]models.CloudProvider
+	infos     map[string]models.ProviderInfo
+}
+
+// NewRegistry starts every registered provider enabled in cfg. A provider
+// that fails to initialize is logged and marked degraded instead of
+// stopping the provisioner, so the other clouds keep working.
+func NewRegistry(cfg *config.Config) *Registry {
+	registrationsMu.Lock()
+	defer registrationsMu.Unlock()
+
+	r := &Registry{
+		providers: map[string]models.CloudProvider{},
+		infos:     map[string]models.ProviderInfo{},
+	}
+
+	for _, name := range cfg.Providers.Enabled {
+		if _, ok := registrations[name]; !ok {
+			slog.Warn("ENABLED_PROVIDERS names unknown provider", "provider", name)
+		}
+	}
+
+	for name, reg := range registrations {
+		info := models.ProviderInfo{Name: name, Capabilities: reg.capabilities}
+		if len(cfg.Providers.Enabled) > 0 && !slices.Contains(cfg.Providers.Enabled, name) {
+			info.Status = models.ProviderDisabled
+			r.infos[name] = info
+			slog.Info("Provider is disabled", "provider", name)
+			continue
+		}
+
+		switch provider, err := reg.factory(cfg); {
+		case err != nil:
+			info.Status = models.ProviderDegraded
+			info.Error = err.Error()
+			slog.Warn("Provider failed to initialize, continuing without it", "provider", name, "error", err)
+		default:
+			info.Status = models.ProviderAvailable
+			r.providers[name] = instrument(name, provider)
+			slog.Info("Provider ready", "provider", name)
+		}
+		r.infos[name] = info
+	}
+
+	return r
+}
+
+// Get returns the named provider if it is available.
+func (r *Registry) Get(name string) (models.CloudProvider, error) {
+	if provider, ok := r.providers[name]; ok {
+		return provider, nil
+	}
+	info, ok := r.infos[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+	if info.Error != "" {
+		return nil, fmt.Errorf("%w: %s is %s: %s", ErrProviderUnavailable, name, info.Status, info.Error)
+	}
+	return nil, fmt.Errorf("%w: %s is %s", ErrProviderUnavailable, name, info.Status)
+}
+
+// Capabilities returns what the named provider advertised when it
+// registered; unknown providers have none.
+func (r *Registry) Capabilities(name string) models.ProviderCapabilities {
+	return r.infos[name].Capabilities
+}
+
+// Available returns the providers that started successfully, by name.
+func (r *Registry) Available() map[string]models.CloudProvider {
+	available := make(map[string]models.CloudProvider, len(r.providers))
+	for name, provider := range r.providers {
+		available[name] = provider
+	}
+	return available
+}
+
+// List describes every registered provider, sorted by name.
+func (r *Registry) List() []models.ProviderInfo {
+	infos := make([]models.ProviderInfo, 0, len(r.infos))
+	for _, info := range r.infos {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
@@ -0,0 +1,140 @@
+package reaper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/events"
+	"vm-provisioner/internal/logging"
+	"vm-provisioner/internal/metrics"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/store"
+)
+
+// Reaper terminates VMs whose auto-termination deadline has passed and warns
+// ahead of time. Deadlines live in the store, so a restart loses nothing:
+// the first sweep after startup catches up on everything that expired while
+// the provisioner was down.
+type Reaper struct {
+	store     *store.Store
+	bus       *events.Bus
+	providers map[string]models.CloudProvider
+	cfg       config.ReaperConfig
+	timeout   time.Duration
+}
+
+func New(st *store.Store, bus *events.Bus, providers map[string]models.CloudProvider, cfg config.ReaperConfig, deleteTimeout time.Duration) *Reaper {
+	return &Reaper{
+		store:     st,
+		bus:       bus,
+		providers: providers,
+		cfg:       cfg,
+		timeout:   deleteTimeout,
+	}
+}
+
+// Run sweeps immediately and then on every interval until ctx is canceled.
+func (r *Reaper) Run(ctx context.Context) {
+	slog.Info("Reaper started", "interval", r.cfg.Interval, "warning_lead", r.cfg.WarningLead)
+
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		r.Sweep(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep emits due warnings and terminates expired VMs once.
+func (r *Reaper) Sweep(ctx context.Context) {
+	now := time.Now()
+
+	toWarn, err := r.store.ListVMsToWarn(ctx, now.Add(r.cfg.WarningLead))
+	if err != nil {
+		slog.Error("Reaper failed to list VMs to warn", "error", err)
+	}
+	for _, vm := range toWarn {
+		if vm.ExpiresAt.After(now) { // already expired VMs are terminated below
+			r.warn(ctx, vm, now)
+		}
+	}
+
+	expired, err := r.store.ListExpiredVMs(ctx, now)
+	if err != nil {
+		slog.Error("Reaper failed to list expired VMs", "error", err)
+		return
+	}
+	for _, vm := range expired {
+		if err := r.terminate(ctx, vm); err != nil {
+			// Left in place, the next sweep retries.
+			slog.Error("Reaper failed to terminate VM", "vm_id", vm.ID, "error", err)
+		}
+	}
+}
+
+func (r *Reaper) warn(ctx context.Context, vm models.VMRecord, now time.Time) {
+	remaining := vm.ExpiresAt.Sub(now).Round(time.Second)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	_, err := r.bus.Publish(ctx, models.VMEvent{
+		VMID:    vm.ID,
+		UserID:  vm.UserID,
+		Type:    models.EventTTLWarning,
+		Message: fmt.Sprintf("VM %s will be terminated in %s", vm.Name, remaining),
+		Data: map[string]any{
+			"expiresAt":        vm.ExpiresAt,
+			"remainingSeconds": int(remaining.Seconds()),
+		},
+	})
+	if err != nil {
+		slog.Error("Reaper failed to publish TTL warning", "vm_id", vm.ID, "error", err)
+		return
+	}
+	if err := r.store.MarkTTLWarned(ctx, vm.ID, now); err != nil {
+		slog.Error("Reaper failed to record TTL warning", "vm_id", vm.ID, "error", err)
+	}
+}
+
+func (r *Reaper) terminate(ctx context.Context, vm models.VMRecord) error {
+	provider := r.providers[vm.Provider]
+	if provider == nil {
+		return fmt.Errorf("unsupported provider: %s", vm.Provider)
+	}
+
+	ctx = logging.With(ctx, "vm_id", vm.ID)
+	logging.FromContext(ctx).Info("Auto-terminating VM",
+		"provider", vm.Provider, "region", vm.Region, "expires_at", vm.ExpiresAt.Format(time.RFC3339))
+
+	deleteCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	start := time.Now()
+	err := provider.DeleteVM(deleteCtx, vm.Region, vm.ID)
+	metrics.ObserveVMOperation("delete", vm.Provider, vm.Region, vm.InstanceType, start, err)
+	cancel()
+	if err != nil && !errors.Is(err, models.ErrVMNotFound) {
+		return err
+	}
+
+	if _, err := r.store.UpdateVMStatus(ctx, vm.ID, "terminated", vm.PublicIP, "auto-terminated after TTL"); err != nil {
+		return err
+	}
+
+	_, err = r.bus.Publish(ctx, models.VMEvent{
+		VMID:    vm.ID,
+		UserID:  vm.UserID,
+		Type:    models.EventTTLExpired,
+		Message: fmt.Sprintf("VM %s was terminated after its TTL expired", vm.Name),
+		Data:    map[string]any{"expiresAt": vm.ExpiresAt},
+	})
+	return err
+}
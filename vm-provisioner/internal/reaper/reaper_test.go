@@ -0,0 +1,128 @@
+package reaper
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/events"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/store"
+)
+
+// fakeProvider deletes VMs by returning err, recording every attempt. Other
+// methods are not implemented.
+type fakeProvider struct {
+	models.CloudProvider
+	err     error
+	deleted []string
+}
+
+func (p *fakeProvider) DeleteVM(ctx context.Context, region, id string) error {
+	p.deleted = append(p.deleted, id)
+	return p.err
+}
+
+func TestSweep(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresIn time.Duration // zero for a VM without a deadline
+		deleteErr error
+
+		wantEvents  []string // TTL events of the VM after two sweeps
+		wantDeletes int
+		wantStatus  string
+	}{
+		{
+			name:       "no deadline",
+			wantStatus: "running",
+		},
+		{
+			name:       "deadline beyond the warning lead",
+			expiresIn:  time.Hour,
+			wantStatus: "running",
+		},
+		{
+			name:       "deadline within the warning lead is warned of once",
+			expiresIn:  5 * time.Minute,
+			wantEvents: []string{models.EventTTLWarning},
+			wantStatus: "running",
+		},
+		{
+			name:        "expired VM is terminated once",
+			expiresIn:   -time.Minute,
+			wantEvents:  []string{models.EventTTLExpired},
+			wantDeletes: 1,
+			wantStatus:  "terminated",
+		},
+		{
+			name:        "expired VM already gone at the provider",
+			expiresIn:   -time.Minute,
+			deleteErr:   models.ErrVMNotFound,
+			wantEvents:  []string{models.EventTTLExpired},
+			wantDeletes: 1,
+			wantStatus:  "terminated",
+		},
+		{
+			name:        "failed termination is retried",
+			expiresIn:   -time.Minute,
+			deleteErr:   errors.New("throttled"),
+			wantDeletes: 2,
+			wantStatus:  "running",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			st, err := store.Open(ctx, config.StoreConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "test.db")})
+			if err != nil {
+				t.Fatalf("open store: %v", err)
+			}
+			defer st.Close()
+
+			vm := &models.VMRecord{ID: "vm-1", Provider: "fake", Region: "eu-1", UserID: "u1", Name: "vm", Status: "running"}
+			if tt.expiresIn != 0 {
+				expiresAt := time.Now().Add(tt.expiresIn)
+				vm.ExpiresAt = &expiresAt
+			}
+			if err := st.CreateVM(ctx, vm); err != nil {
+				t.Fatalf("create vm: %v", err)
+			}
+
+			provider := &fakeProvider{err: tt.deleteErr}
+			r := New(st, events.NewBus(st), map[string]models.CloudProvider{"fake": provider},
+				config.ReaperConfig{Interval: time.Minute, WarningLead: 10 * time.Minute}, time.Minute)
+			r.Sweep(ctx)
+			r.Sweep(ctx)
+
+			if len(provider.deleted) != tt.wantDeletes {
+				t.Errorf("deletes = %d, want %d", len(provider.deleted), tt.wantDeletes)
+			}
+			evs, err := st.ListEvents(ctx, "vm-1")
+			if err != nil {
+				t.Fatalf("list events: %v", err)
+			}
+			var types []string
+			for _, event := range evs {
+				if strings.HasPrefix(event.Type, "vm.ttl_") {
+					types = append(types, event.Type)
+				}
+			}
+			if !reflect.DeepEqual(types, tt.wantEvents) {
+				t.Errorf("events = %v, want %v", types, tt.wantEvents)
+			}
+			stored, err := st.GetVM(ctx, "vm-1")
+			if err != nil {
+				t.Fatalf("get vm: %v", err)
+			}
+			if stored.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", stored.Status, tt.wantStatus)
+			}
+		})
+	}
+}
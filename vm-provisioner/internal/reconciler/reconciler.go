@@ -0,0 +1,361 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/logging"
+	"vm-provisioner/internal/metrics"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/store"
+)
+
+// Drift kinds
+const (
+	DriftUnknown       = "unknown"        // tagged at the provider, not recorded in the store
+	DriftMissing       = "missing"        // recorded as live in the store, gone at the provider
+	DriftStateMismatch = "state_mismatch" // both sides know the VM but disagree on its status
+	DriftStillLive     = "still_live"     // recorded as terminated in the store, live at the provider
+)
+
+// Actions taken on a drift entry
+const (
+	ActionReported       = "reported"
+	ActionStoreUpdated   = "store_updated"
+	ActionWithinGrace    = "within_grace_period"
+	ActionTerminated     = "terminated"
+	ActionTerminateFail  = "terminate_failed"
+	ActionWouldTerminate = "would_terminate" // dry run of a pass that would terminate
+	ActionRestored       = "restored"        // managed again: listed, watched and reaped
+)
+
+// Drift is a single difference between the store and a provider
+type Drift struct {
+	Kind           string    `json:"kind"`
+	VMID           string    `json:"vmId"`
+	Provider       string    `json:"provider"`
+	Region         string    `json:"region,omitempty"`
+	UserID         string    `json:"userId,omitempty"`
+	StoreStatus    string    `json:"storeStatus,omitempty"`
+	ProviderStatus string    `json:"providerStatus,omitempty"`
+	CreatedAt      time.Time `json:"createdAt,omitempty"`
+	Action         string    `json:"action"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// Report is the outcome of one reconciliation pass
+type Report struct {
+	StartedAt  time.Time         `json:"startedAt"`
+	FinishedAt time.Time         `json:"finishedAt"`
+	DryRun     bool              `json:"dryRun"`
+	Scanned    map[string]int    `json:"scanned"`          // provider -> tagged VMs found
+	Errors     map[string]string `json:"errors,omitempty"` // provider -> listing error
+	Drift      []Drift           `json:"drift"`
+}
+
+// Reconciler periodically compares the VMs tagged at each provider with the
+// store, corrects the store, and optionally terminates orphans.
+type Reconciler struct {
+	store     *store.Store
+	providers map[string]models.CloudProvider
+	cfg       config.ReconcilerConfig
+	timeout   time.Duration
+
+	mu   sync.Mutex
+	last *Report
+}
+
+func New(st *store.Store, providers map[string]models.CloudProvider, cfg config.ReconcilerConfig, deleteTimeout time.Duration) *Reconciler {
+	return &Reconciler{
+		store:     st,
+		providers: providers,
+		cfg:       cfg,
+		timeout:   deleteTimeout,
+	}
+}
+
+// Run reconciles on every interval until ctx is canceled.
+func (r *Reconciler) Run(ctx context.Context) {
+	slog.Info("Reconciler started", "interval", r.cfg.Interval,
+		"terminate_orphans", r.cfg.TerminateOrphans, "orphan_grace_period", r.cfg.OrphanGracePeriod)
+
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report := r.Reconcile(ctx, false)
+			slog.Info("Reconciliation finished", "drift", len(report.Drift), "provider_errors", len(report.Errors))
+		}
+	}
+}
+
+// LastReport returns the report of the most recent periodic pass, or nil.
+func (r *Reconciler) LastReport() *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last
+}
+
+// Reconcile runs one pass. A dry run only reports: it neither corrects the
+// store nor terminates anything, and it does not replace LastReport.
+func (r *Reconciler) Reconcile(ctx context.Context, dryRun bool) *Report {
+	report := &Report{
+		StartedAt: time.Now(),
+		DryRun:    dryRun,
+		Scanned:   map[string]int{},
+		Errors:    map[string]string{},
+		Drift:     []Drift{},
+	}
+
+	known, err := r.store.ListActiveVMs(ctx)
+	if err != nil {
+		report.Errors["store"] = err.Error()
+		report.FinishedAt = time.Now()
+		return report
+	}
+
+	// Group known VMs by provider, and collect the regions worth scanning.
+	knownByProvider := map[string]map[string]models.VMRecord{}
+	regionsByProvider := map[string][]string{}
+	for _, vm := range known {
+		if knownByProvider[vm.Provider] == nil {
+			knownByProvider[vm.Provider] = map[string]models.VMRecord{}
+		}
+		knownByProvider[vm.Provider][vm.ID] = vm
+		regionsByProvider[vm.Provider] = append(regionsByProvider[vm.Provider], vm.Region)
+	}
+
+	for name, provider := range r.providers {
+		remote, err := provider.ListManagedVMs(ctx, regionsByProvider[name])
+		if err != nil {
+			// Without a complete listing every known VM would look missing.
+			report.Errors[name] = err.Error()
+			continue
+		}
+		report.Scanned[name] = len(remote)
+		r.diff(ctx, report, name, provider, knownByProvider[name], remote)
+	}
+
+	report.FinishedAt = time.Now()
+	if !dryRun {
+		r.mu.Lock()
+		r.last = report
+		r.mu.Unlock()
+		recordMetrics(report)
+	}
+	return report
+}
+
+// recordMetrics exports the drift of a periodic pass. Providers that could
+// not be listed keep the drift of their last successful pass.
+func recordMetrics(report *Report) {
+	for name := range report.Scanned {
+		for _, kind := range []string{DriftUnknown, DriftMissing, DriftStateMismatch, DriftStillLive} {
+			metrics.ReconcilerDrift.WithLabelValues(name, kind).Set(0)
+		}
+	}
+	for _, drift := range report.Drift {
+		metrics.ReconcilerDrift.WithLabelValues(drift.Provider, drift.Kind).Inc()
+		metrics.ReconcilerDriftActions.WithLabelValues(drift.Provider, drift.Kind, drift.Action).Inc()
+	}
+	metrics.ReconcilerLastRun.Set(float64(report.FinishedAt.Unix()))
+}
+
+func (r *Reconciler) diff(ctx context.Context, report *Report, name string, provider models.CloudProvider, known map[string]models.VMRecord, remote []models.ManagedVM) {
+	seen := map[string]bool{}
+
+	for _, vm := range remote {
+		seen[vm.ID] = true
+
+		record, ok := known[vm.ID]
+		if !ok {
+			// Not live in the store: either never recorded or believed terminated.
+			stored, err := r.store.GetVM(ctx, vm.ID)
+			if err == nil {
+				record, ok = *stored, true
+			} else if !errors.Is(err, store.ErrNotFound) {
+				report.Errors["store"] = err.Error()
+				continue
+			}
+		}
+
+		if !ok {
+			report.Drift = append(report.Drift, r.handleOrphan(ctx, report.DryRun, provider, vm))
+			continue
+		}
+		if record.DeletedAt != nil && vm.Status != "terminated" {
+			report.Drift = append(report.Drift, r.handleStillLive(ctx, report.DryRun, provider, record, vm))
+			continue
+		}
+
+		if record.Status != vm.Status {
+			drift := Drift{
+				Kind:           DriftStateMismatch,
+				VMID:           vm.ID,
+				Provider:       name,
+				Region:         vm.Region,
+				UserID:         record.UserID,
+				StoreStatus:    record.Status,
+				ProviderStatus: vm.Status,
+				CreatedAt:      record.CreatedAt,
+				Action:         ActionReported,
+			}
+			if !report.DryRun {
+				r.updateStore(ctx, &drift, vm.Status, vm.PublicIP, "reconciled with provider")
+			}
+			report.Drift = append(report.Drift, drift)
+		}
+	}
+
+	for id, record := range known {
+		if seen[id] {
+			continue
+		}
+		drift := Drift{
+			Kind:        DriftMissing,
+			VMID:        id,
+			Provider:    name,
+			Region:      record.Region,
+			UserID:      record.UserID,
+			StoreStatus: record.Status,
+			CreatedAt:   record.CreatedAt,
+			Action:      ActionReported,
+		}
+		// Listings are eventually consistent and may leave out a VM that was
+		// just launched; marking it terminated would get it killed as still live.
+		if r.withinGrace(record.CreatedAt) {
+			drift.Action = ActionWithinGrace
+		} else if !report.DryRun {
+			r.updateStore(ctx, &drift, "terminated", record.PublicIP, "missing at provider")
+		}
+		report.Drift = append(report.Drift, drift)
+	}
+}
+
+// handleOrphan reports a VM the store does not know and terminates it when
+// enabled and it is older than the grace period. The grace period also
+// covers the short window between RunInstances and the store insert.
+func (r *Reconciler) handleOrphan(ctx context.Context, dryRun bool, provider models.CloudProvider, vm models.ManagedVM) Drift {
+	drift := Drift{
+		Kind:           DriftUnknown,
+		VMID:           vm.ID,
+		Provider:       vm.Provider,
+		Region:         vm.Region,
+		UserID:         vm.UserID,
+		ProviderStatus: vm.Status,
+		CreatedAt:      vm.CreatedAt,
+		Action:         ActionReported,
+	}
+
+	if !r.cfg.TerminateOrphans {
+		return drift
+	}
+	if r.withinGrace(vm.CreatedAt) {
+		drift.Action = ActionWithinGrace
+		return drift
+	}
+	if dryRun {
+		drift.Action = ActionWouldTerminate
+		return drift
+	}
+
+	ctx = logging.With(ctx, "vm_id", vm.ID)
+	logging.FromContext(ctx).Warn("Terminating orphaned VM",
+		"provider", vm.Provider, "region", vm.Region, "created_at", vm.CreatedAt.Format(time.RFC3339))
+	r.terminate(ctx, &drift, provider, vm)
+	return drift
+}
+
+// handleStillLive handles a VM the store believes terminated but that is
+// still live at the provider, e.g. because its deletion never took effect.
+// Left alone it would run unmanaged, so it is terminated when orphans are,
+// and otherwise brought back under management.
+func (r *Reconciler) handleStillLive(ctx context.Context, dryRun bool, provider models.CloudProvider, record models.VMRecord, vm models.ManagedVM) Drift {
+	drift := Drift{
+		Kind:           DriftStillLive,
+		VMID:           vm.ID,
+		Provider:       vm.Provider,
+		Region:         vm.Region,
+		UserID:         record.UserID,
+		StoreStatus:    record.Status,
+		ProviderStatus: vm.Status,
+		CreatedAt:      record.CreatedAt,
+		Action:         ActionReported,
+	}
+
+	// A VM launched or deleted moments ago may still be settling at the
+	// provider: left out of a listing, or shutting down.
+	changedAt := record.CreatedAt
+	if record.DeletedAt != nil && record.DeletedAt.After(changedAt) {
+		changedAt = *record.DeletedAt
+	}
+	if r.withinGrace(changedAt) {
+		drift.Action = ActionWithinGrace
+		return drift
+	}
+
+	ctx = logging.With(ctx, "vm_id", vm.ID)
+	if r.cfg.TerminateOrphans {
+		if dryRun {
+			drift.Action = ActionWouldTerminate
+			return drift
+		}
+		logging.FromContext(ctx).Warn("Terminating VM that outlived its termination",
+			"provider", vm.Provider, "region", vm.Region, "status", vm.Status)
+		r.terminate(ctx, &drift, provider, vm)
+		return drift
+	}
+	if dryRun {
+		return drift
+	}
+
+	logging.FromContext(ctx).Warn("Restoring VM that outlived its termination",
+		"provider", vm.Provider, "region", vm.Region, "status", vm.Status)
+	if err := r.store.RestoreVM(ctx, vm.ID); err != nil {
+		drift.Error = fmt.Sprintf("failed to restore vm: %v", err)
+		return drift
+	}
+	r.updateStore(ctx, &drift, vm.Status, vm.PublicIP, "still live at provider")
+	if drift.Error == "" {
+		drift.Action = ActionRestored
+	}
+	return drift
+}
+
+// withinGrace reports whether t is too recent to act on drift, given
+// that provider listings lag behind launches and deletions.
+func (r *Reconciler) withinGrace(t time.Time) bool {
+	return time.Since(t) < r.cfg.OrphanGracePeriod
+}
+
+// terminate deletes vm at the provider and records the outcome on drift.
+func (r *Reconciler) terminate(ctx context.Context, drift *Drift, provider models.CloudProvider, vm models.ManagedVM) {
+	deleteCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	start := time.Now()
+	err := provider.DeleteVM(deleteCtx, vm.Region, vm.ID)
+	metrics.ObserveVMOperation("delete", vm.Provider, vm.Region, vm.InstanceType, start, err)
+	if err != nil {
+		drift.Action = ActionTerminateFail
+		drift.Error = err.Error()
+		return
+	}
+	drift.Action = ActionTerminated
+}
+
+func (r *Reconciler) updateStore(ctx context.Context, drift *Drift, status, publicIP, reason string) {
+	if _, err := r.store.UpdateVMStatus(ctx, drift.VMID, status, publicIP, reason); err != nil {
+		drift.Error = fmt.Sprintf("failed to update store: %v", err)
+		return
+	}
+	drift.Action = ActionStoreUpdated
+}
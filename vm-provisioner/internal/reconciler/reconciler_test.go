@@ -0,0 +1,250 @@
+package reconciler
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/store"
+)
+
+// fakeProvider lists a fixed set of VMs and records deletions. Other
+// methods are not implemented.
+type fakeProvider struct {
+	models.CloudProvider
+	vms     []models.ManagedVM
+	deleted []string
+}
+
+func (p *fakeProvider) ListManagedVMs(ctx context.Context, regions []string) ([]models.ManagedVM, error) {
+	return p.vms, nil
+}
+
+func (p *fakeProvider) DeleteVM(ctx context.Context, region, id string) error {
+	p.deleted = append(p.deleted, id)
+	return nil
+}
+
+func newTestStore(t *testing.T) *store.Store {
+	t.Helper()
+	st, err := store.Open(context.Background(), config.StoreConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+func TestReconcile(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+	young := now.Add(-time.Minute)
+
+	tests := []struct {
+		name      string
+		record    *models.VMRecord // stored VM, if any
+		deleted   bool             // record marked terminated before the pass
+		remote    *models.ManagedVM
+		terminate bool
+		grace     time.Duration
+		dryRun    bool
+
+		wantKind    string // empty when no drift is expected
+		wantAction  string
+		wantDeleted bool
+		wantStatus  string // stored status after the pass
+		wantLive    bool   // stored VM not marked deleted after the pass
+	}{
+		{
+			name:     "in sync",
+			record:   &models.VMRecord{Status: "running", CreatedAt: old},
+			remote:   &models.ManagedVM{Status: "running", CreatedAt: old},
+			grace:    time.Hour,
+			wantKind: "", wantStatus: "running", wantLive: true,
+		},
+		{
+			name:      "old orphan is terminated",
+			remote:    &models.ManagedVM{Status: "running", CreatedAt: old},
+			terminate: true, grace: time.Hour,
+			wantKind: DriftUnknown, wantAction: ActionTerminated, wantDeleted: true,
+		},
+		{
+			name:      "young orphan is within grace",
+			remote:    &models.ManagedVM{Status: "running", CreatedAt: young},
+			terminate: true, grace: time.Hour,
+			wantKind: DriftUnknown, wantAction: ActionWithinGrace,
+		},
+		{
+			name:     "orphan is only reported without terminate",
+			remote:   &models.ManagedVM{Status: "running", CreatedAt: old},
+			grace:    time.Hour,
+			wantKind: DriftUnknown, wantAction: ActionReported,
+		},
+		{
+			name:      "dry run reports the orphan it would terminate",
+			remote:    &models.ManagedVM{Status: "running", CreatedAt: old},
+			terminate: true, grace: time.Hour, dryRun: true,
+			wantKind: DriftUnknown, wantAction: ActionWouldTerminate,
+		},
+		{
+			name:     "old missing VM is marked terminated",
+			record:   &models.VMRecord{Status: "running", CreatedAt: old},
+			grace:    time.Hour,
+			wantKind: DriftMissing, wantAction: ActionStoreUpdated, wantStatus: "terminated",
+		},
+		{
+			name:     "young VM left out of a listing is within grace",
+			record:   &models.VMRecord{Status: "pending", CreatedAt: young},
+			grace:    time.Hour,
+			wantKind: DriftMissing, wantAction: ActionWithinGrace, wantStatus: "pending", wantLive: true,
+		},
+		{
+			name:   "dry run leaves a missing VM alone",
+			record: &models.VMRecord{Status: "running", CreatedAt: old},
+			grace:  time.Hour, dryRun: true,
+			wantKind: DriftMissing, wantAction: ActionReported, wantStatus: "running", wantLive: true,
+		},
+		{
+			name:     "state mismatch corrects the store",
+			record:   &models.VMRecord{Status: "pending", CreatedAt: old},
+			remote:   &models.ManagedVM{Status: "running", CreatedAt: old},
+			grace:    time.Hour,
+			wantKind: DriftStateMismatch, wantAction: ActionStoreUpdated, wantStatus: "running", wantLive: true,
+		},
+		{
+			name:    "still live VM is terminated after the grace period",
+			record:  &models.VMRecord{Status: "running", CreatedAt: old},
+			deleted: true,
+			remote:  &models.ManagedVM{Status: "running", CreatedAt: old},
+			// The deletion was just recorded, so only a tiny grace period has passed
+			terminate: true, grace: time.Nanosecond,
+			wantKind: DriftStillLive, wantAction: ActionTerminated, wantDeleted: true, wantStatus: "terminated",
+		},
+		{
+			name:      "just launched VM marked terminated is within grace",
+			record:    &models.VMRecord{Status: "running", CreatedAt: young},
+			deleted:   true,
+			remote:    &models.ManagedVM{Status: "running", CreatedAt: young},
+			terminate: true, grace: time.Hour,
+			wantKind: DriftStillLive, wantAction: ActionWithinGrace, wantStatus: "terminated",
+		},
+		{
+			name:      "just deleted VM still shutting down is within grace",
+			record:    &models.VMRecord{Status: "running", CreatedAt: old},
+			deleted:   true,
+			remote:    &models.ManagedVM{Status: "stopping", CreatedAt: old},
+			terminate: true, grace: time.Hour,
+			wantKind: DriftStillLive, wantAction: ActionWithinGrace, wantStatus: "terminated",
+		},
+		{
+			name:     "still live VM is restored without terminate",
+			record:   &models.VMRecord{Status: "running", CreatedAt: old},
+			deleted:  true,
+			remote:   &models.ManagedVM{Status: "running", CreatedAt: old},
+			grace:    time.Nanosecond,
+			wantKind: DriftStillLive, wantAction: ActionRestored, wantStatus: "running", wantLive: true,
+		},
+		{
+			name:      "dry run reports the still live VM it would terminate",
+			record:    &models.VMRecord{Status: "running", CreatedAt: old},
+			deleted:   true,
+			remote:    &models.ManagedVM{Status: "running", CreatedAt: old},
+			terminate: true, grace: time.Nanosecond, dryRun: true,
+			wantKind: DriftStillLive, wantAction: ActionWouldTerminate, wantStatus: "terminated",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			st := newTestStore(t)
+			provider := &fakeProvider{}
+
+			if tt.record != nil {
+				record := *tt.record
+				record.ID, record.Provider, record.Region, record.UserID, record.Name = "vm-1", "fake", "eu-1", "u1", "vm"
+				if err := st.CreateVM(ctx, &record); err != nil {
+					t.Fatalf("create vm: %v", err)
+				}
+				if tt.deleted {
+					if _, err := st.UpdateVMStatus(ctx, record.ID, "terminated", "", "deleted"); err != nil {
+						t.Fatalf("mark vm terminated: %v", err)
+					}
+				}
+			}
+			if tt.remote != nil {
+				remote := *tt.remote
+				remote.ID, remote.Provider, remote.Region = "vm-1", "fake", "eu-1"
+				provider.vms = []models.ManagedVM{remote}
+			}
+
+			r := New(st, map[string]models.CloudProvider{"fake": provider},
+				config.ReconcilerConfig{TerminateOrphans: tt.terminate, OrphanGracePeriod: tt.grace}, time.Minute)
+			report := r.Reconcile(ctx, tt.dryRun)
+
+			if len(report.Errors) > 0 {
+				t.Fatalf("errors = %v", report.Errors)
+			}
+			switch {
+			case tt.wantKind == "" && len(report.Drift) > 0:
+				t.Fatalf("drift = %+v, want none", report.Drift)
+			case tt.wantKind != "" && len(report.Drift) != 1:
+				t.Fatalf("drift = %+v, want one %s entry", report.Drift, tt.wantKind)
+			case tt.wantKind != "":
+				drift := report.Drift[0]
+				if drift.Kind != tt.wantKind || drift.Action != tt.wantAction || drift.Error != "" {
+					t.Errorf("drift = %s/%s (%s), want %s/%s", drift.Kind, drift.Action, drift.Error, tt.wantKind, tt.wantAction)
+				}
+			}
+			if deleted := len(provider.deleted) > 0; deleted != tt.wantDeleted {
+				t.Errorf("deleted at provider = %v, want %v", deleted, tt.wantDeleted)
+			}
+
+			if tt.record == nil {
+				return
+			}
+			vm, err := st.GetVM(ctx, "vm-1")
+			if err != nil {
+				t.Fatalf("get vm: %v", err)
+			}
+			if vm.Status != tt.wantStatus || (vm.DeletedAt == nil) != tt.wantLive {
+				t.Errorf("stored vm = %s (deleted at %v), want %s (live %v)", vm.Status, vm.DeletedAt, tt.wantStatus, tt.wantLive)
+			}
+		})
+	}
+}
+
+// A VM that a listing left out right after its launch must survive the next
+// pass that does list it, even with orphan termination on.
+func TestReconcileLaggingListing(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStore(t)
+	record := &models.VMRecord{ID: "vm-1", Provider: "fake", Region: "eu-1", UserID: "u1", Name: "vm", Status: "pending"}
+	if err := st.CreateVM(ctx, record); err != nil {
+		t.Fatalf("create vm: %v", err)
+	}
+
+	provider := &fakeProvider{}
+	r := New(st, map[string]models.CloudProvider{"fake": provider},
+		config.ReconcilerConfig{TerminateOrphans: true, OrphanGracePeriod: time.Hour}, time.Minute)
+
+	r.Reconcile(ctx, false)
+	provider.vms = []models.ManagedVM{{ID: "vm-1", Provider: "fake", Region: "eu-1", Status: "running", CreatedAt: record.CreatedAt}}
+	report := r.Reconcile(ctx, false)
+
+	if len(provider.deleted) > 0 {
+		t.Fatalf("terminated %v", provider.deleted)
+	}
+	if len(report.Drift) != 1 || report.Drift[0].Kind != DriftStateMismatch {
+		t.Errorf("second pass drift = %+v, want the status catching up", report.Drift)
+	}
+	vm, err := st.GetVM(ctx, "vm-1")
+	if err != nil {
+		t.Fatalf("get vm: %v", err)
+	}
+	if vm.Status != "running" || vm.DeletedAt != nil {
+		t.Errorf("stored vm = %s (deleted at %v), want running", vm.Status, vm.DeletedAt)
+	}
+}
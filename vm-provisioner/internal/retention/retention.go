@@ -0,0 +1,125 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/store"
+)
+
+// Collector deletes snapshots that fall outside their owner's retention
+// policy. Users without a policy of their own get the configured default.
+type Collector struct {
+	store     *store.Store
+	providers map[string]models.CloudProvider
+	cfg       config.SnapshotConfig
+	timeout   time.Duration
+}
+
+func New(st *store.Store, providers map[string]models.CloudProvider, cfg config.SnapshotConfig, deleteTimeout time.Duration) *Collector {
+	return &Collector{
+		store:     st,
+		providers: providers,
+		cfg:       cfg,
+		timeout:   deleteTimeout,
+	}
+}
+
+// PolicyFor returns the retention policy that applies to a user.
+func PolicyFor(ctx context.Context, st *store.Store, cfg config.SnapshotConfig, userID string) (*models.SnapshotPolicy, error) {
+	policy, err := st.GetSnapshotPolicy(ctx, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		return &models.SnapshotPolicy{UserID: userID, KeepLast: cfg.KeepLast, MaxAgeDays: cfg.MaxAgeDays}, nil
+	}
+	return policy, err
+}
+
+// Expired returns the snapshots a policy no longer keeps, given a user's
+// snapshots newest first. Only available snapshots count: pending ones are
+// still being captured and failed ones are left for the user to delete.
+func Expired(policy *models.SnapshotPolicy, snapshots []models.Snapshot, now time.Time) []models.Snapshot {
+	var expired []models.Snapshot
+	kept := 0
+	for _, snap := range snapshots {
+		if snap.Status != models.SnapshotAvailable {
+			continue
+		}
+		tooMany := policy.KeepLast > 0 && kept >= policy.KeepLast
+		tooOld := policy.MaxAgeDays > 0 && now.Sub(snap.CreatedAt) > time.Duration(policy.MaxAgeDays)*24*time.Hour
+		if tooMany || tooOld {
+			expired = append(expired, snap)
+			continue
+		}
+		kept++
+	}
+	return expired
+}
+
+// Run collects immediately and then on every interval until ctx is canceled.
+func (c *Collector) Run(ctx context.Context) {
+	slog.Info("Snapshot collector started",
+		"interval", c.cfg.GCInterval, "keep_last", c.cfg.KeepLast, "max_age_days", c.cfg.MaxAgeDays)
+
+	ticker := time.NewTicker(c.cfg.GCInterval)
+	defer ticker.Stop()
+
+	for {
+		c.Sweep(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep applies every user's retention policy once.
+func (c *Collector) Sweep(ctx context.Context) {
+	snapshots, err := c.store.ListSnapshots(ctx, "")
+	if err != nil {
+		slog.Error("Snapshot collector failed to list snapshots", "error", err)
+		return
+	}
+
+	byUser := map[string][]models.Snapshot{}
+	for _, snap := range snapshots {
+		byUser[snap.UserID] = append(byUser[snap.UserID], snap)
+	}
+
+	now := time.Now()
+	for userID, snapshots := range byUser {
+		policy, err := PolicyFor(ctx, c.store, c.cfg, userID)
+		if err != nil {
+			slog.Error("Snapshot collector failed to load retention policy", "user_id", userID, "error", err)
+			continue
+		}
+		for _, snap := range Expired(policy, snapshots, now) {
+			if err := c.delete(ctx, snap); err != nil {
+				// Left in place, the next sweep retries.
+				slog.Error("Snapshot collector failed to delete snapshot", "snapshot_id", snap.ID, "error", err)
+			}
+		}
+	}
+}
+
+func (c *Collector) delete(ctx context.Context, snap models.Snapshot) error {
+	provider := c.providers[snap.Provider]
+	if provider == nil {
+		return fmt.Errorf("unsupported provider: %s", snap.Provider)
+	}
+
+	slog.Info("Deleting snapshot outside retention policy", "snapshot_id", snap.ID, "name", snap.Name, "user_id", snap.UserID)
+
+	deleteCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	err := provider.DeleteSnapshot(deleteCtx, snap.Region, snap.ID)
+	cancel()
+	if err != nil && !errors.Is(err, models.ErrSnapshotNotFound) {
+		return err
+	}
+	return c.store.MarkSnapshotDeleted(ctx, snap.ID)
+}
@@ -0,0 +1,52 @@
+package retention
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"vm-provisioner/internal/models"
+)
+
+func TestExpired(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	snapshot := func(id, status string, age time.Duration) models.Snapshot {
+		return models.Snapshot{ID: id, Status: status, CreatedAt: now.Add(-age)}
+	}
+
+	// Newest first, as the store lists them
+	snapshots := []models.Snapshot{
+		snapshot("s1", models.SnapshotPending, time.Hour),
+		snapshot("s2", models.SnapshotAvailable, day),
+		snapshot("s3", models.SnapshotFailed, 2*day),
+		snapshot("s4", models.SnapshotAvailable, 3*day),
+		snapshot("s5", models.SnapshotAvailable, 10*day),
+		snapshot("s6", models.SnapshotAvailable, 40*day),
+	}
+
+	tests := []struct {
+		name   string
+		policy models.SnapshotPolicy
+		want   []string
+	}{
+		{"no limits", models.SnapshotPolicy{}, nil},
+		{"keep last", models.SnapshotPolicy{KeepLast: 2}, []string{"s5", "s6"}},
+		{"keep more than there are", models.SnapshotPolicy{KeepLast: 10}, nil},
+		{"max age", models.SnapshotPolicy{MaxAgeDays: 7}, []string{"s5", "s6"}},
+		{"max age boundary is inclusive", models.SnapshotPolicy{MaxAgeDays: 10}, []string{"s6"}},
+		{"both, keep last stricter", models.SnapshotPolicy{KeepLast: 1, MaxAgeDays: 30}, []string{"s4", "s5", "s6"}},
+		{"both, max age stricter", models.SnapshotPolicy{KeepLast: 3, MaxAgeDays: 5}, []string{"s5", "s6"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, snap := range Expired(&tt.policy, snapshots, now) {
+				got = append(got, snap.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expired = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package spot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/events"
+	"vm-provisioner/internal/logging"
+	"vm-provisioner/internal/metrics"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/operations"
+	"vm-provisioner/internal/store"
+)
+
+// terminatedLookback is how long after termination a spot VM is still
+// checked for an interruption. EC2 describes terminated instances for
+// about an hour.
+const terminatedLookback = time.Hour
+
+// volumeReleaseWait bounds waiting for the volumes of a reclaimed VM to be
+// released before its replacement is launched.
+const volumeReleaseWait = 5 * time.Minute
+
+// Monitor polls providers for spot interruption notices and reclaims,
+// records them, publishes events and relaunches VMs that asked for it.
+type Monitor struct {
+	store     *store.Store
+	bus       *events.Bus
+	ops       *operations.Manager
+	providers map[string]models.CloudProvider
+	cfg       config.SpotConfig
+	timeouts  config.TimeoutConfig
+}
+
+func New(st *store.Store, bus *events.Bus, ops *operations.Manager, providers map[string]models.CloudProvider, cfg config.SpotConfig, timeouts config.TimeoutConfig) *Monitor {
+	return &Monitor{
+		store:     st,
+		bus:       bus,
+		ops:       ops,
+		providers: providers,
+		cfg:       cfg,
+		timeouts:  timeouts,
+	}
+}
+
+// Run checks immediately and then on every interval until ctx is canceled.
+func (m *Monitor) Run(ctx context.Context) {
+	slog.Info("Spot monitor started", "interval", m.cfg.Interval)
+
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		m.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check asks each provider about its spot VMs once.
+func (m *Monitor) Check(ctx context.Context) {
+	vms, err := m.store.ListSpotVMsToCheck(ctx, time.Now().Add(-terminatedLookback))
+	if err != nil {
+		slog.Error("Spot monitor failed to list spot VMs", "error", err)
+		return
+	}
+
+	type location struct{ provider, region string }
+	byLocation := map[location][]models.VMRecord{}
+	for _, vm := range vms {
+		loc := location{vm.Provider, vm.Region}
+		byLocation[loc] = append(byLocation[loc], vm)
+	}
+
+	for loc, vms := range byLocation {
+		provider := m.providers[loc.provider]
+		if provider == nil {
+			continue
+		}
+
+		ids := make([]string, len(vms))
+		for i, vm := range vms {
+			ids[i] = vm.ID
+		}
+		checkCtx, cancel := context.WithTimeout(ctx, m.timeouts.Status)
+		statuses, err := provider.CheckSpotInstances(checkCtx, loc.region, ids)
+		cancel()
+		if err != nil {
+			slog.Error("Spot monitor failed to check spot VMs", "provider", loc.provider, "region", loc.region, "error", err)
+			continue
+		}
+
+		byID := make(map[string]models.SpotStatus, len(statuses))
+		for _, status := range statuses {
+			byID[status.ID] = status
+		}
+		for _, vm := range vms {
+			status, ok := byID[vm.ID]
+			switch {
+			case !ok:
+				// Gone at the provider; the reconciler reports it as missing
+			case status.Interrupted:
+				m.interrupted(ctx, vm, status)
+			case status.MarkedForTermination && vm.DeletedAt == nil:
+				m.warn(ctx, vm, status)
+			}
+		}
+	}
+}
+
+func (m *Monitor) warn(ctx context.Context, vm models.VMRecord, status models.SpotStatus) {
+	ctx = logging.With(ctx, "vm_id", vm.ID)
+	logger := logging.FromContext(ctx)
+
+	first, err := m.store.MarkInterruptionWarned(ctx, vm.ID, time.Now())
+	if err != nil {
+		logger.Error("Spot monitor failed to record interruption notice", "error", err)
+		return
+	}
+	if !first {
+		return
+	}
+
+	logger.Warn("Spot VM received an interruption notice", "provider", vm.Provider, "region", vm.Region)
+	data := map[string]any{"reason": status.Reason}
+	message := fmt.Sprintf("Spot VM %s is about to be reclaimed by %s", vm.Name, vm.Provider)
+	if status.TerminationTime != nil {
+		data["terminationTime"] = status.TerminationTime
+		message = fmt.Sprintf("Spot VM %s will be reclaimed by %s at %s", vm.Name, vm.Provider, status.TerminationTime.Format(time.RFC3339))
+	}
+	if _, err := m.bus.Publish(ctx, models.VMEvent{
+		VMID:    vm.ID,
+		UserID:  vm.UserID,
+		Type:    models.EventSpotInterruptionWarning,
+		Message: message,
+		Data:    data,
+	}); err != nil {
+		logger.Error("Spot monitor failed to publish interruption warning", "error", err)
+	}
+}
+
+func (m *Monitor) interrupted(ctx context.Context, vm models.VMRecord, status models.SpotStatus) {
+	ctx = logging.With(ctx, "vm_id", vm.ID)
+	logger := logging.FromContext(ctx)
+
+	first, err := m.store.RecordInterruption(ctx, vm.ID, status.Reason, vm.PublicIP)
+	if err != nil {
+		logger.Error("Spot monitor failed to record interruption", "error", err)
+		return
+	}
+	if !first {
+		return
+	}
+
+	logger.Warn("Spot VM was interrupted", "provider", vm.Provider, "region", vm.Region, "reason", status.Reason)
+	m.release(ctx, vm)
+
+	data := map[string]any{
+		"reason":                status.Reason,
+		"replaceOnInterruption": vm.ReplaceOnInterruption,
+	}
+	if vm.ReplaceOnInterruption {
+		op, err := m.replace(ctx, vm)
+		if err != nil {
+			logger.Error("Spot monitor failed to queue replacement", "error", err)
+		} else {
+			data["operationId"] = op.ID
+		}
+	}
+
+	if _, err := m.bus.Publish(ctx, models.VMEvent{
+		VMID:    vm.ID,
+		UserID:  vm.UserID,
+		Type:    models.EventSpotInterrupted,
+		Message: fmt.Sprintf("Spot VM %s was reclaimed by %s: %s", vm.Name, vm.Provider, status.Reason),
+		Data:    data,
+	}); err != nil {
+		logger.Error("Spot monitor failed to publish interruption", "error", err)
+	}
+}
+
+// release frees what a reclaimed VM still holds at the provider, such as
+// its firewall. Deleting an already terminated VM only does the cleanup.
+func (m *Monitor) release(ctx context.Context, vm models.VMRecord) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeouts.Delete)
+	defer cancel()
+
+	if err := m.providers[vm.Provider].DeleteVM(ctx, vm.Region, vm.ID); err != nil {
+		logging.FromContext(ctx).Error("Spot monitor failed to release interrupted VM", "error", err)
+	}
+}
+
+// replace queues the launch of a VM from the request the interrupted one was
+// created from, in the same provider and region, with its volumes
+// reattached. The replacement keeps the auto-termination deadline of the
+// interrupted VM, including extensions and cancellations.
+func (m *Monitor) replace(ctx context.Context, vm models.VMRecord) (*models.Operation, error) {
+	req, err := m.store.GetLaunchRequest(ctx, vm.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The firewall may have been changed since the launch
+	if vm.Firewall != nil {
+		req.Firewall = vm.Firewall
+	}
+
+	// Waiting for the volumes does not count against the create deadline
+	timeout := m.timeouts.Create
+	if len(req.Volumes) > 0 {
+		timeout += volumeReleaseWait
+	}
+
+	op := models.Operation{Type: "vm.replace", VMID: vm.ID, UserID: vm.UserID}
+	return m.ops.Submit(ctx, op, timeout, func(ctx context.Context) (any, error) {
+		provider := m.providers[vm.Provider]
+		logger := logging.FromContext(ctx)
+		if err := m.waitForVolumes(ctx, provider, req); err != nil {
+			return nil, err
+		}
+
+		operations.ReportProgress(ctx, fmt.Sprintf("launching replacement for %s", vm.ID))
+		createCtx, cancel := context.WithTimeout(ctx, m.timeouts.Create)
+		defer cancel()
+		start := time.Now()
+		response, err := provider.CreateVM(createCtx, req)
+		metrics.ObserveVMOperation("create", req.Provider, req.Region, req.InstanceType, start, err)
+		if err != nil {
+			return nil, err
+		}
+
+		record := models.NewVMRecord(req, response)
+		record.ExpiresAt, record.TTLWarnedAt = vm.ExpiresAt, vm.TTLWarnedAt
+
+		// Record the replacement even if the operation has run out of time
+		storeCtx := context.WithoutCancel(ctx)
+		if err := m.store.CreateVM(storeCtx, record); err != nil {
+			logger.Error("Failed to record replacement VM in store", "replacement_id", response.ID, "error", err)
+		}
+		if err := m.store.AttachVolumes(storeCtx, response.ID, req.Volumes); err != nil {
+			logger.Error("Failed to record volume attachments", "replacement_id", response.ID, "error", err)
+		}
+		if err := m.store.SaveLaunchRequest(storeCtx, response.ID, req); err != nil {
+			logger.Error("Failed to save launch request", "replacement_id", response.ID, "error", err)
+		}
+		if err := m.store.SetReplacedBy(storeCtx, vm.ID, response.ID); err != nil {
+			logger.Error("Failed to link replacement VM", "replacement_id", response.ID, "error", err)
+		}
+		if _, err := m.bus.Publish(storeCtx, models.VMEvent{
+			VMID:    vm.ID,
+			UserID:  vm.UserID,
+			Type:    models.EventSpotReplaced,
+			Message: fmt.Sprintf("Spot VM %s was replaced by %s", vm.Name, response.ID),
+			Data:    map[string]any{"replacementId": response.ID},
+		}); err != nil {
+			logger.Error("Spot monitor failed to publish replacement", "error", err)
+		}
+
+		logger.Info("Spot VM replaced", "replacement_id", response.ID)
+		return response, nil
+	})
+}
+
+// waitForVolumes waits until the provider released the volumes of the
+// reclaimed VM, so the replacement can attach them.
+func (m *Monitor) waitForVolumes(ctx context.Context, provider models.CloudProvider, req *models.VMRequest) error {
+	if len(req.Volumes) == 0 {
+		return nil
+	}
+	operations.ReportProgress(ctx, "waiting for volumes to be released")
+	ctx, cancel := context.WithTimeout(ctx, volumeReleaseWait)
+	defer cancel()
+
+	for _, mount := range req.Volumes {
+		if err := provider.WaitForVolume(ctx, req.Region, mount.VolumeID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
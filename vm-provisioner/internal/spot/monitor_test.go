@@ -0,0 +1,217 @@
+package spot
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/events"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/operations"
+	"vm-provisioner/internal/store"
+)
+
+// fakeProvider reports fixed spot statuses, records deletions and launches
+// every VM as "vm-2". Other methods are not implemented.
+type fakeProvider struct {
+	models.CloudProvider
+	statuses []models.SpotStatus
+
+	mu       sync.Mutex
+	deleted  []string
+	launched []models.VMRequest
+}
+
+func (p *fakeProvider) CheckSpotInstances(ctx context.Context, region string, ids []string) ([]models.SpotStatus, error) {
+	return p.statuses, nil
+}
+
+func (p *fakeProvider) DeleteVM(ctx context.Context, region, id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.deleted = append(p.deleted, id)
+	return nil
+}
+
+func (p *fakeProvider) CreateVM(ctx context.Context, req *models.VMRequest) (*models.VMResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.launched = append(p.launched, *req)
+	return &models.VMResponse{ID: "vm-2", Provider: req.Provider, Region: req.Region, Name: req.Name,
+		InstanceType: req.InstanceType, Status: "pending", CreatedAt: time.Now()}, nil
+}
+
+func newTestMonitor(t *testing.T, provider models.CloudProvider) (*Monitor, *store.Store) {
+	t.Helper()
+	st, err := store.Open(context.Background(), config.StoreConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+
+	ops := operations.NewManager(st, config.OperationsConfig{Workers: 1, QueueSize: 10})
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := ops.Start(ctx); err != nil {
+		t.Fatalf("start operations: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		ops.Wait()
+	})
+
+	timeouts := config.TimeoutConfig{Create: time.Minute, Delete: time.Minute, Status: time.Minute}
+	m := New(st, events.NewBus(st), ops, map[string]models.CloudProvider{"fake": provider}, config.SpotConfig{Interval: time.Minute}, timeouts)
+	return m, st
+}
+
+func TestCheck(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	tests := []struct {
+		name    string
+		replace bool
+		status  *models.SpotStatus // reported for vm-1, if any
+
+		wantEvents   []string // spot events published for vm-1
+		wantReason   string   // stored interruption reason
+		wantReleased bool
+		wantReplaced bool
+	}{
+		{
+			name:   "running spot VM",
+			status: &models.SpotStatus{ID: "vm-1", Status: "running"},
+		},
+		{
+			name:       "interruption notice is published once",
+			status:     &models.SpotStatus{ID: "vm-1", Status: "running", MarkedForTermination: true, Reason: "capacity"},
+			wantEvents: []string{models.EventSpotInterruptionWarning},
+		},
+		{
+			name:         "reclaimed VM is released",
+			status:       &models.SpotStatus{ID: "vm-1", Status: "terminated", Interrupted: true, Reason: "no-capacity"},
+			wantEvents:   []string{models.EventSpotInterrupted},
+			wantReason:   "no-capacity",
+			wantReleased: true,
+		},
+		{
+			name:         "reclaimed VM is replaced once",
+			replace:      true,
+			status:       &models.SpotStatus{ID: "vm-1", Status: "terminated", Interrupted: true, Reason: "no-capacity"},
+			wantEvents:   []string{models.EventSpotInterrupted, models.EventSpotReplaced},
+			wantReason:   "no-capacity",
+			wantReleased: true,
+			wantReplaced: true,
+		},
+		{
+			name: "VM unknown to the provider is left to the reconciler",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			provider := &fakeProvider{}
+			if tt.status != nil {
+				provider.statuses = []models.SpotStatus{*tt.status}
+			}
+			m, st := newTestMonitor(t, provider)
+
+			req := &models.VMRequest{Provider: "fake", Region: "eu-1", UserID: "u1", Name: "vm", InstanceType: "small",
+				UseSpotInstance: true, ReplaceOnInterruption: tt.replace}
+			record := models.NewVMRecord(req, &models.VMResponse{ID: "vm-1", Provider: "fake", Region: "eu-1", Name: "vm",
+				InstanceType: "small", Status: "running", CreatedAt: time.Now()})
+			record.ExpiresAt = &expiresAt
+			if err := st.CreateVM(ctx, record); err != nil {
+				t.Fatalf("create vm: %v", err)
+			}
+			if err := st.SaveLaunchRequest(ctx, "vm-1", req); err != nil {
+				t.Fatalf("save launch request: %v", err)
+			}
+
+			// Later passes must not repeat what the first one did
+			m.Check(ctx)
+			m.Check(ctx)
+			waitReplacement(t, st, "vm-1")
+
+			var gotEvents []string
+			evs, err := st.ListEvents(ctx, "vm-1")
+			if err != nil {
+				t.Fatalf("list events: %v", err)
+			}
+			for _, event := range evs {
+				if strings.HasPrefix(event.Type, "vm.spot_") {
+					gotEvents = append(gotEvents, event.Type)
+				}
+			}
+			if !reflect.DeepEqual(gotEvents, tt.wantEvents) {
+				t.Errorf("events = %v, want %v", gotEvents, tt.wantEvents)
+			}
+			if released := len(provider.deleted) > 0; released != tt.wantReleased || len(provider.deleted) > 1 {
+				t.Errorf("deleted = %v, want released %v once", provider.deleted, tt.wantReleased)
+			}
+
+			vm, err := st.GetVM(ctx, "vm-1")
+			if err != nil {
+				t.Fatalf("get vm: %v", err)
+			}
+			if vm.InterruptionReason != tt.wantReason {
+				t.Errorf("interruption reason = %q, want %q", vm.InterruptionReason, tt.wantReason)
+			}
+			if !tt.wantReplaced {
+				if len(provider.launched) > 0 || vm.ReplacedBy != "" {
+					t.Errorf("launched %v (replaced by %q), want no replacement", provider.launched, vm.ReplacedBy)
+				}
+				return
+			}
+
+			if len(provider.launched) != 1 || provider.launched[0].Region != "eu-1" || provider.launched[0].InstanceType != "small" {
+				t.Fatalf("launched = %+v, want one replacement from the launch request", provider.launched)
+			}
+			if vm.ReplacedBy != "vm-2" {
+				t.Errorf("replaced by = %q, want vm-2", vm.ReplacedBy)
+			}
+			replacement, err := st.GetVM(ctx, "vm-2")
+			if err != nil {
+				t.Fatalf("get replacement: %v", err)
+			}
+			if replacement.ExpiresAt == nil || !replacement.ExpiresAt.Equal(expiresAt) {
+				t.Errorf("replacement expires at %v, want the deadline of the interrupted VM %v", replacement.ExpiresAt, expiresAt)
+			}
+			if !replacement.ReplaceOnInterruption {
+				t.Error("replacement is not relaunched on interruption")
+			}
+		})
+	}
+}
+
+// waitReplacement waits for the replacement operation queued for vmID, if
+// its interruption event names one.
+func waitReplacement(t *testing.T, st *store.Store, vmID string) {
+	t.Helper()
+	evs, err := st.ListEvents(context.Background(), vmID)
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	for _, event := range evs {
+		id, ok := event.Data["operationId"].(string)
+		if event.Type != models.EventSpotInterrupted || !ok {
+			continue
+		}
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+			op, err := st.GetOperation(context.Background(), id)
+			if err != nil {
+				t.Fatalf("get operation: %v", err)
+			}
+			if op.Status == models.OperationSucceeded {
+				break
+			}
+			if op.Status == models.OperationFailed || time.Now().After(deadline) {
+				t.Fatalf("replacement operation %s is %s (%+v)", id, op.Status, op.Error)
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"vm-provisioner/internal/models"
+)
+
+const apiKeyColumns = `id, name, scopes, secret, previous_secret, previous_expires_at, created_at, rotated_at, revoked_at`
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var k models.APIKey
+	var scopes string
+	var previousExpiresAt, rotatedAt, revokedAt sql.NullTime
+	err := row.Scan(&k.ID, &k.Name, &scopes, &k.Secret, &k.PreviousSecret, &previousExpiresAt,
+		&k.CreatedAt, &rotatedAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	k.Scopes = strings.Split(scopes, ",")
+	if previousExpiresAt.Valid {
+		k.PreviousExpiresAt = &previousExpiresAt.Time
+	}
+	if rotatedAt.Valid {
+		k.RotatedAt = &rotatedAt.Time
+	}
+	if revokedAt.Valid {
+		k.RevokedAt = &revokedAt.Time
+	}
+	return &k, nil
+}
+
+// CreateAPIKey stores a newly issued API key.
+func (s *Store) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now().UTC()
+	}
+	_, err := s.exec(ctx, `INSERT INTO api_keys (id, name, scopes, secret, created_at) VALUES (?, ?, ?, ?, ?)`,
+		key.ID, key.Name, strings.Join(key.Scopes, ","), key.Secret, key.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to create API key %s: %w", key.ID, err)
+	}
+	return nil
+}
+
+// GetAPIKey returns an API key including its secrets, revoked or not.
+func (s *Store) GetAPIKey(ctx context.Context, id string) (*models.APIKey, error) {
+	key, err := scanAPIKey(s.queryRow(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("API key %s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API key %s: %w", id, err)
+	}
+	return key, nil
+}
+
+// ListAPIKeys returns every issued API key, oldest first.
+func (s *Store) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	rows, err := s.query(ctx, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// RotateAPIKey replaces the secret of an active key. The current secret keeps
+// working until grace has passed so callers can roll over without downtime.
+func (s *Store) RotateAPIKey(ctx context.Context, id, secret string, grace time.Duration) (*models.APIKey, error) {
+	now := time.Now().UTC()
+	result, err := s.exec(ctx, `UPDATE api_keys SET previous_secret = secret, previous_expires_at = ?, secret = ?, rotated_at = ?
+		WHERE id = ? AND revoked_at IS NULL`, now.Add(grace), secret, now, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate API key %s: %w", id, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("API key %s: %w", id, ErrNotFound)
+	}
+	return s.GetAPIKey(ctx, id)
+}
+
+// RevokeAPIKey disables a key immediately, including a rotated-out secret.
+func (s *Store) RevokeAPIKey(ctx context.Context, id string) error {
+	result, err := s.exec(ctx, `UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`,
+		time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key %s: %w", id, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("API key %s: %w", id, ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"vm-provisioner/internal/models"
+)
+
+// eventSettleWindow is how long a gap in the event IDs is waited on. On
+// Postgres an ID is taken when the insert runs but only becomes visible
+// when its transaction commits, so a lower ID can show up after a higher
+// one. Readers following the log by ID stop before young gaps rather than
+// skip the late event; older gaps are inserts that were rolled back.
+const eventSettleWindow = 10 * time.Second
+
+// queryRower is a *sql.DB or *sql.Tx.
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// unsettledEventID returns the ID of the first event after afterID that
+// follows a gap younger than eventSettleWindow, or math.MaxInt64 if there
+// is none. Readers must not move past the events before it.
+func (s *Store) unsettledEventID(ctx context.Context, q queryRower, afterID int64) (int64, error) {
+	var id sql.NullInt64
+	err := q.QueryRowContext(ctx, s.rebind(`SELECT MIN(e.id) FROM vm_events e
+		WHERE e.id > ? AND e.created_at > ? AND e.id - 1 > ?
+		AND NOT EXISTS (SELECT 1 FROM vm_events p WHERE p.id = e.id - 1)`),
+		afterID, time.Now().UTC().Add(-eventSettleWindow), afterID).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to look for gaps in the event log: %w", err)
+	}
+	if !id.Valid {
+		return math.MaxInt64, nil
+	}
+	return id.Int64, nil
+}
+
+// AppendEvent persists an event and assigns its ID, which is monotonically
+// increasing and can be used as a resume cursor.
+func (s *Store) AppendEvent(ctx context.Context, event *models.VMEvent) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return fmt.Errorf("failed to encode event data: %w", err)
+	}
+	if event.Data == nil {
+		data = []byte("{}")
+	}
+
+	err = s.queryRow(ctx, `INSERT INTO vm_events (vm_id, user_id, type, message, data, created_at)
+		VALUES (?, ?, ?, ?, ?, ?) RETURNING id`,
+		event.VMID, event.UserID, event.Type, event.Message, string(data), event.CreatedAt.UTC()).Scan(&event.ID)
+	if err != nil {
+		return fmt.Errorf("failed to append %s event for vm %s: %w", event.Type, event.VMID, err)
+	}
+	s.eventsAppended()
+	return nil
+}
+
+// ListEvents returns the events of a VM, oldest first.
+func (s *Store) ListEvents(ctx context.Context, vmID string) ([]models.VMEvent, error) {
+	rows, err := s.query(ctx, `SELECT id, vm_id, user_id, type, message, data, created_at
+		FROM vm_events WHERE vm_id = ? ORDER BY id`, vmID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events for vm %s: %w", vmID, err)
+	}
+	defer rows.Close()
+
+	return scanEvents(rows)
+}
+
+// ListEventsAfter returns up to limit events with an ID above afterID,
+// oldest first. Empty userID and vmID match every event. Events after a
+// gap that may still fill are left for a later call.
+func (s *Store) ListEventsAfter(ctx context.Context, afterID int64, userID, vmID string, limit int) ([]models.VMEvent, error) {
+	before, err := s.unsettledEventID(ctx, s.db, afterID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.query(ctx, `SELECT id, vm_id, user_id, type, message, data, created_at
+		FROM vm_events WHERE id > ? AND id < ? AND (? = '' OR user_id = ?) AND (? = '' OR vm_id = ?)
+		ORDER BY id LIMIT ?`, afterID, before, userID, userID, vmID, vmID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events after %d: %w", afterID, err)
+	}
+	defer rows.Close()
+
+	return scanEvents(rows)
+}
+
+// GetEvent returns a single event.
+func (s *Store) GetEvent(ctx context.Context, id int64) (*models.VMEvent, error) {
+	rows, err := s.query(ctx, `SELECT id, vm_id, user_id, type, message, data, created_at
+		FROM vm_events WHERE id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load event %d: %w", id, err)
+	}
+	defer rows.Close()
+
+	events, err := scanEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("event %d: %w", id, ErrNotFound)
+	}
+	return &events[0], nil
+}
+
+// LatestEventID returns the ID of the newest event before any gap that may
+// still fill, or 0 if there is none, so following it misses no event.
+func (s *Store) LatestEventID(ctx context.Context) (int64, error) {
+	before, err := s.unsettledEventID(ctx, s.db, 0)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	if err := s.queryRow(ctx, `SELECT COALESCE(MAX(id), 0) FROM vm_events WHERE id < ?`, before).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to read latest event id: %w", err)
+	}
+	return id, nil
+}
+
+func scanEvents(rows *sql.Rows) ([]models.VMEvent, error) {
+	var events []models.VMEvent
+	for rows.Next() {
+		var e models.VMEvent
+		var data string
+		if err := rows.Scan(&e.ID, &e.VMID, &e.UserID, &e.Type, &e.Message, &data, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(data), &e.Data); err != nil {
+			return nil, fmt.Errorf("failed to decode data of event %d: %w", e.ID, err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// OnEvents registers fn to be called whenever events were appended to the
+// event log, including those recorded with status changes. It must be set
+// before the store is used concurrently; fn must not block.
+func (s *Store) OnEvents(fn func()) {
+	s.onEvents = fn
+}
+
+func (s *Store) eventsAppended() {
+	if s.onEvents != nil {
+		s.onEvents()
+	}
+}
+
+// vmChange is an update of a VM's status and public IP.
+type vmChange struct {
+	id, userID, name     string
+	fromStatus, toStatus string
+	fromIP, toIP         string
+	reason               string
+}
+
+// insertStatusEvents records the events of a status change, if any, within
+// the transaction that makes it. It returns how many it recorded.
+func (s *Store) insertStatusEvents(ctx context.Context, tx *sql.Tx, change vmChange, at time.Time) (int, error) {
+	var events []models.VMEvent
+	if change.fromStatus != change.toStatus {
+		message := fmt.Sprintf("VM %s is %s", change.name, change.toStatus)
+		if change.fromStatus != "" {
+			message = fmt.Sprintf("VM %s changed from %s to %s", change.name, change.fromStatus, change.toStatus)
+		}
+		events = append(events, models.VMEvent{
+			Type:    models.EventStatusChanged,
+			Message: message,
+			Data:    map[string]any{"from": change.fromStatus, "to": change.toStatus, "reason": change.reason},
+		})
+	}
+	if change.toIP != "" && change.toIP != change.fromIP {
+		events = append(events, models.VMEvent{
+			Type:    models.EventIPAssigned,
+			Message: fmt.Sprintf("VM %s is reachable at %s", change.name, change.toIP),
+			Data:    map[string]any{"publicIp": change.toIP, "previousIp": change.fromIP},
+		})
+	}
+
+	for _, event := range events {
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode event data: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO vm_events (vm_id, user_id, type, message, data, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)`), change.id, change.userID, event.Type, event.Message, string(data), at); err != nil {
+			return 0, fmt.Errorf("failed to append %s event for vm %s: %w", event.Type, change.id, err)
+		}
+	}
+	return len(events), nil
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"vm-provisioner/internal/models"
+)
+
+// eventIDs returns the IDs of events, in order.
+func eventIDs(events []models.VMEvent) []int64 {
+	ids := []int64{}
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func TestStatusChangesAreEvents(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStore(t)
+	vm := &models.VMRecord{ID: "vm-1", Provider: "aws", Region: "eu-1", UserID: "u1", Name: "vm", Status: "pending"}
+	if err := st.CreateVM(ctx, vm); err != nil {
+		t.Fatalf("create vm: %v", err)
+	}
+	if _, err := st.UpdateVMStatus(ctx, "vm-1", "running", "203.0.113.7", "booted"); err != nil {
+		t.Fatalf("update status: %v", err)
+	}
+	// Unchanged status and IP record nothing
+	if _, err := st.UpdateVMStatus(ctx, "vm-1", "running", "203.0.113.7", "polled"); err != nil {
+		t.Fatalf("update status: %v", err)
+	}
+
+	events, err := st.ListEvents(ctx, "vm-1")
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	var got []string
+	for _, event := range events {
+		if event.UserID != "u1" {
+			t.Errorf("event %s has user %q, want u1", event.Type, event.UserID)
+		}
+		got = append(got, event.Type)
+	}
+	want := []string{models.EventStatusChanged, models.EventStatusChanged, models.EventIPAssigned}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}
+
+func TestListEventsAfter(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStore(t)
+	for _, event := range []models.VMEvent{
+		{VMID: "vm-1", UserID: "u1", Type: models.EventTTLWarning},
+		{VMID: "vm-2", UserID: "u2", Type: models.EventTTLWarning},
+		{VMID: "vm-1", UserID: "u1", Type: models.EventTTLExpired},
+		{VMID: "vm-3", UserID: "u1", Type: models.EventTTLExpired},
+	} {
+		if err := st.AppendEvent(ctx, &event); err != nil {
+			t.Fatalf("append event: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		afterID int64
+		userID  string
+		vmID    string
+		limit   int
+		want    []int64
+	}{
+		{"everything", 0, "", "", 10, []int64{1, 2, 3, 4}},
+		{"after a cursor", 2, "", "", 10, []int64{3, 4}},
+		{"limited", 0, "", "", 2, []int64{1, 2}},
+		{"one user", 0, "u1", "", 10, []int64{1, 3, 4}},
+		{"one VM", 0, "u1", "vm-1", 10, []int64{1, 3}},
+		{"caught up", 4, "", "", 10, []int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := st.ListEventsAfter(ctx, tt.afterID, tt.userID, tt.vmID, tt.limit)
+			if err != nil {
+				t.Fatalf("list events: %v", err)
+			}
+			if got := eventIDs(events); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	latest, err := st.LatestEventID(ctx)
+	if err != nil || latest != 4 {
+		t.Errorf("LatestEventID = %d, %v, want 4", latest, err)
+	}
+}
+
+// A gap in the event IDs can be an insert that has not committed yet, so
+// readers stop before it until it is older than eventSettleWindow.
+func TestListEventsAfterStopsAtYoungGaps(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		gapAge     time.Duration // age of the event after the gap
+		afterID    int64
+		want       []int64
+		wantLatest int64
+	}{
+		{"young gap", 0, 0, []int64{1}, 1},
+		{"settled gap", 2 * eventSettleWindow, 0, []int64{1, 3, 4}, 4},
+		{"cursor past the gap", 0, 2, []int64{3, 4}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := newTestStore(t)
+			for range 4 {
+				if err := st.AppendEvent(ctx, &models.VMEvent{VMID: "vm-1", UserID: "u1", Type: models.EventTTLWarning}); err != nil {
+					t.Fatalf("append event: %v", err)
+				}
+			}
+			// Event 2 was never committed
+			if _, err := st.exec(ctx, `DELETE FROM vm_events WHERE id = 2`); err != nil {
+				t.Fatalf("delete event: %v", err)
+			}
+			if _, err := st.exec(ctx, `UPDATE vm_events SET created_at = ? WHERE id = 3`, time.Now().UTC().Add(-tt.gapAge)); err != nil {
+				t.Fatalf("age event: %v", err)
+			}
+
+			events, err := st.ListEventsAfter(ctx, tt.afterID, "", "", 10)
+			if err != nil {
+				t.Fatalf("list events: %v", err)
+			}
+			if got := eventIDs(events); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %v, want %v", got, tt.want)
+			}
+			if latest, err := st.LatestEventID(ctx); err != nil || latest != tt.wantLatest {
+				t.Errorf("LatestEventID = %d, %v, want %d", latest, err, tt.wantLatest)
+			}
+		})
+	}
+}
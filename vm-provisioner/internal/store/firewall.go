@@ -0,0 +1,37 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"vm-provisioner/internal/models"
+)
+
+// SetVMFirewall records the firewall policy a VM was switched to.
+func (s *Store) SetVMFirewall(ctx context.Context, id string, policy *models.FirewallPolicy) error {
+	firewall, err := encodeFirewall(policy)
+	if err != nil {
+		return fmt.Errorf("failed to encode firewall of vm %s: %w", id, err)
+	}
+
+	result, err := s.exec(ctx, `UPDATE vms SET firewall = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL`,
+		firewall, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to set firewall of vm %s: %w", id, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("active vm %s: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// encodeFirewall stores a nil policy as an empty string.
+func encodeFirewall(policy *models.FirewallPolicy) (string, error) {
+	if policy == nil {
+		return "", nil
+	}
+	encoded, err := json.Marshal(policy)
+	return string(encoded), err
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// IdempotencyKey maps a client-supplied key to the operation it started
+type IdempotencyKey struct {
+	UserID      string
+	Key         string
+	RequestHash string
+	OperationID string // empty while the first request is still being submitted
+	CreatedAt   time.Time
+}
+
+// ReserveIdempotencyKey claims a key for a new request. If the key is already
+// taken, reserved is false and the existing mapping is returned. Keys older
+// than ttl are expired first and can be reused.
+func (s *Store) ReserveIdempotencyKey(ctx context.Context, userID, key, requestHash string, ttl time.Duration) (reserved bool, existing *IdempotencyKey, err error) {
+	now := time.Now().UTC()
+	if _, err := s.exec(ctx, `DELETE FROM idempotency_keys WHERE created_at < ?`, now.Add(-ttl)); err != nil {
+		return false, nil, fmt.Errorf("failed to expire idempotency keys: %w", err)
+	}
+
+	result, err := s.exec(ctx, `INSERT INTO idempotency_keys (user_id, idem_key, request_hash, created_at)
+		VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING`, userID, key, requestHash, now)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 1 {
+		return true, nil, nil
+	}
+
+	existing = &IdempotencyKey{UserID: userID, Key: key}
+	err = s.queryRow(ctx, `SELECT request_hash, operation_id, created_at FROM idempotency_keys
+		WHERE user_id = ? AND idem_key = ?`, userID, key).Scan(&existing.RequestHash, &existing.OperationID, &existing.CreatedAt)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to load idempotency key: %w", err)
+	}
+	return false, existing, nil
+}
+
+// SetIdempotencyOperation records the operation started for a reserved key.
+func (s *Store) SetIdempotencyOperation(ctx context.Context, userID, key, operationID string) error {
+	_, err := s.exec(ctx, `UPDATE idempotency_keys SET operation_id = ? WHERE user_id = ? AND idem_key = ?`,
+		operationID, userID, key)
+	if err != nil {
+		return fmt.Errorf("failed to record idempotency key operation: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey frees a reserved key whose request never started.
+func (s *Store) ReleaseIdempotencyKey(ctx context.Context, userID, key string) error {
+	_, err := s.exec(ctx, `DELETE FROM idempotency_keys WHERE user_id = ? AND idem_key = ? AND operation_id = ''`, userID, key)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
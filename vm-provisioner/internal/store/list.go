@@ -0,0 +1,160 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"vm-provisioner/internal/models"
+)
+
+// ErrInvalidCursor is returned for page cursors this store did not issue.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// VMFilter selects the VMs of a listing. Empty fields match everything.
+type VMFilter struct {
+	UserID   string
+	Provider string
+	Region   string
+	// Statuses match any of the given statuses. Without statuses only live
+	// VMs are listed.
+	Statuses []string
+	// Tags must all be present; an empty value matches any value.
+	Tags map[string]string
+	// Cursor continues a previous listing after its last VM
+	Cursor string
+	Limit  int
+}
+
+// ListVMs returns one page of VMs, newest first, and the cursor of the next
+// page, which is empty on the last page.
+func (s *Store) ListVMs(ctx context.Context, filter VMFilter) ([]models.VMRecord, string, error) {
+	var where []string
+	var args []any
+	add := func(clause string, values ...any) {
+		where = append(where, clause)
+		args = append(args, values...)
+	}
+
+	if filter.UserID != "" {
+		add(`user_id = ?`, filter.UserID)
+	}
+	if filter.Provider != "" {
+		add(`provider = ?`, filter.Provider)
+	}
+	if filter.Region != "" {
+		add(`region = ?`, filter.Region)
+	}
+	if len(filter.Statuses) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(filter.Statuses)), ", ")
+		values := make([]any, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			values[i] = status
+		}
+		add(`status IN (`+placeholders+`)`, values...)
+	} else {
+		add(`deleted_at IS NULL`)
+	}
+	for key, value := range filter.Tags {
+		if value == "" {
+			add(`EXISTS (SELECT 1 FROM vm_tags WHERE vm_tags.vm_id = vms.id AND tag_key = ?)`, key)
+		} else {
+			add(`EXISTS (SELECT 1 FROM vm_tags WHERE vm_tags.vm_id = vms.id AND tag_key = ? AND tag_value = ?)`, key, value)
+		}
+	}
+	if filter.Cursor != "" {
+		createdAt, id, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		add(`(created_at < ? OR (created_at = ? AND id < ?))`, createdAt, createdAt, id)
+	}
+
+	// One extra row tells whether another page follows
+	vms, err := s.listVMs(ctx, strings.Join(where, ` AND `)+` ORDER BY created_at DESC, id DESC LIMIT ?`,
+		append(args, filter.Limit+1)...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(vms) > filter.Limit {
+		vms = vms[:filter.Limit]
+		last := vms[len(vms)-1]
+		next = encodeCursor(last.CreatedAt, last.ID)
+	}
+
+	if err := s.loadTags(ctx, vms); err != nil {
+		return nil, "", err
+	}
+	return vms, next, nil
+}
+
+// encodeCursor makes the position of a VM in the listing order opaque to
+// clients.
+func encodeCursor(createdAt time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(createdAt.UnixNano(), 10) + "|" + id))
+}
+
+func decodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	nanos, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	return time.Unix(0, n).UTC(), id, nil
+}
+
+// vmTags returns the tags of one VM, or nil if it has none.
+func (s *Store) vmTags(ctx context.Context, vmID string) (map[string]string, error) {
+	vms := []models.VMRecord{{ID: vmID}}
+	if err := s.loadTags(ctx, vms); err != nil {
+		return nil, err
+	}
+	return vms[0].Tags, nil
+}
+
+// loadTags fills in the tags of the given VMs with a single query.
+func (s *Store) loadTags(ctx context.Context, vms []models.VMRecord) error {
+	if len(vms) == 0 {
+		return nil
+	}
+
+	index := make(map[string]int, len(vms))
+	ids := make([]any, len(vms))
+	for i, vm := range vms {
+		index[vm.ID] = i
+		ids[i] = vm.ID
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+
+	rows, err := s.query(ctx, `SELECT vm_id, tag_key, tag_value FROM vm_tags WHERE vm_id IN (`+placeholders+`)`, ids...)
+	if err != nil {
+		return fmt.Errorf("failed to load vm tags: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var vmID, key, value string
+		if err := rows.Scan(&vmID, &key, &value); err != nil {
+			return err
+		}
+		vm := &vms[index[vmID]]
+		if vm.Tags == nil {
+			vm.Tags = map[string]string{}
+		}
+		vm.Tags[key] = value
+	}
+	return rows.Err()
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"vm-provisioner/internal/models"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		createdAt time.Time
+		id        string
+	}{
+		{"plain", time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC), "i-0123456789abcdef0"},
+		{"nanoseconds", time.Date(2024, 6, 1, 12, 0, 0, 123456789, time.UTC), "42"},
+		{"id with separator", time.Unix(1700000000, 0).UTC(), "a|b"},
+		{"local time", time.Date(2024, 6, 1, 14, 0, 0, 0, time.FixedZone("CEST", 2*60*60)), "vm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createdAt, id, err := decodeCursor(encodeCursor(tt.createdAt, tt.id))
+			if err != nil {
+				t.Fatalf("decodeCursor: %v", err)
+			}
+			if !createdAt.Equal(tt.createdAt) || id != tt.id {
+				t.Errorf("decoded (%v, %q), want (%v, %q)", createdAt, id, tt.createdAt, tt.id)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "not a cursor!"},
+		{"missing separator", encode("1700000000")},
+		{"non-numeric time", encode("yesterday|vm")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := decodeCursor(tt.cursor); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("decodeCursor(%q) error = %v, want ErrInvalidCursor", tt.cursor, err)
+			}
+		})
+	}
+}
+
+func TestListVMsPages(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStore(t)
+
+	// vm-0 is the oldest; vm-3 and vm-4 share a creation time
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i, offset := range []time.Duration{0, time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		vm := &models.VMRecord{ID: fmt.Sprintf("vm-%d", i), Provider: "aws", Region: "eu-west-1", UserID: "u1",
+			Name: "vm", Status: "running", CreatedAt: base.Add(offset)}
+		if err := st.CreateVM(ctx, vm); err != nil {
+			t.Fatalf("create vm: %v", err)
+		}
+	}
+
+	tests := []struct {
+		limit int
+		want  [][]string
+	}{
+		{limit: 2, want: [][]string{{"vm-4", "vm-3"}, {"vm-2", "vm-1"}, {"vm-0"}}},
+		{limit: 4, want: [][]string{{"vm-4", "vm-3", "vm-2", "vm-1"}, {"vm-0"}}},
+		{limit: 5, want: [][]string{{"vm-4", "vm-3", "vm-2", "vm-1", "vm-0"}}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("limit %d", tt.limit), func(t *testing.T) {
+			var pages [][]string
+			cursor := ""
+			for {
+				vms, next, err := st.ListVMs(ctx, VMFilter{UserID: "u1", Cursor: cursor, Limit: tt.limit})
+				if err != nil {
+					t.Fatalf("list: %v", err)
+				}
+				var ids []string
+				for _, vm := range vms {
+					ids = append(ids, vm.ID)
+				}
+				pages = append(pages, ids)
+				if next == "" || len(pages) > len(tt.want) {
+					break
+				}
+				cursor = next
+			}
+			if !reflect.DeepEqual(pages, tt.want) {
+				t.Errorf("pages = %v, want %v", pages, tt.want)
+			}
+		})
+	}
+
+	if _, _, err := st.ListVMs(ctx, VMFilter{Cursor: "bogus!", Limit: 2}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("list with bogus cursor: error = %v, want ErrInvalidCursor", err)
+	}
+}
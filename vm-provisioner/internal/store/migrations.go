@@ -0,0 +1,237 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// migrations are applied in order and recorded in schema_migrations.
+// Never edit an applied migration; append a new one instead.
+// {{serial}} expands to the auto-incrementing primary key of each dialect.
+var migrations = []string{
+	// 1: VMs created by the provisioner and their lifecycle transitions
+	`CREATE TABLE vms (
+		id                TEXT PRIMARY KEY,
+		provider          TEXT NOT NULL,
+		region            TEXT NOT NULL,
+		user_id           TEXT NOT NULL,
+		name              TEXT NOT NULL,
+		instance_type     TEXT NOT NULL,
+		image             TEXT NOT NULL DEFAULT '',
+		use_spot_instance BOOLEAN NOT NULL DEFAULT FALSE,
+		status            TEXT NOT NULL,
+		public_ip         TEXT NOT NULL DEFAULT '',
+		ssh_username      TEXT NOT NULL DEFAULT '',
+		created_at        TIMESTAMP NOT NULL,
+		updated_at        TIMESTAMP NOT NULL,
+		deleted_at        TIMESTAMP
+	);
+	CREATE INDEX idx_vms_user_id ON vms (user_id);
+	CREATE TABLE vm_transitions (
+		id          {{serial}},
+		vm_id       TEXT NOT NULL REFERENCES vms (id),
+		from_status TEXT NOT NULL,
+		to_status   TEXT NOT NULL,
+		reason      TEXT NOT NULL DEFAULT '',
+		created_at  TIMESTAMP NOT NULL
+	);
+	CREATE INDEX idx_vm_transitions_vm_id ON vm_transitions (vm_id);`,
+	// 2: server-side auto-termination deadlines and the lifecycle event log
+	`ALTER TABLE vms ADD COLUMN expires_at TIMESTAMP;
+	ALTER TABLE vms ADD COLUMN ttl_warned_at TIMESTAMP;
+	CREATE INDEX idx_vms_expires_at ON vms (expires_at);
+	CREATE TABLE vm_events (
+		id         {{serial}},
+		vm_id      TEXT NOT NULL,
+		user_id    TEXT NOT NULL DEFAULT '',
+		type       TEXT NOT NULL,
+		message    TEXT NOT NULL DEFAULT '',
+		data       TEXT NOT NULL DEFAULT '{}',
+		created_at TIMESTAMP NOT NULL
+	);
+	CREATE INDEX idx_vm_events_vm_id ON vm_events (vm_id);`,
+	// 3: per-user SSH public key registry
+	`CREATE TABLE ssh_keys (
+		id          TEXT PRIMARY KEY,
+		user_id     TEXT NOT NULL,
+		name        TEXT NOT NULL,
+		public_key  TEXT NOT NULL,
+		fingerprint TEXT NOT NULL,
+		created_at  TIMESTAMP NOT NULL,
+		UNIQUE (user_id, fingerprint)
+	);`,
+	// 4: asynchronous operations
+	`CREATE TABLE operations (
+		id            TEXT PRIMARY KEY,
+		type          TEXT NOT NULL,
+		vm_id         TEXT NOT NULL DEFAULT '',
+		user_id       TEXT NOT NULL DEFAULT '',
+		status        TEXT NOT NULL,
+		progress      TEXT NOT NULL DEFAULT '',
+		result        TEXT,
+		error_code    TEXT NOT NULL DEFAULT '',
+		error_message TEXT NOT NULL DEFAULT '',
+		created_at    TIMESTAMP NOT NULL,
+		updated_at    TIMESTAMP NOT NULL,
+		started_at    TIMESTAMP,
+		finished_at   TIMESTAMP
+	);
+	CREATE INDEX idx_operations_status ON operations (status);`,
+	// 5: idempotency keys for VM creation
+	`CREATE TABLE idempotency_keys (
+		user_id      TEXT NOT NULL,
+		idem_key     TEXT NOT NULL,
+		request_hash TEXT NOT NULL,
+		operation_id TEXT NOT NULL DEFAULT '',
+		created_at   TIMESTAMP NOT NULL,
+		PRIMARY KEY (user_id, idem_key)
+	);`,
+	// 6: API keys of calling services
+	`CREATE TABLE api_keys (
+		id                  TEXT PRIMARY KEY,
+		name                TEXT NOT NULL,
+		scopes              TEXT NOT NULL,
+		secret              TEXT NOT NULL,
+		previous_secret     TEXT NOT NULL DEFAULT '',
+		previous_expires_at TIMESTAMP,
+		created_at          TIMESTAMP NOT NULL,
+		rotated_at          TIMESTAMP,
+		revoked_at          TIMESTAMP
+	);`,
+	// 7: spot interruptions and the requests spot VMs are relaunched from
+	`ALTER TABLE vms ADD COLUMN replace_on_interruption BOOLEAN NOT NULL DEFAULT FALSE;
+	ALTER TABLE vms ADD COLUMN interruption_reason TEXT NOT NULL DEFAULT '';
+	ALTER TABLE vms ADD COLUMN interruption_warned_at TIMESTAMP;
+	ALTER TABLE vms ADD COLUMN replaced_by TEXT NOT NULL DEFAULT '';
+	CREATE TABLE vm_launch_requests (
+		vm_id      TEXT PRIMARY KEY,
+		request    TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	);`,
+	// 8: persistent data volumes
+	`CREATE TABLE volumes (
+		id                TEXT PRIMARY KEY,
+		provider          TEXT NOT NULL,
+		region            TEXT NOT NULL,
+		availability_zone TEXT NOT NULL DEFAULT '',
+		user_id           TEXT NOT NULL,
+		name              TEXT NOT NULL,
+		size_gib          INTEGER NOT NULL,
+		status            TEXT NOT NULL,
+		vm_id             TEXT NOT NULL DEFAULT '',
+		mount_path        TEXT NOT NULL DEFAULT '',
+		created_at        TIMESTAMP NOT NULL,
+		updated_at        TIMESTAMP NOT NULL,
+		deleted_at        TIMESTAMP
+	);
+	CREATE INDEX idx_volumes_user_id ON volumes (user_id);
+	CREATE INDEX idx_volumes_vm_id ON volumes (vm_id);`,
+	// 9: VM snapshots and their per-user retention
+	`CREATE TABLE snapshots (
+		id           TEXT PRIMARY KEY,
+		provider     TEXT NOT NULL,
+		region       TEXT NOT NULL DEFAULT '',
+		user_id      TEXT NOT NULL,
+		vm_id        TEXT NOT NULL,
+		name         TEXT NOT NULL,
+		status       TEXT NOT NULL,
+		ssh_username TEXT NOT NULL DEFAULT '',
+		created_at   TIMESTAMP NOT NULL,
+		updated_at   TIMESTAMP NOT NULL,
+		deleted_at   TIMESTAMP
+	);
+	CREATE INDEX idx_snapshots_user_id ON snapshots (user_id);
+	CREATE TABLE snapshot_policies (
+		user_id      TEXT PRIMARY KEY,
+		keep_last    INTEGER NOT NULL DEFAULT 0,
+		max_age_days INTEGER NOT NULL DEFAULT 0
+	);`,
+	// 10: per-VM firewall policies
+	`ALTER TABLE vms ADD COLUMN firewall TEXT NOT NULL DEFAULT '';`,
+	// 11: user tags of VMs and the index VM listings are paginated by
+	`CREATE TABLE vm_tags (
+		vm_id     TEXT NOT NULL REFERENCES vms (id),
+		tag_key   TEXT NOT NULL,
+		tag_value TEXT NOT NULL,
+		PRIMARY KEY (vm_id, tag_key)
+	);
+	CREATE INDEX idx_vm_tags_key_value ON vm_tags (tag_key, tag_value);
+	CREATE INDEX idx_vms_created_at_id ON vms (created_at, id);`,
+	// 12: webhook subscriptions, their deliveries and how far the event log
+	// has been fanned out to them; earlier events are not delivered
+	`CREATE TABLE webhooks (
+		id         TEXT PRIMARY KEY,
+		user_id    TEXT NOT NULL DEFAULT '',
+		url        TEXT NOT NULL,
+		events     TEXT NOT NULL,
+		secret     TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		deleted_at TIMESTAMP
+	);
+	CREATE TABLE webhook_deliveries (
+		id              {{serial}},
+		webhook_id      TEXT NOT NULL,
+		event_id        BIGINT NOT NULL,
+		event_type      TEXT NOT NULL,
+		status          TEXT NOT NULL,
+		attempts        INTEGER NOT NULL DEFAULT 0,
+		last_error      TEXT NOT NULL DEFAULT '',
+		response_status INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMP NOT NULL,
+		created_at      TIMESTAMP NOT NULL,
+		delivered_at    TIMESTAMP
+	);
+	CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at);
+	CREATE INDEX idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id);
+	CREATE TABLE webhook_cursor (
+		id            INTEGER PRIMARY KEY,
+		last_event_id BIGINT NOT NULL
+	);
+	INSERT INTO webhook_cursor (id, last_event_id) SELECT 1, COALESCE(MAX(id), 0) FROM vm_events;`,
+	// 13: results of creates used to be stored with the generated SSH
+	// password; drop those, the VMs themselves stay recorded
+	`UPDATE operations SET result = NULL WHERE result LIKE '%"sshPassword"%';`,
+	// 14: readers of the event log look for gaps among recent events
+	`CREATE INDEX idx_vm_events_created_at ON vm_events (created_at);`,
+}
+
+func (s *Store) migrate(ctx context.Context) error {
+	if _, err := s.exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := s.queryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	serial := "INTEGER PRIMARY KEY AUTOINCREMENT"
+	if s.driver == "postgres" {
+		serial = "BIGSERIAL PRIMARY KEY"
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		ddl := strings.ReplaceAll(migrations[i], "{{serial}}", serial)
+		err := s.withTx(ctx, func(tx *sql.Tx) error {
+			for _, stmt := range strings.Split(ddl, ";") {
+				if strings.TrimSpace(stmt) == "" {
+					continue
+				}
+				if _, err := tx.ExecContext(ctx, stmt); err != nil {
+					return err
+				}
+			}
+			_, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO schema_migrations (version) VALUES (?)`), version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %d: %w", version, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"vm-provisioner/internal/models"
+)
+
+const operationColumns = `id, type, vm_id, user_id, status, progress, result, error_code, error_message,
+	created_at, updated_at, started_at, finished_at`
+
+func scanOperation(row rowScanner) (*models.Operation, error) {
+	var op models.Operation
+	var result sql.NullString
+	var errCode, errMessage string
+	var startedAt, finishedAt sql.NullTime
+	err := row.Scan(&op.ID, &op.Type, &op.VMID, &op.UserID, &op.Status, &op.Progress, &result,
+		&errCode, &errMessage, &op.CreatedAt, &op.UpdatedAt, &startedAt, &finishedAt)
+	if err != nil {
+		return nil, err
+	}
+	if result.Valid {
+		op.Result = []byte(result.String)
+	}
+	if errCode != "" {
+		op.Error = &models.OperationError{Code: errCode, Message: errMessage}
+	}
+	if startedAt.Valid {
+		op.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		op.FinishedAt = &finishedAt.Time
+	}
+	return &op, nil
+}
+
+// CreateOperation persists a new operation.
+func (s *Store) CreateOperation(ctx context.Context, op *models.Operation) error {
+	now := time.Now().UTC()
+	op.CreatedAt, op.UpdatedAt = now, now
+	_, err := s.exec(ctx, `INSERT INTO operations (id, type, vm_id, user_id, status, progress, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, op.ID, op.Type, op.VMID, op.UserID, op.Status, op.Progress, now, now)
+	if err != nil {
+		return fmt.Errorf("failed to create operation %s: %w", op.ID, err)
+	}
+	return nil
+}
+
+// GetOperation returns a stored operation.
+func (s *Store) GetOperation(ctx context.Context, id string) (*models.Operation, error) {
+	op, err := scanOperation(s.queryRow(ctx, `SELECT `+operationColumns+` FROM operations WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("operation %s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load operation %s: %w", id, err)
+	}
+	return op, nil
+}
+
+// StartOperation marks an operation as running.
+func (s *Store) StartOperation(ctx context.Context, id string) error {
+	now := time.Now().UTC()
+	_, err := s.exec(ctx, `UPDATE operations SET status = ?, started_at = ?, updated_at = ? WHERE id = ?`,
+		models.OperationRunning, now, now, id)
+	if err != nil {
+		return fmt.Errorf("failed to start operation %s: %w", id, err)
+	}
+	return nil
+}
+
+// UpdateOperationProgress stores a human-readable progress message.
+func (s *Store) UpdateOperationProgress(ctx context.Context, id, progress string) error {
+	_, err := s.exec(ctx, `UPDATE operations SET progress = ?, updated_at = ? WHERE id = ?`,
+		progress, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to update operation %s: %w", id, err)
+	}
+	return nil
+}
+
+// SetOperationVM links an operation to the VM it acts on, once known.
+func (s *Store) SetOperationVM(ctx context.Context, id, vmID string) error {
+	_, err := s.exec(ctx, `UPDATE operations SET vm_id = ?, updated_at = ? WHERE id = ?`,
+		vmID, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to update operation %s: %w", id, err)
+	}
+	return nil
+}
+
+// FinishOperation records the outcome of an operation. opErr nil means success.
+func (s *Store) FinishOperation(ctx context.Context, id string, result []byte, opErr *models.OperationError) error {
+	now := time.Now().UTC()
+	status := models.OperationSucceeded
+	var errCode, errMessage string
+	if opErr != nil {
+		status = models.OperationFailed
+		errCode, errMessage = opErr.Code, opErr.Message
+	}
+	var resultValue any
+	if result != nil {
+		resultValue = string(result)
+	}
+
+	_, err := s.exec(ctx, `UPDATE operations SET status = ?, result = ?, error_code = ?, error_message = ?,
+		updated_at = ?, finished_at = ? WHERE id = ?`, status, resultValue, errCode, errMessage, now, now, id)
+	if err != nil {
+		return fmt.Errorf("failed to finish operation %s: %w", id, err)
+	}
+	return nil
+}
+
+// FailUnfinishedOperations fails every queued or running operation. Their
+// work lived in memory, so after a restart they can never complete.
+func (s *Store) FailUnfinishedOperations(ctx context.Context, opErr models.OperationError) (int64, error) {
+	now := time.Now().UTC()
+	result, err := s.exec(ctx, `UPDATE operations SET status = ?, error_code = ?, error_message = ?,
+		updated_at = ?, finished_at = ? WHERE status IN (?, ?)`, models.OperationFailed, opErr.Code, opErr.Message,
+		now, now, models.OperationQueued, models.OperationRunning)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fail unfinished operations: %w", err)
+	}
+	return result.RowsAffected()
+}
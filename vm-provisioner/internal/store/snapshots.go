@@ -0,0 +1,129 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"vm-provisioner/internal/models"
+)
+
+const snapshotColumns = `id, provider, region, user_id, vm_id, name, status, ssh_username,
+	created_at, updated_at, deleted_at`
+
+func scanSnapshot(row rowScanner) (*models.Snapshot, error) {
+	var s models.Snapshot
+	var deletedAt sql.NullTime
+	err := row.Scan(&s.ID, &s.Provider, &s.Region, &s.UserID, &s.VMID, &s.Name, &s.Status, &s.SSHUsername,
+		&s.CreatedAt, &s.UpdatedAt, &deletedAt)
+	if err != nil {
+		return nil, err
+	}
+	if deletedAt.Valid {
+		s.DeletedAt = &deletedAt.Time
+	}
+	return &s, nil
+}
+
+// CreateSnapshot records a snapshot the provider started capturing.
+func (s *Store) CreateSnapshot(ctx context.Context, snap *models.Snapshot) error {
+	now := time.Now().UTC()
+	if snap.CreatedAt.IsZero() {
+		snap.CreatedAt = now
+	}
+	snap.UpdatedAt = now
+
+	_, err := s.exec(ctx, `INSERT INTO snapshots (`+snapshotColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULL)`,
+		snap.ID, snap.Provider, snap.Region, snap.UserID, snap.VMID, snap.Name, snap.Status, snap.SSHUsername,
+		snap.CreatedAt.UTC(), snap.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert snapshot %s: %w", snap.ID, err)
+	}
+	return nil
+}
+
+// GetSnapshot returns a snapshot that has not been deleted.
+func (s *Store) GetSnapshot(ctx context.Context, id string) (*models.Snapshot, error) {
+	snap, err := scanSnapshot(s.queryRow(ctx, `SELECT `+snapshotColumns+` FROM snapshots WHERE id = ? AND deleted_at IS NULL`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("snapshot %s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load snapshot %s: %w", id, err)
+	}
+	return snap, nil
+}
+
+// ListSnapshots returns the snapshots of a user that have not been deleted,
+// newest first. An empty userID lists every user's snapshots.
+func (s *Store) ListSnapshots(ctx context.Context, userID string) ([]models.Snapshot, error) {
+	where, args := `deleted_at IS NULL`, []any{}
+	if userID != "" {
+		where, args = where+` AND user_id = ?`, append(args, userID)
+	}
+	rows, err := s.query(ctx, `SELECT `+snapshotColumns+` FROM snapshots WHERE `+where+` ORDER BY created_at DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshots []models.Snapshot
+	for rows.Next() {
+		snap, err := scanSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, *snap)
+	}
+	return snapshots, rows.Err()
+}
+
+// SetSnapshotStatus records the latest status of a pending snapshot.
+func (s *Store) SetSnapshotStatus(ctx context.Context, id, status string) error {
+	_, err := s.exec(ctx, `UPDATE snapshots SET status = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL`,
+		status, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to update snapshot %s: %w", id, err)
+	}
+	return nil
+}
+
+// MarkSnapshotDeleted records that the provider deleted a snapshot.
+func (s *Store) MarkSnapshotDeleted(ctx context.Context, id string) error {
+	now := time.Now().UTC()
+	_, err := s.exec(ctx, `UPDATE snapshots SET status = ?, updated_at = ?, deleted_at = ? WHERE id = ? AND deleted_at IS NULL`,
+		models.SnapshotDeleted, now, now, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark snapshot %s deleted: %w", id, err)
+	}
+	return nil
+}
+
+// GetSnapshotPolicy returns the retention policy a user set, or
+// ErrNotFound if they use the default.
+func (s *Store) GetSnapshotPolicy(ctx context.Context, userID string) (*models.SnapshotPolicy, error) {
+	policy := models.SnapshotPolicy{UserID: userID}
+	err := s.queryRow(ctx, `SELECT keep_last, max_age_days FROM snapshot_policies WHERE user_id = ?`, userID).
+		Scan(&policy.KeepLast, &policy.MaxAgeDays)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("snapshot policy of %s: %w", userID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load snapshot policy of %s: %w", userID, err)
+	}
+	return &policy, nil
+}
+
+// SetSnapshotPolicy stores the retention policy of a user.
+func (s *Store) SetSnapshotPolicy(ctx context.Context, policy *models.SnapshotPolicy) error {
+	_, err := s.exec(ctx, `INSERT INTO snapshot_policies (user_id, keep_last, max_age_days) VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET keep_last = excluded.keep_last, max_age_days = excluded.max_age_days`,
+		policy.UserID, policy.KeepLast, policy.MaxAgeDays)
+	if err != nil {
+		return fmt.Errorf("failed to store snapshot policy of %s: %w", policy.UserID, err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"vm-provisioner/internal/models"
+)
+
+// ListSpotVMsToCheck returns spot VMs without a recorded interruption that
+// are live or were terminated after since, oldest first. Terminated ones are
+// included because a status poll may have noticed the termination before
+// its cause was looked up.
+func (s *Store) ListSpotVMsToCheck(ctx context.Context, since time.Time) ([]models.VMRecord, error) {
+	return s.listVMs(ctx, `use_spot_instance = ? AND interruption_reason = ''
+		AND (deleted_at IS NULL OR deleted_at > ?) ORDER BY created_at`, true, since.UTC())
+}
+
+// MarkInterruptionWarned records that the interruption notice of a spot VM
+// was published, and reports whether it had not been before.
+func (s *Store) MarkInterruptionWarned(ctx context.Context, id string, at time.Time) (bool, error) {
+	result, err := s.exec(ctx, `UPDATE vms SET interruption_warned_at = ? WHERE id = ? AND interruption_warned_at IS NULL`,
+		at.UTC(), id)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark vm %s as warned of interruption: %w", id, err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// RecordInterruption stores why the provider reclaimed a spot VM and marks
+// it terminated. It reports whether the interruption was not recorded
+// before, so it is acted on once.
+func (s *Store) RecordInterruption(ctx context.Context, id, reason, publicIP string) (bool, error) {
+	result, err := s.exec(ctx, `UPDATE vms SET interruption_reason = ? WHERE id = ? AND interruption_reason = ''`, reason, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to record interruption of vm %s: %w", id, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	if _, err := s.UpdateVMStatus(ctx, id, "terminated", publicIP, "spot interruption: "+reason); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetReplacedBy links an interrupted spot VM to the VM launched in its place.
+func (s *Store) SetReplacedBy(ctx context.Context, id, replacementID string) error {
+	if _, err := s.exec(ctx, `UPDATE vms SET replaced_by = ?, updated_at = ? WHERE id = ?`,
+		replacementID, time.Now().UTC(), id); err != nil {
+		return fmt.Errorf("failed to link vm %s to replacement %s: %w", id, replacementID, err)
+	}
+	return nil
+}
+
+// SaveLaunchRequest keeps the request a VM was created from so an
+// equivalent VM can be launched later.
+func (s *Store) SaveLaunchRequest(ctx context.Context, vmID string, req *models.VMRequest) error {
+	encoded, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode launch request of vm %s: %w", vmID, err)
+	}
+	if _, err := s.exec(ctx, `INSERT INTO vm_launch_requests (vm_id, request, created_at) VALUES (?, ?, ?)`,
+		vmID, string(encoded), time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to save launch request of vm %s: %w", vmID, err)
+	}
+	return nil
+}
+
+// GetLaunchRequest returns the request a VM was created from.
+func (s *Store) GetLaunchRequest(ctx context.Context, vmID string) (*models.VMRequest, error) {
+	var encoded string
+	err := s.queryRow(ctx, `SELECT request FROM vm_launch_requests WHERE vm_id = ?`, vmID).Scan(&encoded)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("launch request of vm %s: %w", vmID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load launch request of vm %s: %w", vmID, err)
+	}
+
+	var req models.VMRequest
+	if err := json.Unmarshal([]byte(encoded), &req); err != nil {
+		return nil, fmt.Errorf("failed to decode launch request of vm %s: %w", vmID, err)
+	}
+	return &req, nil
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"vm-provisioner/internal/models"
+)
+
+const sshKeyColumns = `id, user_id, name, public_key, fingerprint, created_at`
+
+// CreateSSHKey registers a public key for a user.
+func (s *Store) CreateSSHKey(ctx context.Context, key *models.SSHKey) error {
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now().UTC()
+	}
+	_, err := s.exec(ctx, `INSERT INTO ssh_keys (`+sshKeyColumns+`) VALUES (?, ?, ?, ?, ?, ?)`,
+		key.ID, key.UserID, key.Name, key.PublicKey, key.Fingerprint, key.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to register SSH key %s: %w", key.Fingerprint, err)
+	}
+	return nil
+}
+
+// GetSSHKey loads a registered key of any user.
+func (s *Store) GetSSHKey(ctx context.Context, id string) (*models.SSHKey, error) {
+	var k models.SSHKey
+	err := s.queryRow(ctx, `SELECT `+sshKeyColumns+` FROM ssh_keys WHERE id = ?`, id).
+		Scan(&k.ID, &k.UserID, &k.Name, &k.PublicKey, &k.Fingerprint, &k.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("SSH key %s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SSH key %s: %w", id, err)
+	}
+	return &k, nil
+}
+
+// ListSSHKeys returns the keys registered for a user. When ids is non-empty
+// only those keys are returned; IDs belonging to other users are ignored.
+// An empty userID lists every user's keys.
+func (s *Store) ListSSHKeys(ctx context.Context, userID string, ids ...string) ([]models.SSHKey, error) {
+	where, args := `1 = 1`, []any{}
+	if userID != "" {
+		where, args = `user_id = ?`, append(args, userID)
+	}
+	rows, err := s.query(ctx, `SELECT `+sshKeyColumns+` FROM ssh_keys WHERE `+where+` ORDER BY created_at`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list SSH keys: %w", err)
+	}
+	defer rows.Close()
+
+	wanted := map[string]bool{}
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	var keys []models.SSHKey
+	for rows.Next() {
+		var k models.SSHKey
+		if err := rows.Scan(&k.ID, &k.UserID, &k.Name, &k.PublicKey, &k.Fingerprint, &k.CreatedAt); err != nil {
+			return nil, err
+		}
+		if len(wanted) == 0 || wanted[k.ID] {
+			keys = append(keys, k)
+		}
+	}
+	return keys, rows.Err()
+}
+
+// DeleteSSHKey removes a key owned by the given user.
+func (s *Store) DeleteSSHKey(ctx context.Context, userID, id string) error {
+	result, err := s.exec(ctx, `DELETE FROM ssh_keys WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete SSH key %s: %w", id, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("SSH key %s: %w", id, ErrNotFound)
+	}
+	return nil
+}
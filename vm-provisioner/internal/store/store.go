@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/models"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// ErrNotFound is returned when a requested row does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Store persists everything the provisioner knows about its fleet.
+// SQLite is the default backend; Postgres can be used for shared deployments.
+type Store struct {
+	db     *sql.DB
+	driver string
+
+	onEvents       func()                                          // see OnEvents
+	onFirstRunning func(vm models.VMRecord, elapsed time.Duration) // see OnFirstRunning
+}
+
+// Open connects to the configured database and applies pending migrations.
+func Open(ctx context.Context, cfg config.StoreConfig) (*Store, error) {
+	var driverName string
+	switch cfg.Driver {
+	case "sqlite":
+		driverName = "sqlite3"
+	case "postgres":
+		driverName = "postgres"
+	default:
+		return nil, fmt.Errorf("unsupported store driver: %s", cfg.Driver)
+	}
+
+	db, err := sql.Open(driverName, cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s store: %w", cfg.Driver, err)
+	}
+	if cfg.Driver == "sqlite" {
+		// SQLite allows a single writer; serialize access instead of
+		// surfacing "database is locked" errors under concurrent requests.
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to %s store: %w", cfg.Driver, err)
+	}
+
+	s := &Store{db: db, driver: cfg.Driver}
+	if err := s.migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// rebind rewrites '?' placeholders into the numbered form Postgres expects.
+func (s *Store) rebind(query string) string {
+	if s.driver != "postgres" {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *Store) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return s.db.ExecContext(ctx, s.rebind(query), args...)
+}
+
+func (s *Store) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return s.db.QueryContext(ctx, s.rebind(query), args...)
+}
+
+func (s *Store) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	return s.db.QueryRowContext(ctx, s.rebind(query), args...)
+}
+
+// withTx runs fn inside a transaction, rolling back if it returns an error.
+func (s *Store) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/models"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	st, err := Open(context.Background(), config.StoreConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+func TestRebind(t *testing.T) {
+	query := `UPDATE vms SET status = ? WHERE id = ? AND status <> '?'`
+	tests := []struct {
+		driver string
+		want   string
+	}{
+		{"sqlite", query},
+		{"postgres", `UPDATE vms SET status = $1 WHERE id = $2 AND status <> '$3'`},
+	}
+	for _, tt := range tests {
+		if got := (&Store{driver: tt.driver}).rebind(query); got != tt.want {
+			t.Errorf("rebind for %s = %q, want %q", tt.driver, got, tt.want)
+		}
+	}
+}
+
+func TestVMLifecycle(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStore(t)
+
+	vm := &models.VMRecord{ID: "vm-1", Provider: "aws", Region: "eu-west-1", UserID: "u1", Name: "vm",
+		InstanceType: "t3.micro", Status: "pending", SSHUsername: "ubuntu"}
+	if err := st.CreateVM(ctx, vm); err != nil {
+		t.Fatalf("create vm: %v", err)
+	}
+
+	steps := []struct {
+		status, publicIP string
+		wantChanged      bool
+	}{
+		{"running", "203.0.113.7", true},
+		{"running", "203.0.113.7", false},
+		{"terminated", "", true},
+	}
+	for _, step := range steps {
+		changed, err := st.UpdateVMStatus(ctx, "vm-1", step.status, step.publicIP, "test")
+		if err != nil {
+			t.Fatalf("update to %s: %v", step.status, err)
+		}
+		if changed != step.wantChanged {
+			t.Errorf("update to %s changed = %v, want %v", step.status, changed, step.wantChanged)
+		}
+	}
+
+	stored, err := st.GetVM(ctx, "vm-1")
+	if err != nil {
+		t.Fatalf("get vm: %v", err)
+	}
+	if stored.Status != "terminated" || stored.DeletedAt == nil || stored.Region != "eu-west-1" || stored.SSHUsername != "ubuntu" {
+		t.Errorf("stored vm = %+v, want terminated in eu-west-1", stored)
+	}
+
+	transitions, err := st.ListTransitions(ctx, "vm-1")
+	if err != nil {
+		t.Fatalf("list transitions: %v", err)
+	}
+	var got [][2]string
+	for _, transition := range transitions {
+		got = append(got, [2]string{transition.FromStatus, transition.ToStatus})
+	}
+	want := [][2]string{{"", "pending"}, {"pending", "running"}, {"running", "terminated"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("transitions = %v, want %v", got, want)
+	}
+
+	if _, err := st.GetVM(ctx, "vm-2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get unknown vm = %v, want ErrNotFound", err)
+	}
+	if _, err := st.UpdateVMStatus(ctx, "vm-2", "running", "", "test"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("update unknown vm = %v, want ErrNotFound", err)
+	}
+}
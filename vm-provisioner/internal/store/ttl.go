@@ -0,0 +1,44 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"vm-provisioner/internal/models"
+)
+
+// SetVMExpiry sets or clears (nil) the auto-termination deadline of a VM.
+// Changing the deadline re-arms the pre-expiry warning.
+func (s *Store) SetVMExpiry(ctx context.Context, id string, expiresAt *time.Time) error {
+	result, err := s.exec(ctx, `UPDATE vms SET expires_at = ?, ttl_warned_at = NULL, updated_at = ?
+		WHERE id = ? AND deleted_at IS NULL`, nullTime(expiresAt), time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to set expiry of vm %s: %w", id, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("active vm %s: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// ListVMsToWarn returns live VMs whose deadline falls before the given time
+// and that have not been warned about it yet.
+func (s *Store) ListVMsToWarn(ctx context.Context, before time.Time) ([]models.VMRecord, error) {
+	return s.listVMs(ctx, `deleted_at IS NULL AND expires_at IS NOT NULL AND expires_at <= ?
+		AND ttl_warned_at IS NULL ORDER BY expires_at`, before.UTC())
+}
+
+// ListExpiredVMs returns live VMs whose deadline has passed.
+func (s *Store) ListExpiredVMs(ctx context.Context, now time.Time) ([]models.VMRecord, error) {
+	return s.listVMs(ctx, `deleted_at IS NULL AND expires_at IS NOT NULL AND expires_at <= ?
+		ORDER BY expires_at`, now.UTC())
+}
+
+// MarkTTLWarned records that the pre-expiry warning for a VM was emitted.
+func (s *Store) MarkTTLWarned(ctx context.Context, id string, at time.Time) error {
+	if _, err := s.exec(ctx, `UPDATE vms SET ttl_warned_at = ? WHERE id = ?`, at.UTC(), id); err != nil {
+		return fmt.Errorf("failed to mark vm %s as warned: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"vm-provisioner/internal/models"
+)
+
+const vmColumns = `id, provider, region, user_id, name, instance_type, image, use_spot_instance,
+	status, public_ip, ssh_username, created_at, updated_at, deleted_at, expires_at,
+	replace_on_interruption, interruption_reason, replaced_by, firewall, ttl_warned_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanVM(row rowScanner) (*models.VMRecord, error) {
+	var vm models.VMRecord
+	var deletedAt, expiresAt, ttlWarnedAt sql.NullTime
+	var firewall string
+	err := row.Scan(&vm.ID, &vm.Provider, &vm.Region, &vm.UserID, &vm.Name, &vm.InstanceType,
+		&vm.Image, &vm.UseSpotInstance, &vm.Status, &vm.PublicIP, &vm.SSHUsername,
+		&vm.CreatedAt, &vm.UpdatedAt, &deletedAt, &expiresAt,
+		&vm.ReplaceOnInterruption, &vm.InterruptionReason, &vm.ReplacedBy, &firewall, &ttlWarnedAt)
+	if err != nil {
+		return nil, err
+	}
+	if firewall != "" {
+		if err := json.Unmarshal([]byte(firewall), &vm.Firewall); err != nil {
+			return nil, fmt.Errorf("failed to decode firewall of vm %s: %w", vm.ID, err)
+		}
+	}
+	if deletedAt.Valid {
+		vm.DeletedAt = &deletedAt.Time
+	}
+	if expiresAt.Valid {
+		vm.ExpiresAt = &expiresAt.Time
+	}
+	if ttlWarnedAt.Valid {
+		vm.TTLWarnedAt = &ttlWarnedAt.Time
+	}
+	return &vm, nil
+}
+
+// CreateVM records a newly provisioned VM together with its initial transition.
+func (s *Store) CreateVM(ctx context.Context, vm *models.VMRecord) error {
+	now := time.Now().UTC()
+	if vm.CreatedAt.IsZero() {
+		vm.CreatedAt = now
+	}
+	vm.UpdatedAt = now
+
+	firewall, err := encodeFirewall(vm.Firewall)
+	if err != nil {
+		return fmt.Errorf("failed to encode firewall of vm %s: %w", vm.ID, err)
+	}
+
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO vms (`+vmColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULL, ?, ?, '', '', ?, ?)`),
+			vm.ID, vm.Provider, vm.Region, vm.UserID, vm.Name, vm.InstanceType, vm.Image,
+			vm.UseSpotInstance, vm.Status, vm.PublicIP, vm.SSHUsername, vm.CreatedAt.UTC(), vm.UpdatedAt,
+			nullTime(vm.ExpiresAt), vm.ReplaceOnInterruption, firewall, nullTime(vm.TTLWarnedAt))
+		if err != nil {
+			return fmt.Errorf("failed to insert vm %s: %w", vm.ID, err)
+		}
+		for key, value := range vm.Tags {
+			if _, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO vm_tags (vm_id, tag_key, tag_value) VALUES (?, ?, ?)`),
+				vm.ID, key, value); err != nil {
+				return fmt.Errorf("failed to insert tag %s of vm %s: %w", key, vm.ID, err)
+			}
+		}
+		if err := s.insertTransition(ctx, tx, vm.ID, "", vm.Status, "created", now); err != nil {
+			return err
+		}
+		_, err = s.insertStatusEvents(ctx, tx, vmChange{
+			id: vm.ID, userID: vm.UserID, name: vm.Name, toStatus: vm.Status, toIP: vm.PublicIP, reason: "created",
+		}, now)
+		return err
+	})
+	if err == nil {
+		s.eventsAppended()
+	}
+	return err
+}
+
+// GetVM returns the stored VM, including already terminated ones.
+func (s *Store) GetVM(ctx context.Context, id string) (*models.VMRecord, error) {
+	vm, err := scanVM(s.queryRow(ctx, `SELECT `+vmColumns+` FROM vms WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("vm %s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load vm %s: %w", id, err)
+	}
+	if vm.Tags, err = s.vmTags(ctx, id); err != nil {
+		return nil, err
+	}
+	return vm, nil
+}
+
+// UpdateVMStatus stores the latest observed status and IP of a VM. A
+// transition is recorded only when the status actually changed; the return
+// value reports whether it did.
+func (s *Store) UpdateVMStatus(ctx context.Context, id, status, publicIP, reason string) (bool, error) {
+	changed, recorded, firstRunning := false, false, false
+	var vm models.VMRecord
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		change := vmChange{id: id, toStatus: status, toIP: publicIP, reason: reason}
+		err := tx.QueryRowContext(ctx, s.rebind(`SELECT status, public_ip, user_id, name, provider, region, instance_type, created_at
+			FROM vms WHERE id = ?`), id).
+			Scan(&change.fromStatus, &change.fromIP, &change.userID, &change.name, &vm.Provider, &vm.Region, &vm.InstanceType, &vm.CreatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("vm %s: %w", id, ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		var deletedAt any
+		if status == "terminated" {
+			deletedAt = now
+		}
+		_, err = tx.ExecContext(ctx, s.rebind(`UPDATE vms
+			SET status = ?, public_ip = ?, updated_at = ?, deleted_at = COALESCE(deleted_at, ?)
+			WHERE id = ?`), status, publicIP, now, deletedAt, id)
+		if err != nil {
+			return err
+		}
+
+		// Volumes outlive the VM and become attachable elsewhere
+		if status == "terminated" {
+			_, err = tx.ExecContext(ctx, s.rebind(`UPDATE volumes SET status = ?, vm_id = '', mount_path = '', updated_at = ?
+				WHERE vm_id = ? AND deleted_at IS NULL`), models.VolumeAvailable, now, id)
+			if err != nil {
+				return err
+			}
+		}
+
+		n, err := s.insertStatusEvents(ctx, tx, change, now)
+		if err != nil {
+			return err
+		}
+		recorded = n > 0
+
+		if change.fromStatus == status {
+			return nil
+		}
+		changed = true
+
+		if status == "running" {
+			var runs int
+			err := tx.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM vm_transitions WHERE vm_id = ? AND to_status = ?`), id, status).
+				Scan(&runs)
+			if err != nil {
+				return err
+			}
+			firstRunning = runs == 0
+		}
+		return s.insertTransition(ctx, tx, id, change.fromStatus, status, reason, now)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to update vm %s: %w", id, err)
+	}
+	if recorded {
+		s.eventsAppended()
+	}
+	if firstRunning && s.onFirstRunning != nil {
+		vm.ID = id
+		s.onFirstRunning(vm, time.Since(vm.CreatedAt))
+	}
+	return changed, nil
+}
+
+// OnFirstRunning registers fn to be called when a VM is first seen running,
+// with the time since it was created. vm only carries the ID, provider,
+// region, instance type and creation time. It must be set before the store
+// is used concurrently.
+func (s *Store) OnFirstRunning(fn func(vm models.VMRecord, elapsed time.Duration)) {
+	s.onFirstRunning = fn
+}
+
+// ListTransitions returns the lifecycle history of a VM, oldest first.
+func (s *Store) ListTransitions(ctx context.Context, vmID string) ([]models.VMTransition, error) {
+	rows, err := s.query(ctx, `SELECT id, vm_id, from_status, to_status, reason, created_at
+		FROM vm_transitions WHERE vm_id = ? ORDER BY id`, vmID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transitions for vm %s: %w", vmID, err)
+	}
+	defer rows.Close()
+
+	var transitions []models.VMTransition
+	for rows.Next() {
+		var t models.VMTransition
+		if err := rows.Scan(&t.ID, &t.VMID, &t.FromStatus, &t.ToStatus, &t.Reason, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		transitions = append(transitions, t)
+	}
+	return transitions, rows.Err()
+}
+
+func (s *Store) insertTransition(ctx context.Context, tx *sql.Tx, vmID, from, to, reason string, at time.Time) error {
+	_, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO vm_transitions (vm_id, from_status, to_status, reason, created_at)
+		VALUES (?, ?, ?, ?, ?)`), vmID, from, to, reason, at)
+	return err
+}
+
+// RestoreVM clears the termination of a VM that turned out to be still
+// live, so it is listed and managed again. Its status is left to
+// UpdateVMStatus.
+func (s *Store) RestoreVM(ctx context.Context, id string) error {
+	result, err := s.exec(ctx, `UPDATE vms SET deleted_at = NULL, updated_at = ? WHERE id = ? AND deleted_at IS NOT NULL`,
+		time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to restore vm %s: %w", id, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("terminated vm %s: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// ListActiveVMs returns every VM that has not been terminated.
+func (s *Store) ListActiveVMs(ctx context.Context) ([]models.VMRecord, error) {
+	return s.listVMs(ctx, `deleted_at IS NULL ORDER BY created_at`)
+}
+
+// CountActiveVMs counts the VMs that have not been terminated by provider,
+// status and tier.
+func (s *Store) CountActiveVMs(ctx context.Context) ([]models.VMCount, error) {
+	rows, err := s.query(ctx, `SELECT v.provider, v.status, COALESCE(t.tag_value, ''), COUNT(*)
+		FROM vms v LEFT JOIN vm_tags t ON t.vm_id = v.id AND t.tag_key = ?
+		WHERE v.deleted_at IS NULL
+		GROUP BY v.provider, v.status, t.tag_value`, models.TierTag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count vms: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []models.VMCount
+	for rows.Next() {
+		var count models.VMCount
+		if err := rows.Scan(&count.Provider, &count.Status, &count.Tier, &count.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+func (s *Store) listVMs(ctx context.Context, where string, args ...any) ([]models.VMRecord, error) {
+	rows, err := s.query(ctx, `SELECT `+vmColumns+` FROM vms WHERE `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list vms: %w", err)
+	}
+	defer rows.Close()
+
+	var vms []models.VMRecord
+	for rows.Next() {
+		vm, err := scanVM(rows)
+		if err != nil {
+			return nil, err
+		}
+		vms = append(vms, *vm)
+	}
+	return vms, rows.Err()
+}
+
+// nullTime converts an optional timestamp into a UTC driver value.
+func nullTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
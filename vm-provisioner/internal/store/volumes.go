@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"vm-provisioner/internal/models"
+)
+
+const volumeColumns = `id, provider, region, availability_zone, user_id, name, size_gib, status,
+	vm_id, mount_path, created_at, updated_at, deleted_at`
+
+func scanVolume(row rowScanner) (*models.Volume, error) {
+	var v models.Volume
+	var deletedAt sql.NullTime
+	err := row.Scan(&v.ID, &v.Provider, &v.Region, &v.AvailabilityZone, &v.UserID, &v.Name, &v.SizeGiB,
+		&v.Status, &v.VMID, &v.MountPath, &v.CreatedAt, &v.UpdatedAt, &deletedAt)
+	if err != nil {
+		return nil, err
+	}
+	if deletedAt.Valid {
+		v.DeletedAt = &deletedAt.Time
+	}
+	return &v, nil
+}
+
+// CreateVolume records a volume the provider just created.
+func (s *Store) CreateVolume(ctx context.Context, v *models.Volume) error {
+	now := time.Now().UTC()
+	if v.CreatedAt.IsZero() {
+		v.CreatedAt = now
+	}
+	v.UpdatedAt = now
+
+	_, err := s.exec(ctx, `INSERT INTO volumes (`+volumeColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULL)`,
+		v.ID, v.Provider, v.Region, v.AvailabilityZone, v.UserID, v.Name, v.SizeGiB, v.Status,
+		v.VMID, v.MountPath, v.CreatedAt.UTC(), v.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert volume %s: %w", v.ID, err)
+	}
+	return nil
+}
+
+// GetVolume returns a volume that has not been deleted.
+func (s *Store) GetVolume(ctx context.Context, id string) (*models.Volume, error) {
+	v, err := scanVolume(s.queryRow(ctx, `SELECT `+volumeColumns+` FROM volumes WHERE id = ? AND deleted_at IS NULL`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("volume %s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load volume %s: %w", id, err)
+	}
+	return v, nil
+}
+
+// ListVolumes returns the volumes of a user that have not been deleted,
+// oldest first. An empty userID lists every user's volumes.
+func (s *Store) ListVolumes(ctx context.Context, userID string) ([]models.Volume, error) {
+	where, args := `deleted_at IS NULL`, []any{}
+	if userID != "" {
+		where, args = where+` AND user_id = ?`, append(args, userID)
+	}
+	rows, err := s.query(ctx, `SELECT `+volumeColumns+` FROM volumes WHERE `+where+` ORDER BY created_at`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
+	}
+	defer rows.Close()
+
+	var volumes []models.Volume
+	for rows.Next() {
+		v, err := scanVolume(rows)
+		if err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, *v)
+	}
+	return volumes, rows.Err()
+}
+
+// SetVolumeAttachment records the VM a volume is attached to and where it
+// is mounted. An empty vmID marks the volume detached.
+func (s *Store) SetVolumeAttachment(ctx context.Context, id, vmID, mountPath string) error {
+	status := models.VolumeAttached
+	if vmID == "" {
+		status, mountPath = models.VolumeAvailable, ""
+	}
+	result, err := s.exec(ctx, `UPDATE volumes SET status = ?, vm_id = ?, mount_path = ?, updated_at = ?
+		WHERE id = ? AND deleted_at IS NULL`, status, vmID, mountPath, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to update attachment of volume %s: %w", id, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("volume %s: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// AttachVolumes records the volumes a VM was created with.
+func (s *Store) AttachVolumes(ctx context.Context, vmID string, mounts []models.VolumeMount) error {
+	for _, mount := range mounts {
+		if err := s.SetVolumeAttachment(ctx, mount.VolumeID, vmID, mount.MountPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarkVolumeDeleted records that the provider deleted a volume.
+func (s *Store) MarkVolumeDeleted(ctx context.Context, id string) error {
+	now := time.Now().UTC()
+	_, err := s.exec(ctx, `UPDATE volumes SET status = ?, vm_id = '', mount_path = '', updated_at = ?, deleted_at = ?
+		WHERE id = ? AND deleted_at IS NULL`, models.VolumeDeleted, now, now, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark volume %s deleted: %w", id, err)
+	}
+	return nil
+}
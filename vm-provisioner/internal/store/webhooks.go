@@ -0,0 +1,277 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"vm-provisioner/internal/models"
+)
+
+const webhookColumns = `id, user_id, url, events, secret, created_at`
+
+const deliveryColumns = `id, webhook_id, event_id, event_type, status, attempts, last_error,
+	response_status, next_attempt_at, created_at, delivered_at`
+
+func scanWebhook(row rowScanner) (*models.Webhook, error) {
+	var w models.Webhook
+	var events string
+	if err := row.Scan(&w.ID, &w.UserID, &w.URL, &events, &w.Secret, &w.CreatedAt); err != nil {
+		return nil, err
+	}
+	w.Events = strings.Split(events, ",")
+	return &w, nil
+}
+
+func scanDelivery(row rowScanner) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var deliveredAt sql.NullTime
+	err := row.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Status, &d.Attempts, &d.LastError,
+		&d.ResponseStatus, &d.NextAttemptAt, &d.CreatedAt, &deliveredAt)
+	if err != nil {
+		return nil, err
+	}
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+	return &d, nil
+}
+
+// CreateWebhook stores a new webhook subscription.
+func (s *Store) CreateWebhook(ctx context.Context, w *models.Webhook) error {
+	if w.CreatedAt.IsZero() {
+		w.CreatedAt = time.Now().UTC()
+	}
+	_, err := s.exec(ctx, `INSERT INTO webhooks (`+webhookColumns+`) VALUES (?, ?, ?, ?, ?, ?)`,
+		w.ID, w.UserID, w.URL, strings.Join(w.Events, ","), w.Secret, w.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to create webhook %s: %w", w.ID, err)
+	}
+	return nil
+}
+
+// GetWebhook returns a webhook that has not been deleted, including its secret.
+func (s *Store) GetWebhook(ctx context.Context, id string) (*models.Webhook, error) {
+	w, err := scanWebhook(s.queryRow(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE id = ? AND deleted_at IS NULL`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("webhook %s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load webhook %s: %w", id, err)
+	}
+	return w, nil
+}
+
+// ListWebhooks returns every webhook that has not been deleted, oldest first.
+func (s *Store) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	rows, err := s.query(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE deleted_at IS NULL ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var webhooks []models.Webhook
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *w)
+	}
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook deletes a webhook and drops its pending deliveries. The
+// delivery log of the webhook is kept.
+func (s *Store) DeleteWebhook(ctx context.Context, id string) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, s.rebind(`UPDATE webhooks SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`),
+			time.Now().UTC(), id)
+		if err != nil {
+			return fmt.Errorf("failed to delete webhook %s: %w", id, err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return fmt.Errorf("webhook %s: %w", id, ErrNotFound)
+		}
+		_, err = tx.ExecContext(ctx, s.rebind(`DELETE FROM webhook_deliveries WHERE webhook_id = ? AND status = ?`),
+			id, models.DeliveryPending)
+		return err
+	})
+}
+
+// QueueWebhookDeliveries fans out up to limit events from the event log,
+// following the last one fanned out before, into deliveries for the
+// webhooks that subscribed to them. It returns how many events it consumed.
+// Concurrent callers never queue an event twice: only one of them advances
+// the cursor, the others roll back and consume nothing. The cursor stops
+// before gaps in the event IDs that may still fill (see eventSettleWindow).
+func (s *Store) QueueWebhookDeliveries(ctx context.Context, limit int) (int, error) {
+	webhooks, err := s.ListWebhooks(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	consumed := 0
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		var cursor int64
+		if err := tx.QueryRowContext(ctx, `SELECT last_event_id FROM webhook_cursor WHERE id = 1`).Scan(&cursor); err != nil {
+			return fmt.Errorf("failed to read webhook cursor: %w", err)
+		}
+
+		before, err := s.unsettledEventID(ctx, tx, cursor)
+		if err != nil {
+			return err
+		}
+		rows, err := tx.QueryContext(ctx, s.rebind(`SELECT id, vm_id, user_id, type, message, data, created_at
+			FROM vm_events WHERE id > ? AND id < ? ORDER BY id LIMIT ?`), cursor, before, limit)
+		if err != nil {
+			return fmt.Errorf("failed to list events after %d: %w", cursor, err)
+		}
+		events, err := scanEvents(rows)
+		rows.Close()
+		if err != nil || len(events) == 0 {
+			return err
+		}
+
+		now := time.Now().UTC()
+		for _, event := range events {
+			for _, eventType := range models.WebhookEventTypes(event) {
+				for _, w := range webhooks {
+					if !w.Wants(eventType, event.UserID) {
+						continue
+					}
+					_, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO webhook_deliveries
+						(webhook_id, event_id, event_type, status, next_attempt_at, created_at)
+						VALUES (?, ?, ?, ?, ?, ?)`), w.ID, event.ID, eventType, models.DeliveryPending, now, now)
+					if err != nil {
+						return fmt.Errorf("failed to queue %s for webhook %s: %w", eventType, w.ID, err)
+					}
+				}
+			}
+		}
+
+		last := events[len(events)-1].ID
+		result, err := tx.ExecContext(ctx, s.rebind(`UPDATE webhook_cursor SET last_event_id = ? WHERE id = 1 AND last_event_id = ?`),
+			last, cursor)
+		if err != nil {
+			return fmt.Errorf("failed to advance webhook cursor: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return errCursorMoved
+		}
+		consumed = len(events)
+		return nil
+	})
+	if errors.Is(err, errCursorMoved) {
+		return 0, nil
+	}
+	return consumed, err
+}
+
+// errCursorMoved rolls back a fan-out another instance completed first.
+var errCursorMoved = errors.New("webhook cursor moved")
+
+// DueWebhookDeliveries returns up to limit pending deliveries whose next
+// attempt is due, oldest first.
+func (s *Store) DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	return s.listDeliveries(ctx, `status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?`,
+		models.DeliveryPending, now.UTC(), limit)
+}
+
+// ListWebhookDeliveries returns the newest deliveries of a webhook, with
+// the given status if it is not empty.
+func (s *Store) ListWebhookDeliveries(ctx context.Context, webhookID, status string, limit int) ([]models.WebhookDelivery, error) {
+	return s.listDeliveries(ctx, `webhook_id = ? AND (? = '' OR status = ?) ORDER BY id DESC LIMIT ?`,
+		webhookID, status, status, limit)
+}
+
+func (s *Store) listDeliveries(ctx context.Context, where string, args ...any) ([]models.WebhookDelivery, error) {
+	rows, err := s.query(ctx, `SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, rows.Err()
+}
+
+// GetWebhookDelivery returns a single delivery.
+func (s *Store) GetWebhookDelivery(ctx context.Context, id int64) (*models.WebhookDelivery, error) {
+	d, err := scanDelivery(s.queryRow(ctx, `SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("webhook delivery %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load webhook delivery %d: %w", id, err)
+	}
+	return d, nil
+}
+
+// ClaimWebhookDelivery counts an attempt of a due delivery and pushes its
+// next attempt out to leaseUntil, so no other instance sends it meanwhile.
+// It reports false if the delivery was already claimed.
+func (s *Store) ClaimWebhookDelivery(ctx context.Context, d *models.WebhookDelivery, leaseUntil time.Time) (bool, error) {
+	result, err := s.exec(ctx, `UPDATE webhook_deliveries SET attempts = attempts + 1, next_attempt_at = ?
+		WHERE id = ? AND status = ? AND attempts = ?`, leaseUntil.UTC(), d.ID, models.DeliveryPending, d.Attempts)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim webhook delivery %d: %w", d.ID, err)
+	}
+	n, _ := result.RowsAffected()
+	if n > 0 {
+		d.Attempts++
+	}
+	return n > 0, nil
+}
+
+// CompleteWebhookDelivery records a successful attempt.
+func (s *Store) CompleteWebhookDelivery(ctx context.Context, id int64, responseStatus int) error {
+	_, err := s.exec(ctx, `UPDATE webhook_deliveries SET status = ?, response_status = ?, last_error = '', delivered_at = ?
+		WHERE id = ?`, models.DeliveryDelivered, responseStatus, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to complete webhook delivery %d: %w", id, err)
+	}
+	return nil
+}
+
+// FailWebhookDelivery records a failed attempt. The delivery is retried at
+// nextAttempt, or moved to the dead-letter log if nextAttempt is nil.
+func (s *Store) FailWebhookDelivery(ctx context.Context, id int64, responseStatus int, lastError string, nextAttempt *time.Time) error {
+	status := models.DeliveryPending
+	next := time.Now().UTC()
+	if nextAttempt != nil {
+		next = nextAttempt.UTC()
+	} else {
+		status = models.DeliveryDead
+	}
+	_, err := s.exec(ctx, `UPDATE webhook_deliveries SET status = ?, response_status = ?, last_error = ?, next_attempt_at = ?
+		WHERE id = ?`, status, responseStatus, lastError, next, id)
+	if err != nil {
+		return fmt.Errorf("failed to record failed webhook delivery %d: %w", id, err)
+	}
+	return nil
+}
+
+// RedeliverWebhookDelivery moves a dead delivery back into the queue with
+// a fresh set of attempts.
+func (s *Store) RedeliverWebhookDelivery(ctx context.Context, id int64) error {
+	result, err := s.exec(ctx, `UPDATE webhook_deliveries SET status = ?, attempts = 0, next_attempt_at = ?
+		WHERE id = ? AND status = ?`, models.DeliveryPending, time.Now().UTC(), id, models.DeliveryDead)
+	if err != nil {
+		return fmt.Errorf("failed to redeliver webhook delivery %d: %w", id, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("dead webhook delivery %d: %w", id, ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"vm-provisioner/internal/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans installs a tracer provider recording every span until the
+// test ends.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestEnd(t *testing.T) {
+	recorder := recordSpans(t)
+
+	for _, err := range []error{nil, errors.New("quota exceeded")} {
+		_, span := Start(context.Background(), "call")
+		End(span, &err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("ended %d spans, want 2", len(spans))
+	}
+	if status := spans[0].Status(); status.Code != codes.Unset {
+		t.Errorf("successful call has status %v", status)
+	}
+	if status := spans[1].Status(); status.Code != codes.Error || status.Description != "quota exceeded" {
+		t.Errorf("failed call has status %v, want the error", status)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	recorder := recordSpans(t)
+	// Installs the trace-context propagator the transport must not use
+	if _, err := Setup(context.Background(), config.TracingConfig{}); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer srv.Close()
+
+	ctx, parent := Start(context.Background(), "operation")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/v1/servers/4711/actions/poweroff", nil)
+	resp, err := (&http.Client{Transport: Transport(http.DefaultTransport)}).Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+	parent.End()
+
+	if traceparent != "" {
+		t.Errorf("trace context was sent to the API: %s", traceparent)
+	}
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("ended %d spans, want 2", len(spans))
+	}
+	call := spans[0]
+	if want := "POST " + strings.TrimPrefix(srv.URL, "http://") + "/v1/servers/{id}/actions/poweroff"; call.Name() != want {
+		t.Errorf("span name = %s, want %s", call.Name(), want)
+	}
+	if call.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("API call is not traced as a child of the calling span")
+	}
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// safeKeyComment matches comments that can be embedded in shell scripts as is
+var safeKeyComment = regexp.MustCompile(`^[A-Za-z0-9@._+-]+$`)
+
+// ParseSSHPublicKey validates an authorized_keys style public key and returns
+// it in canonical form together with its SHA256 fingerprint. Comments that
+// are not shell-safe are dropped, so the result can be written by cloud-init.
+func ParseSSHPublicKey(key string) (normalized, fingerprint string, err error) {
+	key = strings.TrimSpace(key)
+	if key == "" || strings.ContainsAny(key, "\r\n") {
+		return "", "", fmt.Errorf("SSH public key must be a single line")
+	}
+
+	pub, comment, options, _, err := ssh.ParseAuthorizedKey([]byte(key))
+	if err != nil {
+		return "", "", fmt.Errorf("invalid SSH public key: %w", err)
+	}
+	if len(options) > 0 {
+		return "", "", fmt.Errorf("SSH public key must not carry authorized_keys options")
+	}
+
+	normalized = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+	if safeKeyComment.MatchString(comment) {
+		normalized += " " + comment
+	}
+	return normalized, ssh.FingerprintSHA256(pub), nil
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"math/big"
 )
 
@@ -22,4 +23,18 @@ func GenerateRandomPassword(length int) string {
 // EncodeBase64 encodes a string to base64
 func EncodeBase64(data string) string {
 	return base64.StdEncoding.EncodeToString([]byte(data))
-}
\ No newline at end of file
+}
+
+// GenerateID returns a random identifier with the given prefix, e.g. "key_3f9a..."
+func GenerateID(prefix string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return prefix + "_" + hex.EncodeToString(b)
+}
+
+// GenerateSecret returns a random 256-bit secret, hex encoded
+func GenerateSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
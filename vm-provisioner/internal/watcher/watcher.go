@@ -0,0 +1,124 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/logging"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/store"
+)
+
+// Watcher polls the providers for the status of every live VM, one batched
+// call per provider and region. The store records changes it observes as
+// events, which the event stream pushes to subscribers, so clients do not
+// have to poll each VM themselves.
+type Watcher struct {
+	store     *store.Store
+	providers map[string]models.CloudProvider
+	cfg       config.WatcherConfig
+	timeout   time.Duration
+}
+
+func New(st *store.Store, providers map[string]models.CloudProvider, cfg config.WatcherConfig, statusTimeout time.Duration) *Watcher {
+	return &Watcher{
+		store:     st,
+		providers: providers,
+		cfg:       cfg,
+		timeout:   statusTimeout,
+	}
+}
+
+// Run checks immediately and then on every interval until ctx is canceled.
+func (w *Watcher) Run(ctx context.Context) {
+	slog.Info("Status watcher started", "interval", w.cfg.Interval)
+
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		w.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check refreshes the status of every live VM once.
+func (w *Watcher) Check(ctx context.Context) {
+	vms, err := w.store.ListActiveVMs(ctx)
+	if err != nil {
+		slog.Error("Status watcher failed to list VMs", "error", err)
+		return
+	}
+
+	lookup := func(name string) (models.CloudProvider, error) {
+		provider := w.providers[name]
+		if provider == nil {
+			return nil, fmt.Errorf("provider %s is not available", name)
+		}
+		return provider, nil
+	}
+	Refresh(ctx, w.store, lookup, vms, w.timeout)
+}
+
+// Refresh updates the live VMs in place with their provider status, making
+// one batched call per provider and region, and records what changed. VMs of
+// groups that fail keep their stored status; the failures are returned.
+func Refresh(ctx context.Context, st *store.Store, lookup func(name string) (models.CloudProvider, error), vms []models.VMRecord, timeout time.Duration) []string {
+	type group struct{ provider, region string }
+	groups := map[group][]int{}
+	for i, vm := range vms {
+		if vm.DeletedAt == nil {
+			g := group{vm.Provider, vm.Region}
+			groups[g] = append(groups[g], i)
+		}
+	}
+
+	var failures []string
+	for g, indexes := range groups {
+		provider, err := lookup(g.provider)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s %s: %v", g.provider, g.region, err))
+			continue
+		}
+
+		ids := make([]string, len(indexes))
+		for i, index := range indexes {
+			ids[i] = vms[index].ID
+		}
+
+		statusCtx, cancel := context.WithTimeout(ctx, timeout)
+		statuses, err := provider.GetVMStatuses(statusCtx, g.region, ids)
+		cancel()
+		if err != nil {
+			logging.FromContext(ctx).Error("Failed to refresh VMs", "provider", g.provider, "region", g.region, "error", err)
+			failures = append(failures, fmt.Sprintf("%s %s: %v", g.provider, g.region, err))
+			continue
+		}
+
+		byID := make(map[string]models.VMStatus, len(statuses))
+		for _, status := range statuses {
+			byID[status.ID] = status
+		}
+		for _, index := range indexes {
+			vm := &vms[index]
+			status, ok := byID[vm.ID]
+			if !ok {
+				continue // gone at the provider; the reconciler reports it as missing
+			}
+			if _, err := st.UpdateVMStatus(ctx, vm.ID, status.Status, status.PublicIP, "observed"); err != nil {
+				logging.FromContext(ctx).Error("Failed to record status of VM", "vm_id", vm.ID, "error", err)
+			}
+			vm.Status = status.Status
+			vm.PublicIP = status.PublicIP
+			vm.UpdatedAt = status.UpdatedAt
+		}
+	}
+	return failures
+}
@@ -0,0 +1,246 @@
+// Package webhooks POSTs VM lifecycle events to subscribed URLs. Events are
+// fanned out from the store's event log into persisted deliveries, so none
+// are lost across restarts, and failed deliveries are retried with
+// exponential backoff until they land in the dead-letter log.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"vm-provisioner/internal/auth"
+	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/events"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/store"
+)
+
+const (
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the
+	// timestamp header, a dot and the body, keyed with the webhook secret
+	SignatureHeader = "X-Wolkenlauf-Signature"
+	EventHeader     = "X-Wolkenlauf-Event"
+	DeliveryHeader  = "X-Wolkenlauf-Delivery"
+
+	batchSize = 100
+	// workers is how many deliveries are attempted concurrently
+	workers = 4
+	// maxRetryBackoff caps the delay between two attempts
+	maxRetryBackoff = time.Hour
+)
+
+// Payload is the JSON body of a webhook request.
+type Payload struct {
+	DeliveryID int64          `json:"deliveryId"`
+	Type       string         `json:"type"`
+	EventID    int64          `json:"eventId"`
+	VMID       string         `json:"vmId"`
+	UserID     string         `json:"userId,omitempty"`
+	Message    string         `json:"message,omitempty"`
+	Data       map[string]any `json:"data,omitempty"`
+	CreatedAt  time.Time      `json:"createdAt"`
+}
+
+// Sign returns the signature header value of a request body.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher queues deliveries for new events and attempts due ones,
+// whenever events are recorded and on every interval.
+type Dispatcher struct {
+	store  *store.Store
+	bus    *events.Bus
+	cfg    config.WebhookConfig
+	client *http.Client
+}
+
+func New(st *store.Store, bus *events.Bus, cfg config.WebhookConfig) *Dispatcher {
+	return &Dispatcher{
+		store: st,
+		bus:   bus,
+		cfg:   cfg,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			// A redirect is a misconfigured URL, not a delivery
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+}
+
+// Run dispatches immediately, then on every new event and interval until
+// ctx is canceled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	slog.Info("Webhook dispatcher started", "interval", d.cfg.Interval, "max_attempts", d.cfg.MaxAttempts)
+
+	signal, unsubscribe := d.bus.Subscribe()
+	defer unsubscribe()
+
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		d.Dispatch(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-signal:
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dispatch queues deliveries for the events recorded since the last call
+// and attempts every due delivery once.
+func (d *Dispatcher) Dispatch(ctx context.Context) {
+	for {
+		n, err := d.store.QueueWebhookDeliveries(ctx, batchSize)
+		if err != nil {
+			slog.Error("Failed to queue webhook deliveries", "error", err)
+			break
+		}
+		if n < batchSize {
+			break
+		}
+	}
+
+	due, err := d.store.DueWebhookDeliveries(ctx, time.Now(), batchSize)
+	if err != nil {
+		slog.Error("Failed to list due webhook deliveries", "error", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	queue := make(chan models.WebhookDelivery)
+	for range min(workers, len(due)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for delivery := range queue {
+				d.deliver(ctx, delivery)
+			}
+		}()
+	}
+	for _, delivery := range due {
+		queue <- delivery
+	}
+	close(queue)
+	wg.Wait()
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery models.WebhookDelivery) {
+	logger := slog.With("webhook_id", delivery.WebhookID, "delivery_id", delivery.ID, "event", delivery.EventType)
+
+	// Keep other instances off the delivery while it is attempted
+	claimed, err := d.store.ClaimWebhookDelivery(ctx, &delivery, time.Now().Add(2*d.cfg.Timeout))
+	if err != nil || !claimed {
+		if err != nil {
+			logger.Error("Failed to claim webhook delivery", "error", err)
+		}
+		return
+	}
+
+	webhook, err := d.store.GetWebhook(ctx, delivery.WebhookID)
+	if errors.Is(err, store.ErrNotFound) {
+		return // deleted meanwhile; its pending deliveries are gone too
+	}
+	if err != nil {
+		logger.Error("Failed to load webhook", "error", err)
+		return
+	}
+	event, err := d.store.GetEvent(ctx, delivery.EventID)
+	if err != nil {
+		logger.Error("Failed to load event of webhook delivery", "event_id", delivery.EventID, "error", err)
+		return
+	}
+
+	status, err := d.post(ctx, webhook, delivery, event)
+	if err == nil {
+		if err := d.store.CompleteWebhookDelivery(ctx, delivery.ID, status); err != nil {
+			logger.Error("Failed to record webhook delivery", "error", err)
+		}
+		return
+	}
+
+	var next *time.Time
+	if delivery.Attempts < d.cfg.MaxAttempts {
+		at := time.Now().Add(backoff(d.cfg.RetryBackoff, delivery.Attempts))
+		next = &at
+		logger.Warn("Webhook delivery failed", "url", webhook.URL,
+			"attempt", delivery.Attempts, "max_attempts", d.cfg.MaxAttempts, "next_attempt_at", at, "error", err)
+	} else {
+		logger.Error("Webhook delivery failed, moved to dead-letter log", "url", webhook.URL,
+			"attempts", delivery.Attempts, "error", err)
+	}
+	if err := d.store.FailWebhookDelivery(ctx, delivery.ID, status, err.Error(), next); err != nil {
+		logger.Error("Failed to record failed webhook delivery", "error", err)
+	}
+}
+
+// post sends one signed attempt and returns the response status. Anything
+// but a 2xx response is an error.
+func (d *Dispatcher) post(ctx context.Context, webhook *models.Webhook, delivery models.WebhookDelivery, event *models.VMEvent) (int, error) {
+	body, err := json.Marshal(Payload{
+		DeliveryID: delivery.ID,
+		Type:       delivery.EventType,
+		EventID:    event.ID,
+		VMID:       event.VMID,
+		UserID:     event.UserID,
+		Message:    event.Message,
+		Data:       event.Data,
+		CreatedAt:  event.CreatedAt,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "wolkenlauf-webhooks")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(auth.TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return resp.StatusCode, fmt.Errorf("HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(snippet))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+// backoff doubles the delay after every failed attempt, up to
+// maxRetryBackoff.
+func backoff(base time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryBackoff)
+}
@@ -0,0 +1,58 @@
+package webhooks
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	const (
+		secret    = "whsec_test"
+		timestamp = "1700000000"
+		body      = `{"type":"vm.created"}`
+	)
+	// printf '1700000000.{"type":"vm.created"}' | openssl dgst -sha256 -hmac whsec_test
+	want := "sha256=6fefd855b9c604397b5967ea058d81da61c58eb76fdb15466b270c5595242238"
+
+	tests := []struct {
+		name                    string
+		secret, timestamp, body string
+		wantMatch               bool
+	}{
+		{"same input", secret, timestamp, body, true},
+		{"other secret", "whsec_other", timestamp, body, false},
+		{"other timestamp", secret, "1700000001", body, false},
+		{"other body", secret, timestamp, `{"type":"vm.deleted"}`, false},
+		{"timestamp moved into the body", secret, "170000000", "0." + body, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Sign(tt.secret, tt.timestamp, []byte(tt.body))
+			if (got == want) != tt.wantMatch {
+				t.Errorf("Sign = %s, match with %s = %v, want %v", got, want, got == want, tt.wantMatch)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		base     time.Duration
+		attempts int
+		want     time.Duration
+	}{
+		{time.Minute, 0, time.Minute},
+		{time.Minute, 1, time.Minute},
+		{time.Minute, 2, 2 * time.Minute},
+		{time.Minute, 4, 8 * time.Minute},
+		{time.Minute, 7, maxRetryBackoff},
+		{time.Minute, 1000, maxRetryBackoff},
+		{2 * time.Hour, 1, maxRetryBackoff},
+		{10 * time.Second, 3, 40 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.base, tt.attempts); got != tt.want {
+			t.Errorf("backoff(%v, %d) = %v, want %v", tt.base, tt.attempts, got, tt.want)
+		}
+	}
+}
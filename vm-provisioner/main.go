@@ -1,72 +1,244 @@
 package main
 
 import (
-	"log"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"vm-provisioner/internal/auth"
+	"vm-provisioner/internal/catalog"
 	"vm-provisioner/internal/config"
+	"vm-provisioner/internal/events"
 	"vm-provisioner/internal/handlers"
+	"vm-provisioner/internal/logging"
+	"vm-provisioner/internal/metrics"
+	"vm-provisioner/internal/middleware"
+	"vm-provisioner/internal/models"
+	"vm-provisioner/internal/operations"
 	"vm-provisioner/internal/providers"
+	"vm-provisioner/internal/reaper"
+	"vm-provisioner/internal/reconciler"
+	"vm-provisioner/internal/retention"
+	"vm-provisioner/internal/spot"
+	"vm-provisioner/internal/store"
+	"vm-provisioner/internal/tracing"
+	"vm-provisioner/internal/watcher"
+	"vm-provisioner/internal/webhooks"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
 
 func main() {
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Printf("Warning: .env file not found, using environment variables")
+	if err := run(); err != nil {
+		slog.Error("VM Provisioner failed", "error", err)
+		os.Exit(1)
 	}
+}
+
+// run serves until SIGINT or SIGTERM. Errors are returned rather than
+// exiting, so that deferred cleanup such as flushing spans always runs.
+func run() error {
+	// Load environment variables
+	envErr := godotenv.Load()
 
 	// Load configuration
 	cfg := config.Load()
 
-	// Initialize cloud providers
-	awsProvider, err := providers.NewAWSProvider(cfg.AWS)
+	// Structured logs with secrets masked; the standard logger goes through it too
+	slog.SetDefault(logging.New(cfg.Log))
+	if envErr != nil {
+		slog.Warn(".env file not found, using environment variables")
+	}
+
+	// SIGINT/SIGTERM stop the background workers and shut the server down
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Export spans over OTLP when an endpoint is configured
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
 	if err != nil {
-		log.Fatalf("Failed to initialize AWS provider: %v", err)
+		return fmt.Errorf("failed to set up tracing: %w", err)
 	}
+	// Flush buffered spans last, after everything that records them stopped
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("Failed to flush spans", "error", err)
+		}
+	}()
 
-	hetznerProvider, err := providers.NewHetznerProvider(cfg.Hetzner)
+	// Open the VM state store
+	st, err := store.Open(ctx, cfg.Store)
 	if err != nil {
-		log.Fatalf("Failed to initialize Hetzner provider: %v", err)
+		return fmt.Errorf("failed to open state store: %w", err)
+	}
+	defer st.Close()
+
+	// Start the enabled cloud providers; misconfigured ones run degraded
+	registry := providers.NewRegistry(cfg)
+	cloudProviders := registry.Available()
+	bus := events.NewBus(st)
+
+	// Prometheus metrics; active VMs are counted from the store on scrape
+	st.OnFirstRunning(metrics.ObserveTimeToRunning)
+	metrics.RegisterActiveVMs(st)
+
+	// Enforce AutoTerminateMinutes server-side
+	go reaper.New(st, bus, cloudProviders, cfg.Reaper, cfg.Timeouts.Delete).Run(ctx)
+
+	// Diff tagged cloud resources against the store
+	rec := reconciler.New(st, cloudProviders, cfg.Reconciler, cfg.Timeouts.Delete)
+	go rec.Run(ctx)
+
+	// Execute mutating requests in the background. The workers outlive the
+	// HTTP server, so requests accepted during shutdown still get an outcome.
+	workCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	ops := operations.NewManager(st, cfg.Operations)
+	if err := ops.Start(workCtx); err != nil {
+		return fmt.Errorf("failed to start operation workers: %w", err)
 	}
 
+	// Track status changes of live VMs for the event stream
+	go watcher.New(st, cloudProviders, cfg.Watcher, cfg.Timeouts.Status).Run(ctx)
+
+	// POST lifecycle events to subscribed webhooks
+	go webhooks.New(st, bus, cfg.Webhooks).Run(ctx)
+
+	// Delete snapshots outside their owner's retention policy
+	go retention.New(st, cloudProviders, cfg.Snapshots, cfg.Timeouts.Delete).Run(ctx)
+
+	// Notice spot interruptions and relaunch VMs that asked for it
+	go spot.New(st, bus, ops, cloudProviders, cfg.Spot, cfg.Timeouts).Run(ctx)
+
+	// Instance types with specs and prices, cached per provider and region
+	cat := catalog.New(registry, cfg.Catalog)
+
 	// Initialize handlers
-	handler := handlers.NewVMHandler(awsProvider, hetznerProvider)
+	handler := handlers.NewVMHandler(registry, st, ops, cfg)
+	operationHandler := handlers.NewOperationHandler(st, ops)
+	eventHandler := handlers.NewEventHandler(st, bus)
+	reconcileHandler := handlers.NewReconcileHandler(rec)
+	sshKeyHandler := handlers.NewSSHKeyHandler(st)
+	volumeHandler := handlers.NewVolumeHandler(registry, st, ops, cfg.Timeouts)
+	snapshotHandler := handlers.NewSnapshotHandler(registry, st, ops, cfg)
+	providerHandler := handlers.NewProviderHandler(registry)
+	catalogHandler := handlers.NewCatalogHandler(cat)
+	webhookHandler := handlers.NewWebhookHandler(st)
+	apiKeyHandler := handlers.NewAPIKeyHandler(st, cfg.Auth.RotationGrace)
+	authenticator := auth.New(st, cfg.Auth)
 
 	// Setup Gin router
-	r := gin.Default()
-
-	// Add CORS middleware
-	r.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-		c.Next()
-	})
+	r := gin.New()
+	r.Use(gin.Recovery())
+
+	// Request IDs and one structured log line per request
+	r.Use(middleware.RequestLogger())
+
+	// One span per request, continuing the caller's W3C trace context
+	r.Use(middleware.Tracing())
+
+	// Only allowlisted browser origins get CORS headers
+	r.Use(middleware.CORS(cfg.CORS))
 
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "healthy"})
 	})
 
-	// Debug endpoint
-	r.POST("/debug", func(c *gin.Context) {
+	// Everything else requires an API key
+	api := r.Group("", authenticator.Authenticate())
+
+	// Debug endpoint; echoes the body with secrets masked
+	api.POST("/debug", auth.Require(models.ScopeAdmin), func(c *gin.Context) {
 		body, _ := c.GetRawData()
-		log.Printf("🐛 Raw request body: %s", string(body))
-		c.JSON(200, gin.H{"received": string(body)})
+		var received any = logging.Scrub(string(body))
+		var decoded any
+		if json.Unmarshal(body, &decoded) == nil {
+			received = logging.Redact(decoded)
+		}
+		logging.FromContext(c.Request.Context()).Debug("Debug request body", "body", received)
+		c.JSON(200, gin.H{"received": received})
 	})
 
+	// Prometheus metrics, for scrapers with a metrics-scoped key
+	api.GET("/metrics", auth.Require(models.ScopeMetrics), gin.WrapH(metrics.Handler()))
+
+	// Cloud providers and their capabilities
+	api.GET("/providers", auth.Require(models.ScopeRead), providerHandler.ListProviders)
+
+	// Instance type catalog
+	api.GET("/catalog", auth.Require(models.ScopeRead), catalogHandler.ListInstanceTypes)
+	api.POST("/vm/estimate", auth.Require(models.ScopeRead), catalogHandler.EstimateCost)
+
 	// VM management endpoints
-	r.POST("/vm/create", handler.CreateVM)
-	r.DELETE("/vm/:id", handler.DeleteVM)
-	r.GET("/vm/:id/status", handler.GetVMStatus)
+	api.POST("/vm/create", auth.Require(models.ScopeCreate), handler.CreateVM)
+	api.GET("/vm", auth.Require(models.ScopeRead), handler.ListVMs)
+	api.GET("/vm/:id", auth.Require(models.ScopeRead), handler.GetVM)
+	api.DELETE("/vm/:id", auth.Require(models.ScopeDelete), handler.DeleteVM)
+	api.POST("/vm/:id/ttl", auth.Require(models.ScopeCreate), handler.ExtendTTL)
+	api.DELETE("/vm/:id/ttl", auth.Require(models.ScopeCreate), handler.CancelTTL)
+	api.GET("/vm/:id/status", auth.Require(models.ScopeRead), handler.GetVMStatus)
+	api.POST("/vm/:id/stop", auth.Require(models.ScopeCreate), handler.StopVM)
+	api.POST("/vm/:id/start", auth.Require(models.ScopeCreate), handler.StartVM)
+	api.POST("/vm/:id/reboot", auth.Require(models.ScopeCreate), handler.RebootVM)
+	api.GET("/vm/:id/firewall", auth.Require(models.ScopeRead), handler.GetFirewall)
+	api.PUT("/vm/:id/firewall", auth.Require(models.ScopeCreate), handler.SetFirewall)
+
+	// Asynchronous operations
+	api.GET("/operations/:id", auth.Require(models.ScopeRead), operationHandler.GetOperation)
+
+	// VM events, streamed as they are recorded
+	api.GET("/events", auth.Require(models.ScopeRead), eventHandler.StreamEvents)
+	api.GET("/events/ws", auth.Require(models.ScopeRead), eventHandler.StreamEventsWebSocket)
+
+	// SSH key registry
+	api.POST("/ssh-keys", auth.Require(models.ScopeCreate), sshKeyHandler.CreateSSHKey)
+	api.GET("/ssh-keys", auth.Require(models.ScopeRead), sshKeyHandler.ListSSHKeys)
+	api.DELETE("/ssh-keys/:id", auth.Require(models.ScopeDelete), sshKeyHandler.DeleteSSHKey)
+
+	// Persistent data volumes
+	api.POST("/volumes", auth.Require(models.ScopeCreate), volumeHandler.CreateVolume)
+	api.GET("/volumes", auth.Require(models.ScopeRead), volumeHandler.ListVolumes)
+	api.GET("/volumes/:id", auth.Require(models.ScopeRead), volumeHandler.GetVolume)
+	api.DELETE("/volumes/:id", auth.Require(models.ScopeDelete), volumeHandler.DeleteVolume)
+	api.POST("/volumes/:id/attach", auth.Require(models.ScopeCreate), volumeHandler.AttachVolume)
+	api.POST("/volumes/:id/detach", auth.Require(models.ScopeCreate), volumeHandler.DetachVolume)
+
+	// Snapshots and their retention
+	api.POST("/vm/:id/snapshots", auth.Require(models.ScopeCreate), snapshotHandler.CreateSnapshot)
+	api.GET("/snapshots", auth.Require(models.ScopeRead), snapshotHandler.ListSnapshots)
+	api.GET("/snapshots/:id", auth.Require(models.ScopeRead), snapshotHandler.GetSnapshot)
+	api.DELETE("/snapshots/:id", auth.Require(models.ScopeDelete), snapshotHandler.DeleteSnapshot)
+	api.GET("/snapshot-policy", auth.Require(models.ScopeRead), snapshotHandler.GetSnapshotPolicy)
+	api.PUT("/snapshot-policy", auth.Require(models.ScopeCreate), snapshotHandler.SetSnapshotPolicy)
+
+	// Reconciliation reports cover every user's VMs
+	api.GET("/reconcile/report", auth.Require(models.ScopeAdmin), reconcileHandler.GetReport)
+	api.POST("/reconcile/dry-run", auth.Require(models.ScopeAdmin), reconcileHandler.DryRun)
+
+	// Webhook subscriptions and their delivery log
+	api.POST("/webhooks", auth.Require(models.ScopeAdmin), webhookHandler.CreateWebhook)
+	api.GET("/webhooks", auth.Require(models.ScopeAdmin), webhookHandler.ListWebhooks)
+	api.GET("/webhooks/:id", auth.Require(models.ScopeAdmin), webhookHandler.GetWebhook)
+	api.DELETE("/webhooks/:id", auth.Require(models.ScopeAdmin), webhookHandler.DeleteWebhook)
+	api.GET("/webhooks/:id/deliveries", auth.Require(models.ScopeAdmin), webhookHandler.ListDeliveries)
+	api.POST("/webhooks/:id/deliveries/:deliveryId/redeliver", auth.Require(models.ScopeAdmin), webhookHandler.Redeliver)
+
+	// API key management
+	api.POST("/api-keys", auth.Require(models.ScopeAdmin), apiKeyHandler.CreateAPIKey)
+	api.GET("/api-keys", auth.Require(models.ScopeAdmin), apiKeyHandler.ListAPIKeys)
+	api.POST("/api-keys/:id/rotate", auth.Require(models.ScopeAdmin), apiKeyHandler.RotateAPIKey)
+	api.DELETE("/api-keys/:id", auth.Require(models.ScopeAdmin), apiKeyHandler.RevokeAPIKey)
 
 	// Start server
 	port := os.Getenv("PORT")
@@ -74,10 +246,38 @@ func main() {
 		port = "8080"
 	}
 
-	log.Printf("🚀 VM Provisioner starting on port %s", port)
-	log.Printf("📡 Supported providers: AWS (GPU), Hetzner (CPU)")
-	
-	if err := r.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	slog.Info("VM Provisioner starting", "port", port)
+	for _, info := range registry.List() {
+		slog.Info("Provider status", "provider", info.Name, "status", info.Status)
+	}
+
+	srv := &http.Server{Addr: ":" + port, Handler: r}
+	// Event streams never end by themselves and would hold up Shutdown
+	srv.RegisterOnShutdown(eventHandler.CloseStreams)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("failed to start server: %w", err)
+	case <-ctx.Done():
 	}
-}
\ No newline at end of file
+	// A second signal kills the process right away
+	stop()
+
+	// Refuse new connections and let in-flight requests finish
+	slog.Info("VM Provisioner shutting down", "timeout", cfg.Timeouts.Shutdown)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Shutdown)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Failed to finish in-flight requests", "error", err)
+	}
+
+	// Nothing submits operations anymore: cancel running ones, fail queued ones
+	stopWorkers()
+	ops.Wait()
+	return nil
+}